@@ -0,0 +1,155 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// keyCacheNames are the names of the database ID caches that can be flushed. They match the cache metric labels.
+var keyCacheNames = []string{"cluster", "parent_policy", "policy"}
+
+// CacheFlushResponse is the response of the cache flush admin endpoint.
+type CacheFlushResponse struct {
+	Flushed []string `json:"flushed"`
+}
+
+// CacheStatsResponse is the response of the cache stats admin endpoint. Caches is keyed by the names in keyCacheNames.
+type CacheStatsResponse struct {
+	Caches map[string]KeyCacheStats `json:"caches"`
+	// InflightRequests is the number of requests being handled, including this one. It's also the
+	// compliance_events_api_inflight_requests metric.
+	InflightRequests int64 `json:"inflight_requests"` //nolint:tagliatelle
+}
+
+// authorizeAdminRequest verifies the user is authorized for the admin endpoint of the request. If false is returned,
+// an error response has already been written.
+func authorizeAdminRequest(w http.ResponseWriter, r *http.Request, userConfig *rest.Config) bool {
+	allowed, err := canAccessAdminEndpoint(userConfig, r)
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			writeErrMsgJSON(w, "Unauthorized", http.StatusUnauthorized)
+
+			return false
+		}
+
+		ctrl.LoggerFrom(r.Context()).Error(err, "error determining if the user is authorized for the admin endpoint")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return false
+	}
+
+	if !allowed {
+		// Logging is handled by canAccessAdminEndpoint
+		writeErrMsgJSON(w, "Forbidden", http.StatusForbidden)
+
+		return false
+	}
+
+	return true
+}
+
+// flushKeyCaches handles the cache flush admin endpoint. It clears the database ID caches so that they are repopulated
+// from the database, such as after the clusters or policies tables were modified out-of-band. The cache query argument
+// limits the flush to a single cache. The caller must hold the write lock on serverContext.
+func flushKeyCaches(serverContext *ComplianceServerCtx, w http.ResponseWriter, r *http.Request) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	response := CacheFlushResponse{Flushed: keyCacheNames}
+
+	for arg := range r.URL.Query() {
+		if arg != "cache" {
+			writeErrMsgJSON(
+				w, fmt.Sprintf("%v: %s is not supported, choose from: cache", ErrInvalidQueryArgValue, arg),
+				http.StatusBadRequest,
+			)
+
+			return
+		}
+	}
+
+	if cache := r.URL.Query().Get("cache"); cache != "" {
+		if !slices.Contains(keyCacheNames, cache) {
+			writeErrMsgJSON(
+				w,
+				fmt.Sprintf(
+					"%v: cache must be one of %s but got: %s",
+					ErrInvalidQueryArgValue, strings.Join(keyCacheNames, ", "), cache,
+				),
+				http.StatusBadRequest,
+			)
+
+			return
+		}
+
+		response.Flushed = []string{cache}
+	}
+
+	for _, cache := range response.Flushed {
+		switch cache {
+		case "cluster":
+			clusterKeyCache.Clear()
+		case "parent_policy":
+			serverContext.ParentPolicyToID.Clear()
+		case "policy":
+			serverContext.PolicyToID.Clear()
+		}
+	}
+
+	reqLog.Info("Flushed the database ID caches", "caches", response.Flushed)
+
+	jsonResp, err := json.Marshal(response)
+	if err != nil {
+		reqLog.Error(err, "Failed to marshal the response")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if _, err = w.Write(jsonResp); err != nil {
+		reqLog.Error(err, "Error writing success response")
+	}
+}
+
+// getKeyCacheStats handles the cache stats admin endpoint. It returns the size and usage of each database ID cache to
+// complement the cache metrics with an on-demand snapshot. The caller must hold a read lock on serverContext.
+func getKeyCacheStats(serverContext *ComplianceServerCtx, w http.ResponseWriter, r *http.Request) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	if len(r.URL.Query()) != 0 {
+		writeErrMsgJSON(
+			w, fmt.Sprintf("%v: no query arguments are supported", ErrInvalidQueryArgValue), http.StatusBadRequest,
+		)
+
+		return
+	}
+
+	response := CacheStatsResponse{
+		Caches: map[string]KeyCacheStats{
+			"cluster":       clusterKeyCache.Stats(),
+			"parent_policy": serverContext.ParentPolicyToID.Stats(),
+			"policy":        serverContext.PolicyToID.Stats(),
+		},
+		InflightRequests: inflightRequests.Load(),
+	}
+
+	jsonResp, err := json.Marshal(response)
+	if err != nil {
+		reqLog.Error(err, "Failed to marshal the response")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if _, err = w.Write(jsonResp); err != nil {
+		reqLog.Error(err, "Error writing success response")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// TestFlushKeyCaches isn't parallel since it modifies the package level cluster cache.
+func TestFlushKeyCaches(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		expectedCode int
+		flushed      []string
+	}{
+		{"all caches", "/api/v1/admin/cache/flush", http.StatusOK, []string{"cluster", "parent_policy", "policy"}},
+		{"policy cache", "/api/v1/admin/cache/flush?cache=policy", http.StatusOK, []string{"policy"}},
+		{"invalid cache", "/api/v1/admin/cache/flush?cache=events", http.StatusBadRequest, nil},
+		{"invalid query argument", "/api/v1/admin/cache/flush?all=true", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			serverContext := &ComplianceServerCtx{
+				ParentPolicyToID: NewKeyCache(0, 0),
+				PolicyToID:       NewKeyCache(0, 0),
+			}
+			serverContext.ParentPolicyToID.Store("parent", int32(1))
+			serverContext.PolicyToID.Store("policy", int32(2))
+			clusterKeyCache.Store("cluster", int32(3))
+
+			recorder := httptest.NewRecorder()
+			flushKeyCaches(serverContext, recorder, httptest.NewRequest(http.MethodPost, test.target, nil))
+
+			g.Expect(recorder.Code).To(Equal(test.expectedCode))
+
+			lengths := map[string]int{
+				"cluster":       clusterKeyCache.Len(),
+				"parent_policy": serverContext.ParentPolicyToID.Len(),
+				"policy":        serverContext.PolicyToID.Len(),
+			}
+
+			for cache, length := range lengths {
+				if slices.Contains(test.flushed, cache) {
+					g.Expect(length).To(BeZero(), cache)
+				} else {
+					g.Expect(length).To(Equal(1), cache)
+				}
+			}
+		})
+	}
+}
+
+// TestGetKeyCacheStats isn't parallel since it reads the package level cluster cache.
+func TestGetKeyCacheStats(t *testing.T) {
+	g := NewWithT(t)
+
+	serverContext := &ComplianceServerCtx{
+		ParentPolicyToID: NewKeyCache(5, 0),
+		PolicyToID:       NewKeyCache(5, 0),
+	}
+	serverContext.PolicyToID.Store("policy", int32(2))
+	_, _ = serverContext.PolicyToID.Load("policy")
+	_, _ = serverContext.PolicyToID.Load("other")
+
+	recorder := httptest.NewRecorder()
+	getKeyCacheStats(serverContext, recorder, httptest.NewRequest(http.MethodGet, "/api/v1/admin/cache/stats", nil))
+
+	g.Expect(recorder.Code).To(Equal(http.StatusOK))
+
+	response := CacheStatsResponse{}
+	g.Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+	g.Expect(response.Caches).To(HaveLen(len(keyCacheNames)))
+	g.Expect(response.Caches).To(HaveKey("cluster"))
+	// The handler was called directly rather than through inflightHandler
+	g.Expect(response.InflightRequests).To(BeZero())
+	g.Expect(response.Caches["parent_policy"]).To(Equal(KeyCacheStats{Capacity: 5}))
+	g.Expect(response.Caches["policy"]).To(Equal(KeyCacheStats{
+		Entries: 1, Capacity: 5, Hits: 1, Misses: 1, HitRatio: 0.5,
+	}))
+
+	recorder = httptest.NewRecorder()
+	getKeyCacheStats(
+		serverContext, recorder, httptest.NewRequest(http.MethodGet, "/api/v1/admin/cache/stats?cache=policy", nil),
+	)
+
+	g.Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+}
@@ -0,0 +1,124 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is an audit log entry for a compliance event that was recorded. It intentionally doesn't include the
+// policy spec.
+type AuditRecord struct {
+	RecordedAt      time.Time `json:"recorded_at"` //nolint:tagliatelle
+	User            string    `json:"user"`
+	RequestID       string    `json:"request_id"`                 //nolint:tagliatelle
+	EventID         int32     `json:"event_id"`                   //nolint:tagliatelle
+	ClusterName     string    `json:"cluster_name"`               //nolint:tagliatelle
+	ClusterID       string    `json:"cluster_id"`                 //nolint:tagliatelle
+	PolicyID        int32     `json:"policy_id"`                  //nolint:tagliatelle
+	PolicyAPIGroup  string    `json:"policy_api_group,omitempty"` //nolint:tagliatelle
+	PolicyKind      string    `json:"policy_kind,omitempty"`      //nolint:tagliatelle
+	PolicyName      string    `json:"policy_name,omitempty"`      //nolint:tagliatelle
+	PolicyNamespace *string   `json:"policy_namespace,omitempty"` //nolint:tagliatelle
+	Compliance      string    `json:"compliance"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// auditLogger writes an AuditRecord as a line of JSON for every recorded compliance event. A nil *auditLogger
+// discards the records so that callers don't need to check if audit logging is enabled.
+type auditLogger struct {
+	lock sync.Mutex
+	out  io.WriteCloser
+}
+
+// newAuditLogger returns an auditLogger that appends to the file at path. A path of "-" writes to standard output.
+func newAuditLogger(path string) (*auditLogger, error) {
+	if path == "-" {
+		return &auditLogger{out: nopWriteCloser{os.Stdout}}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditLogger{out: file}, nil
+}
+
+// recordCreated writes an audit record for each of the input compliance events, which must have been committed to the
+// database. Write errors are logged rather than returned since the compliance events were already recorded.
+func (a *auditLogger) recordCreated(w http.ResponseWriter, r *http.Request, events ...*ComplianceEvent) {
+	if a == nil {
+		return
+	}
+
+	a.record(getTokenUsername(parseToken(r)), w.Header().Get(requestIDHeader), events...)
+}
+
+// record writes an audit record for each of the input compliance events on behalf of the user and request ID. This is
+// used directly when the compliance events are recorded after the request finished, such as from the event queue.
+func (a *auditLogger) record(user string, requestID string, events ...*ComplianceEvent) {
+	if a == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, event := range events {
+		record := AuditRecord{
+			RecordedAt:      now,
+			User:            user,
+			RequestID:       requestID,
+			EventID:         event.Event.KeyID,
+			ClusterName:     event.Cluster.Name,
+			ClusterID:       event.Cluster.ClusterID,
+			PolicyID:        event.Event.PolicyID,
+			PolicyAPIGroup:  event.Policy.APIGroup,
+			PolicyKind:      event.Policy.Kind,
+			PolicyName:      event.Policy.Name,
+			PolicyNamespace: event.Policy.Namespace,
+			Compliance:      event.Event.Compliance,
+			Timestamp:       event.Event.Timestamp,
+		}
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			log.Error(err, "Failed to marshal the audit record", "requestID", requestID)
+
+			continue
+		}
+
+		if _, err := a.out.Write(append(line, '\n')); err != nil {
+			log.Error(err, "Failed to write the audit record", "requestID", requestID, "eventID", record.EventID)
+		}
+	}
+}
+
+// close closes the audit log file.
+func (a *auditLogger) close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.out.Close()
+}
+
+// nopWriteCloser is used for standard output so that it's not closed with the audit log.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestAuditLoggerRecordCreated(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLog, err := newAuditLogger(path)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	req := httptest.NewRequest("POST", "/api/v1/compliance-events", nil)
+	w := httptest.NewRecorder()
+	w.Header().Set(requestIDHeader, "my-request")
+
+	timestamp := time.Date(2023, 4, 4, 4, 4, 4, 0, time.UTC)
+	event := &ComplianceEvent{
+		Cluster: Cluster{Name: "cluster1", ClusterID: "cluster1-uuid"},
+		Event:   EventDetails{KeyID: 3, PolicyID: 2, Compliance: "Compliant", Timestamp: timestamp},
+		Policy: Policy{
+			APIGroup: "policy.open-cluster-management.io",
+			Kind:     "ConfigurationPolicy",
+			Name:     "policy1",
+			Spec:     JSONMap{"secret": "do-not-log"},
+		},
+	}
+
+	auditLog.recordCreated(w, req, event, event)
+	g.Expect(auditLog.close()).To(Succeed())
+
+	contents, err := os.ReadFile(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(contents)).ToNot(ContainSubstring("do-not-log"))
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	g.Expect(lines).To(HaveLen(2))
+
+	record := AuditRecord{}
+	g.Expect(json.Unmarshal([]byte(lines[0]), &record)).To(Succeed())
+	g.Expect(record.RequestID).To(Equal("my-request"))
+	g.Expect(record.EventID).To(Equal(int32(3)))
+	g.Expect(record.ClusterName).To(Equal("cluster1"))
+	g.Expect(record.PolicyName).To(Equal("policy1"))
+	g.Expect(record.Compliance).To(Equal("Compliant"))
+	g.Expect(record.Timestamp.Equal(timestamp)).To(BeTrue())
+}
+
+func TestAuditLoggerDisabled(t *testing.T) {
+	t.Parallel()
+
+	var auditLog *auditLogger
+
+	// A nil audit logger must be safe to use.
+	auditLog.recordCreated(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil), &ComplianceEvent{})
+	NewWithT(t).Expect(auditLog.close()).To(Succeed())
+}
@@ -2,11 +2,14 @@
 package complianceeventsapi
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/stolostron/rbac-api-utils/pkg/rbac"
 	authzv1 "k8s.io/api/authorization/v1"
@@ -17,6 +20,18 @@ import (
 	"k8s.io/client-go/rest"
 )
 
+// recordAuthzCacheTTL is how long a successful authorization to record compliance events for a cluster is cached.
+const recordAuthzCacheTTL = time.Minute
+
+// recordAuthzCache caches successful authorizations to record compliance events so that the Kubernetes API isn't
+// queried for every compliance event. The key is the hash of the token and the cluster name.
+var recordAuthzCache = NewKeyCache(DefaultKeyCacheCapacity, recordAuthzCacheTTL)
+
+// authenticatedTokens maps the hash of a token that the Kubernetes API accepted to the identity of its user so that the
+// rate limiter only trusts tokens that were verified. Entries expire after recordAuthzCacheTTL like the cached
+// authorizations.
+var authenticatedTokens = NewKeyCache(DefaultKeyCacheCapacity, recordAuthzCacheTTL)
+
 func getManagedClusterRules(userChangedConfig *rest.Config, managedClusterNames []string,
 ) (map[string][]string, error) {
 	kclient, err := kubernetes.NewForConfig(userChangedConfig)
@@ -33,7 +48,12 @@ func getManagedClusterRules(userChangedConfig *rest.Config, managedClusterNames
 
 	// key is managedClusterName and value is verbs.
 	// ex: {"managed1": ["get"], "managed2": ["list","create"], "managed3": []}
-	return rbac.GetResourceAccess(kclient, managedClusterGR, managedClusterNames, "")
+	rules, err := rbac.GetResourceAccess(kclient, managedClusterGR, managedClusterNames, "")
+	if err == nil {
+		recordAuthenticatedToken(userChangedConfig.BearerToken)
+	}
+
+	return rules, err
 }
 
 func canGetManagedCluster(userChangedConfig *rest.Config, managedClusterName string,
@@ -67,13 +87,20 @@ func parseToken(req *http.Request) string {
 
 // canRecordComplianceEvent will perform token authentication and perform a self subject access review to
 // ensure the input user has patch access to patch the policy status in the managed cluster namespace. An error is
-// returned if the authorization could not be determined.
+// returned if the authorization could not be determined. Successful authorizations are cached for
+// recordAuthzCacheTTL.
 func canRecordComplianceEvent(cfg *rest.Config, clusterName string, req *http.Request) (bool, error) {
 	userConfig, err := getUserKubeConfig(cfg, req)
 	if err != nil {
 		return false, err
 	}
 
+	cacheKey := recordAuthzCacheKey(userConfig.BearerToken, clusterName)
+
+	if _, ok := recordAuthzCache.Load(cacheKey); ok {
+		return true, nil
+	}
+
 	userClient, err := kubernetes.NewForConfig(userConfig)
 	if err != nil {
 		return false, err
@@ -103,17 +130,55 @@ func canRecordComplianceEvent(cfg *rest.Config, clusterName string, req *http.Re
 		return false, err
 	}
 
+	recordAuthenticatedToken(userConfig.BearerToken)
+
 	if !result.Status.Allowed {
 		log.V(0).Info(
 			"The user is not authorized to record a compliance event",
 			"cluster", clusterName,
 			"user", getTokenUsername(userConfig.BearerToken),
 		)
+	} else {
+		recordAuthzCache.Store(cacheKey, true)
 	}
 
 	return result.Status.Allowed, nil
 }
 
+// recordAuthzCacheKey returns the recordAuthzCache key of the token and cluster name. The token is hashed so that it
+// isn't kept in memory.
+func recordAuthzCacheKey(token string, clusterName string) string {
+	return hashToken(token) + "/" + clusterName
+}
+
+// hashToken returns the hex encoded SHA-256 hash of the token so that tokens aren't kept in memory.
+func hashToken(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(tokenHash[:])
+}
+
+// recordAuthenticatedToken records that the Kubernetes API accepted the token. The identity is the username in the
+// token, or the hash of the token if it doesn't have one.
+func recordAuthenticatedToken(token string) {
+	identity := getTokenUsername(token)
+	if identity == "" {
+		identity = hashToken(token)
+	}
+
+	authenticatedTokens.Store(hashToken(token), identity)
+}
+
+// getAuthenticatedIdentity returns the identity of the user of the token if the Kubernetes API recently accepted it.
+func getAuthenticatedIdentity(token string) (string, bool) {
+	identity, ok := authenticatedTokens.Load(hashToken(token))
+	if !ok {
+		return "", false
+	}
+
+	return identity.(string), true
+}
+
 // getTokenUsername will parse the token and return the username. If the token is invalid, an empty string is returned.
 func getTokenUsername(token string) string {
 	parts := strings.Split(token, ".")
@@ -168,3 +233,45 @@ func getUserKubeConfig(config *rest.Config, r *http.Request) (*rest.Config, erro
 
 	return userConfig, nil
 }
+
+// canAccessAdminEndpoint performs a self subject access review to ensure the user is allowed to use the HTTP verb on
+// the non-resource URL of the request path, such as "post" on "/api/v1/admin/cache/flush". This lets administrators
+// grant access to the admin endpoints with the nonResourceURLs field of a ClusterRole.
+func canAccessAdminEndpoint(userConfig *rest.Config, req *http.Request) (bool, error) {
+	userClient, err := kubernetes.NewForConfig(userConfig)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := userClient.AuthorizationV1().SelfSubjectAccessReviews().Create(
+		req.Context(),
+		&authzv1.SelfSubjectAccessReview{
+			Spec: authzv1.SelfSubjectAccessReviewSpec{
+				NonResourceAttributes: &authzv1.NonResourceAttributes{
+					Path: req.URL.Path,
+					Verb: strings.ToLower(req.Method),
+				},
+			},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		if k8serrors.IsUnauthorized(err) {
+			return false, ErrUnauthorized
+		}
+
+		return false, err
+	}
+
+	recordAuthenticatedToken(userConfig.BearerToken)
+
+	if !result.Status.Allowed {
+		log.V(0).Info(
+			"The user is not authorized to access the admin endpoint",
+			"path", req.URL.Path,
+			"user", getTokenUsername(userConfig.BearerToken),
+		)
+	}
+
+	return result.Status.Allowed, nil
+}
@@ -1,7 +1,15 @@
 package complianceeventsapi
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
 )
 
 func TestGetTokenUsername(t *testing.T) {
@@ -21,3 +29,154 @@ func TestGetTokenUsername(t *testing.T) {
 		t.Fatalf("Expected %s but got %s", expected, username)
 	}
 }
+
+// fakeAuthzAPI is a Kubernetes API that answers self subject access reviews with whether the token is allowed and
+// counts the reviews per token.
+type fakeAuthzAPI struct {
+	lock    sync.Mutex
+	allowed map[string]bool
+	reviews map[string]int
+}
+
+func newFakeAuthzAPI(t *testing.T) (*fakeAuthzAPI, *rest.Config) {
+	t.Helper()
+
+	api := &fakeAuthzAPI{allowed: map[string]bool{}, reviews: map[string]int{}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		api.lock.Lock()
+		api.reviews[token]++
+		allowed := api.allowed[token]
+		api.lock.Unlock()
+
+		status := `{"allowed":false}`
+		if allowed {
+			status = `{"allowed":true}`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(
+			`{"kind":"SelfSubjectAccessReview","apiVersion":"authorization.k8s.io/v1","status":` + status + `}`,
+		))
+	}))
+	t.Cleanup(server.Close)
+
+	return api, &rest.Config{Host: server.URL}
+}
+
+func (f *fakeAuthzAPI) setAllowed(token string, allowed bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.allowed[token] = allowed
+}
+
+func (f *fakeAuthzAPI) reviewCount(token string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.reviews[token]
+}
+
+// expireKeyCacheEntry makes the entry for the key expire as if the TTL had passed.
+func expireKeyCacheEntry(cache *KeyCache, key any) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		element.Value.(*keyCacheEntry).expires = time.Now().Add(-time.Second)
+	}
+}
+
+func canRecordWithToken(g Gomega, cfg *rest.Config, token string, clusterName string) bool {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/compliance-events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	allowed, err := canRecordComplianceEvent(cfg, clusterName, req)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	return allowed
+}
+
+func TestCanRecordComplianceEventCache(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	api, cfg := newFakeAuthzAPI(t)
+	token := "record-authz-cache-hit"
+	api.setAllowed(token, true)
+
+	g.Expect(canRecordWithToken(g, cfg, token, "cluster1")).To(BeTrue())
+	g.Expect(api.reviewCount(token)).To(Equal(1))
+
+	// The cached authorization is used even if the access is revoked.
+	api.setAllowed(token, false)
+
+	g.Expect(canRecordWithToken(g, cfg, token, "cluster1")).To(BeTrue())
+	g.Expect(api.reviewCount(token)).To(Equal(1))
+
+	// Each cluster is authorized separately.
+	g.Expect(canRecordWithToken(g, cfg, token, "cluster2")).To(BeFalse())
+	g.Expect(api.reviewCount(token)).To(Equal(2))
+}
+
+func TestCanRecordComplianceEventCacheExpiration(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	api, cfg := newFakeAuthzAPI(t)
+	token := "record-authz-cache-expiration"
+	api.setAllowed(token, true)
+
+	g.Expect(canRecordWithToken(g, cfg, token, "cluster1")).To(BeTrue())
+
+	api.setAllowed(token, false)
+	expireKeyCacheEntry(recordAuthzCache, recordAuthzCacheKey(token, "cluster1"))
+
+	// The revoked access takes effect once the cached authorization expires.
+	g.Expect(canRecordWithToken(g, cfg, token, "cluster1")).To(BeFalse())
+	g.Expect(api.reviewCount(token)).To(Equal(2))
+}
+
+func TestCanRecordComplianceEventCachePerToken(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	api, cfg := newFakeAuthzAPI(t)
+	allowedToken := "record-authz-cache-allowed-token"
+	deniedToken := "record-authz-cache-denied-token"
+	api.setAllowed(allowedToken, true)
+
+	g.Expect(canRecordWithToken(g, cfg, allowedToken, "cluster1")).To(BeTrue())
+
+	// Another token for the same cluster doesn't use the cached authorization.
+	g.Expect(canRecordWithToken(g, cfg, deniedToken, "cluster1")).To(BeFalse())
+	g.Expect(api.reviewCount(allowedToken)).To(Equal(1))
+	g.Expect(api.reviewCount(deniedToken)).To(Equal(1))
+}
+
+func TestCanRecordComplianceEventDenialNotCached(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	api, cfg := newFakeAuthzAPI(t)
+	token := "record-authz-cache-denial"
+
+	g.Expect(canRecordWithToken(g, cfg, token, "cluster1")).To(BeFalse())
+
+	// A denied token is still authenticated, so the rate limiter can identify the user.
+	_, authenticated := getAuthenticatedIdentity(token)
+	g.Expect(authenticated).To(BeTrue())
+
+	// Access that is granted after a denial takes effect right away.
+	api.setAllowed(token, true)
+
+	g.Expect(canRecordWithToken(g, cfg, token, "cluster1")).To(BeTrue())
+	g.Expect(api.reviewCount(token)).To(Equal(2))
+}
@@ -0,0 +1,244 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultInsertBatchMaxSize is the default maximum number of compliance events recorded in a single batch.
+const DefaultInsertBatchMaxSize = 100
+
+// batchedInsert is a compliance event waiting in the insert batcher along with where to send its result.
+type batchedInsert struct {
+	event *ComplianceEvent
+	// result receives the result once the batch is committed.
+	result chan batchedInsertResult
+}
+
+type batchedInsertResult struct {
+	deduplicated bool
+	err          error
+}
+
+// insertBatcher accumulates the compliance events of concurrent requests for up to the InsertBatchWindow option and
+// records them in a single transaction, which commits once per batch instead of once per compliance event at the cost
+// of some latency.
+type insertBatcher struct {
+	window  time.Duration
+	maxSize int
+	// lock protects closed so that a compliance event is never sent on the closed inserts channel.
+	lock    sync.RWMutex
+	closed  bool
+	inserts chan *batchedInsert
+	// flushes are the batches being recorded.
+	flushes sync.WaitGroup
+	done    chan struct{}
+}
+
+// startInsertBatcher starts the worker that batches the compliance events sent to the returned batcher. The worker runs
+// until the batcher is stopped.
+func (s *ComplianceAPIServer) startInsertBatcher(serverContext *ComplianceServerCtx) *insertBatcher {
+	batcher := &insertBatcher{
+		window:  s.options.InsertBatchWindow,
+		maxSize: s.options.InsertBatchMaxSize,
+		inserts: make(chan *batchedInsert, s.options.InsertBatchMaxSize),
+		done:    make(chan struct{}),
+	}
+
+	log.Info(
+		"Starting the compliance event insert batcher",
+		"window", batcher.window.String(),
+		"maxSize", batcher.maxSize,
+	)
+
+	go func() {
+		defer close(batcher.done)
+
+		for {
+			batch := batcher.nextBatch()
+			if batch == nil {
+				break
+			}
+
+			// The next batch is collected while this one is recorded.
+			batcher.flushes.Add(1)
+
+			go func() {
+				defer batcher.flushes.Done()
+
+				s.insertBatch(serverContext, batch)
+			}()
+		}
+
+		batcher.flushes.Wait()
+	}()
+
+	return batcher
+}
+
+// nextBatch waits for a compliance event and returns it with the other compliance events received within the window,
+// up to the maximum batch size. Nil is returned when the batcher is stopped and there are no compliance events left.
+func (b *insertBatcher) nextBatch() []*batchedInsert {
+	first, ok := <-b.inserts
+	if !ok {
+		return nil
+	}
+
+	batch := []*batchedInsert{first}
+
+	timer := time.NewTimer(b.window)
+	defer timer.Stop()
+
+	for len(batch) < b.maxSize {
+		select {
+		case next, ok := <-b.inserts:
+			if !ok {
+				return batch
+			}
+
+			batch = append(batch, next)
+		case <-timer.C:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// insert records the compliance event in the next batch and waits until the batch is committed. The return values are
+// the same as insertComplianceEvent. If ctx is closed before the compliance event is added to a batch, its error is
+// returned. Once it's added, the result is always waited for so that the caller knows if it was recorded, and the batch
+// is bounded by the DBQueryTimeout option instead. It assumes you have a read lock already attained, which keeps the
+// database connection from changing while the batch is recorded.
+func (b *insertBatcher) insert(ctx context.Context, event *ComplianceEvent) (bool, error) {
+	inserted := &batchedInsert{event: event, result: make(chan batchedInsertResult, 1)}
+
+	b.lock.RLock()
+
+	if b.closed {
+		b.lock.RUnlock()
+
+		return false, errDBUnavailable
+	}
+
+	select {
+	case b.inserts <- inserted:
+		b.lock.RUnlock()
+	case <-ctx.Done():
+		b.lock.RUnlock()
+
+		return false, ctx.Err()
+	}
+
+	result := <-inserted.result
+
+	return result.deduplicated, result.err
+}
+
+// insertBatch records the batch of compliance events and their foreign key rows in a single transaction. A duplicate
+// compliance event only fails its own request. If the transaction fails for another reason, each compliance event is
+// recorded on its own so that a single invalid compliance event doesn't fail the other requests in the batch.
+func (s *ComplianceAPIServer) insertBatch(serverContext *ComplianceServerCtx, batch []*batchedInsert) {
+	ctx, cancel := s.batchContext()
+	defer cancel()
+
+	events := make([]*ComplianceEvent, 0, len(batch))
+	for _, inserted := range batch {
+		events = append(events, inserted.event)
+	}
+
+	results := make([]batchedInsertResult, len(batch))
+
+	// See insertComplianceEvent for why the whole transaction is retried.
+	err := retryStaleForeignKeys(ctx, serverContext, events, func() error {
+		return s.retryTransientDBErrors(ctx, func() error {
+			return inTransaction(ctx, serverContext.DB, func(tx *sql.Tx) error {
+				db := serverContext.preparedTx(tx)
+
+				for i, event := range events {
+					results[i] = batchedInsertResult{}
+
+					if err := setForeignKeys(ctx, serverContext, db, event); err != nil {
+						return err
+					}
+
+					found, err := findRecentComplianceEvent(ctx, db, &event.Event, s.options.DedupWindow)
+					if err != nil {
+						return err
+					}
+
+					results[i].deduplicated = found
+					if found {
+						continue
+					}
+
+					// ON CONFLICT DO NOTHING means a duplicate doesn't abort the transaction.
+					if err := event.Create(ctx, db); err != nil {
+						if !errors.Is(err, errDuplicateComplianceEvent) {
+							return err
+						}
+
+						results[i].err = err
+					}
+				}
+
+				return nil
+			})
+		})
+	})
+
+	insertBatchSizeMetric.Observe(float64(len(batch)))
+
+	if err != nil {
+		log.V(2).Info(
+			"Failed to record the batch of compliance events. Recording them individually.",
+			"size", len(batch), "error", err.Error(),
+		)
+
+		for i, event := range events {
+			results[i].deduplicated, results[i].err = s.insertFallback(serverContext, event)
+		}
+	}
+
+	for i, inserted := range batch {
+		inserted.result <- results[i]
+	}
+}
+
+// insertFallback records a compliance event of a failed batch on its own. It gets its own DBQueryTimeout since the
+// failed batch may have used up the batch's timeout, such as when it timed out or its transient errors were retried.
+func (s *ComplianceAPIServer) insertFallback(serverContext *ComplianceServerCtx, event *ComplianceEvent) (bool, error) {
+	ctx, cancel := s.batchContext()
+	defer cancel()
+
+	return s.insertComplianceEvent(ctx, serverContext, event, false)
+}
+
+// batchContext returns the context of recording a batch, which has the DBQueryTimeout option as its timeout since it
+// isn't bound to a single request.
+func (s *ComplianceAPIServer) batchContext() (context.Context, context.CancelFunc) {
+	if s.options.DBQueryTimeout > 0 {
+		return context.WithTimeout(context.Background(), s.options.DBQueryTimeout)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+// stop stops accepting compliance events and waits for the batches to be recorded.
+func (b *insertBatcher) stop() {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	b.closed = true
+	close(b.inserts)
+	b.lock.Unlock()
+
+	<-b.done
+}
@@ -0,0 +1,105 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestInsertBatcherNextBatch(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	batcher := &insertBatcher{
+		window:  time.Hour,
+		maxSize: 2,
+		inserts: make(chan *batchedInsert, 3),
+		done:    make(chan struct{}),
+	}
+
+	for i := 0; i < 3; i++ {
+		batcher.inserts <- &batchedInsert{event: &ComplianceEvent{}}
+	}
+
+	// A full batch is returned without waiting for the window.
+	g.Expect(batcher.nextBatch()).To(HaveLen(2))
+
+	// The rest are returned once the batcher is stopped.
+	close(batcher.inserts)
+	g.Expect(batcher.nextBatch()).To(HaveLen(1))
+	g.Expect(batcher.nextBatch()).To(BeNil())
+}
+
+func TestInsertBatcherNextBatchWindow(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	batcher := &insertBatcher{
+		window:  10 * time.Millisecond,
+		maxSize: 100,
+		inserts: make(chan *batchedInsert, 1),
+		done:    make(chan struct{}),
+	}
+
+	batcher.inserts <- &batchedInsert{event: &ComplianceEvent{}}
+
+	// A partial batch is returned once the window passes.
+	g.Expect(batcher.nextBatch()).To(HaveLen(1))
+}
+
+func TestInsertBatcherStopped(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	batcher := &insertBatcher{
+		window:  time.Millisecond,
+		maxSize: 1,
+		inserts: make(chan *batchedInsert),
+		done:    make(chan struct{}),
+	}
+	close(batcher.done)
+
+	batcher.stop()
+
+	_, err := batcher.insert(context.Background(), &ComplianceEvent{})
+	g.Expect(err).To(MatchError(errDBUnavailable))
+}
+
+func TestInsertBatcherContext(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	server := &ComplianceAPIServer{options: ComplianceAPIServerOptions{DBQueryTimeout: 10 * time.Millisecond}}
+
+	batchCtx, cancel := server.batchContext()
+	defer cancel()
+
+	<-batchCtx.Done()
+
+	// A compliance event recorded on its own after the batch timed out gets a new timeout.
+	fallbackCtx, cancel := server.batchContext()
+	defer cancel()
+
+	g.Expect(fallbackCtx.Err()).ToNot(HaveOccurred())
+
+	deadline, ok := fallbackCtx.Deadline()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(deadline).To(BeTemporally(">", time.Now()))
+
+	// Without the DBQueryTimeout option, there is no timeout.
+	server.options.DBQueryTimeout = 0
+
+	noTimeoutCtx, cancel := server.batchContext()
+	defer cancel()
+
+	_, ok = noTimeoutCtx.Deadline()
+	g.Expect(ok).To(BeFalse())
+}
@@ -0,0 +1,130 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lib/pq"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// MaxBatchGetIDs is the maximum number of compliance event IDs in a single request to the batch get API endpoint.
+const MaxBatchGetIDs = 100
+
+type BatchGetResponse struct {
+	Data []*ComplianceEvent `json:"data"`
+	// Missing are the requested IDs of compliance events that don't exist, were deleted, or are on managed clusters
+	// the user doesn't have access to.
+	Missing []int32 `json:"missing"`
+}
+
+// getComplianceEventsByIDs handles the batch get API endpoint. The request body is a JSON array of compliance event IDs
+// and the compliance events are returned in the requested order. To not reveal which compliance events exist, the
+// compliance events on managed clusters the user doesn't have access to are treated as missing.
+func getComplianceEventsByIDs(
+	db *sql.DB, w http.ResponseWriter, r *http.Request, userConfig *rest.Config, maxBodyBytes int64,
+) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	body, ok := readRequestBody(w, r, maxBodyBytes)
+	if !ok {
+		return
+	}
+
+	var ids []int32
+
+	if err := json.Unmarshal(body, &ids); err != nil {
+		writeErrMsgJSON(
+			w, "Incorrectly formatted request body, must be a JSON array of compliance event IDs", http.StatusBadRequest,
+		)
+
+		return
+	}
+
+	if len(ids) == 0 || len(ids) > MaxBatchGetIDs {
+		writeErrMsgJSON(
+			w,
+			fmt.Sprintf("The request body must contain between 1 and %d compliance event IDs", MaxBatchGetIDs),
+			http.StatusBadRequest,
+		)
+
+		return
+	}
+
+	response := BatchGetResponse{Data: []*ComplianceEvent{}, Missing: []int32{}}
+	found := make(map[int32]*ComplianceEvent, len(ids))
+
+	authzCondition, filterValues, err := getAuthorizedClustersWhereClause(r, db, userConfig)
+	if err != nil && !errors.Is(err, ErrNoAccess) {
+		reqLog.Error(err, "Failed to determine the managed clusters the user has access to")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	// When the user has no access to any managed cluster, all the compliance events are missing.
+	if err == nil {
+		conditions := fmt.Sprintf(
+			"compliance_events.id = ANY($%d) AND compliance_events.deleted_at IS NULL", len(filterValues)+1,
+		)
+		filterValues = append(filterValues, pq.Array(ids))
+
+		if authzCondition != "" {
+			conditions = authzCondition + " AND " + conditions
+		}
+
+		query := fmt.Sprintf("%s\nWHERE %s", generateGetComplianceEventsQuery(true), conditions) // #nosec G201
+
+		rows, err := db.QueryContext(r.Context(), query, filterValues...)
+		if err == nil {
+			err = rows.Err()
+		}
+
+		if err != nil {
+			reqLog.Error(err, "Failed to query for the compliance events", getPqErrKeyVals(err)...)
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			complianceEvent, err := scanIntoComplianceEvent(rows, true)
+			if err != nil {
+				reqLog.Error(err, "Failed to unmarshal the database results")
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+				return
+			}
+
+			found[complianceEvent.EventID] = complianceEvent
+		}
+	}
+
+	for _, id := range ids {
+		if complianceEvent, ok := found[id]; ok {
+			response.Data = append(response.Data, complianceEvent)
+		} else {
+			response.Missing = append(response.Missing, id)
+		}
+	}
+
+	jsonResp, err := json.Marshal(response)
+	if err != nil {
+		reqLog.Error(err, "Failed to marshal the response")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if _, err = w.Write(jsonResp); err != nil {
+		reqLog.Error(err, "Error writing success response")
+	}
+}
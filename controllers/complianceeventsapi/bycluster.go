@@ -0,0 +1,184 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// byClusterQueryArgs are the query arguments of the compliance by cluster API endpoint other than page and per_page.
+// Filters on the compliance events other than the time aren't supported since they would change which compliance event
+// is the latest for a policy rather than which policies are counted.
+var byClusterQueryArgs = []string{
+	"cluster.cluster_id",
+	"cluster.name",
+	"event.timestamp_after",
+	"event.timestamp_before",
+	"include_deleted",
+}
+
+// ClusterComplianceCounts is a cluster in the response of the compliance by cluster API endpoint with the number of
+// policies in each compliance state based on their latest compliance event.
+type ClusterComplianceCounts struct {
+	Cluster
+	Counts map[string]uint64 `json:"counts"`
+	// Total is the number of policies with a compliance event on the cluster.
+	Total uint64 `json:"total"`
+}
+
+type ClusterComplianceResponse struct {
+	Data     []ClusterComplianceCounts `json:"data"`
+	Metadata metadata                  `json:"metadata"`
+}
+
+// generateByClusterQuery returns the query that counts the policies in each compliance state per cluster, based on the
+// latest compliance event of each policy on the cluster that matches the input WHERE clause. The latest compliance
+// event is selected with a window function so that the aggregation is done in the database. The query takes the same
+// filter values as the WHERE clause.
+func generateByClusterQuery(whereClause string) string {
+	counts := make([]string, 0, len(validComplianceStates))
+
+	for _, compliance := range validComplianceStates {
+		// The compliance states are constants, so they are safe to include in the query.
+		counts = append(counts, fmt.Sprintf("COUNT(*) FILTER (WHERE latest.compliance = '%s')", compliance))
+	}
+
+	return fmt.Sprintf(`WITH latest AS (
+  SELECT
+    compliance_events.cluster_id,
+    compliance_events.compliance,
+    ROW_NUMBER() OVER (
+      PARTITION BY compliance_events.cluster_id, compliance_events.policy_id
+      ORDER BY compliance_events.timestamp DESC, compliance_events.id DESC
+    ) AS row_number
+  FROM compliance_events
+  LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id%s
+)
+SELECT clusters.cluster_id, clusters.name, %s, COUNT(*)
+FROM latest
+JOIN clusters ON latest.cluster_id = clusters.id
+WHERE latest.row_number = 1
+GROUP BY clusters.id, clusters.cluster_id, clusters.name`,
+		whereClause, strings.Join(counts, ", "),
+	) // #nosec G201 -- the WHERE clause uses placeholders for the values
+}
+
+// getComplianceByCluster handles the compliance by cluster API endpoint. For each cluster, it counts the policies in
+// each compliance state based on the latest compliance event of each policy on the cluster. The clusters are sorted by
+// name and paginated the same way as the clusters list API endpoint.
+func getComplianceByCluster(db *sql.DB, w http.ResponseWriter, r *http.Request, userConfig *rest.Config) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	queryArgs := r.URL.Query()
+
+	page, perPage, err := parsePaginationArgs(queryArgs, byClusterQueryArgs...)
+	if err != nil {
+		writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	response := ClusterComplianceResponse{
+		Data:     []ClusterComplianceCounts{},
+		Metadata: metadata{Page: page, PerPage: perPage},
+	}
+
+	// The filters are parsed the same way as the compliance events list API endpoint, which also limits the clusters to
+	// the ones the user has access to.
+	queryArgs.Del("page")
+	queryArgs.Del("per_page")
+
+	parsed, err := parseQueryArgs(r.Context(), queryArgs, db, userConfig, "json")
+	if err != nil && !errors.Is(err, ErrNoAccess) {
+		if errors.Is(err, ErrForbidden) {
+			writeErrMsgJSON(w, err.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		if errors.Is(err, ErrInvalidQueryArg) || errors.Is(err, ErrInvalidQueryArgValue) {
+			writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		writeErrMsgJSON(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	// When the user has no access to any managed cluster, the list is empty.
+	if err == nil {
+		whereClause, filterValues := getWhereClause(parsed)
+		byClusterQuery := generateByClusterQuery(whereClause)
+
+		countQuery := "SELECT COUNT(*) FROM (" + byClusterQuery + ") AS by_cluster" // #nosec G202
+
+		logQuery(r.Context(), countQuery, filterValues)
+
+		if err := db.QueryRowContext(r.Context(), countQuery, filterValues...).Scan(&response.Metadata.Total); err != nil {
+			reqLog.Error(err, "Failed to get the count of clusters", getPqErrKeyVals(err)...)
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		query := fmt.Sprintf(
+			"%s\nORDER BY clusters.name, clusters.cluster_id LIMIT %d OFFSET %d",
+			byClusterQuery, perPage, (page-1)*perPage,
+		) // #nosec G201 -- the limit and offset are validated integers
+
+		logQuery(r.Context(), query, filterValues)
+
+		rows, err := db.QueryContext(r.Context(), query, filterValues...)
+		if err == nil {
+			err = rows.Err()
+		}
+
+		if err != nil {
+			reqLog.Error(err, "Failed to query for the compliance by cluster", getPqErrKeyVals(err)...)
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			cluster := ClusterComplianceCounts{Counts: make(map[string]uint64, len(validComplianceStates))}
+			counts := make([]uint64, len(validComplianceStates))
+
+			scanArgs := []any{&cluster.ClusterID, &cluster.Name}
+			for i := range counts {
+				scanArgs = append(scanArgs, &counts[i])
+			}
+
+			scanArgs = append(scanArgs, &cluster.Total)
+
+			if err := rows.Scan(scanArgs...); err != nil {
+				reqLog.Error(err, "Failed to unmarshal the database results")
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+				return
+			}
+
+			for i, compliance := range validComplianceStates {
+				cluster.Counts[compliance] = counts[i]
+			}
+
+			response.Data = append(response.Data, cluster)
+		}
+
+		response.Metadata.Pages = uint64(math.Ceil(float64(response.Metadata.Total) / float64(perPage)))
+	}
+
+	writeListResponseJSON(w, r, response)
+}
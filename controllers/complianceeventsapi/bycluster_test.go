@@ -0,0 +1,35 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestGenerateByClusterQuery(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	query := generateByClusterQuery("\nWHERE (clusters.name=$1)")
+
+	g.Expect(query).To(ContainSubstring(
+		"PARTITION BY compliance_events.cluster_id, compliance_events.policy_id\n" +
+			"      ORDER BY compliance_events.timestamp DESC, compliance_events.id DESC",
+	))
+	// The filters apply before the latest compliance event of each policy is selected.
+	g.Expect(query).To(ContainSubstring(
+		"LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id\nWHERE (clusters.name=$1)\n)",
+	))
+	g.Expect(query).To(ContainSubstring("WHERE latest.row_number = 1"))
+
+	// The scanned columns depend on there being a count for each compliance state in order.
+	for _, compliance := range validComplianceStates {
+		g.Expect(query).To(ContainSubstring("COUNT(*) FILTER (WHERE latest.compliance = '" + compliance + "')"))
+	}
+
+	g.Expect(strings.Index(query, "'Compliant'")).To(BeNumerically("<", strings.Index(query, "'NonCompliant'")))
+}
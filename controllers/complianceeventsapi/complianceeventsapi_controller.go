@@ -20,7 +20,6 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
-	"github.com/lib/pq"
 	k8sdepwatches "github.com/stolostron/kubernetes-dependency-watches/client"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -52,6 +51,7 @@ var (
 	ErrInvalidDBSecret      = errors.New("the governance-policy-database secret is invalid")
 	ErrInvalidConnectionURL = errors.New("the database connection URL is invalid")
 	ErrDBConnectionFailed   = errors.New("the compliance events database could not be connected to")
+	ErrInvalidDBSchema      = errors.New("the compliance events database schema is invalid")
 	migrationsSource        source.Driver
 	gvkSecret               = schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
 	ErrRetryable            = errors.New("")
@@ -78,9 +78,66 @@ type ComplianceServerCtx struct {
 	// Required to run a migration after the database connection changed or the feature was enabled.
 	connectionURL string
 	// These caches get reset after a database migration due to a connection drop and reconnect.
-	ParentPolicyToID sync.Map
-	PolicyToID       sync.Map
+	ParentPolicyToID *KeyCache
+	PolicyToID       *KeyCache
 	ClusterID        string
+	// dbPoolOptions are applied to every DB connection pool that is opened.
+	dbPoolOptions DBPoolOptions
+	// migrationsDisabled is set when the database schema is managed externally, so MigrateDB only verifies the schema.
+	migrationsDisabled bool
+	// readDB is the optional connection pool to a read replica that read-only queries use instead of DB.
+	readDB *sql.DB
+	// readConnectionURL is the connection URL of readDB, including the added connect_timeout.
+	readConnectionURL string
+	// preparedStmtsDisabled is set when the database doesn't support prepared statements that outlive a transaction,
+	// such as behind PgBouncer in transaction pooling mode.
+	preparedStmtsDisabled bool
+	// stmtCacheLock protects stmtCache since it's replaced while the requests only hold the read lock of Lock.
+	stmtCacheLock sync.Mutex
+	// stmtCache holds the prepared statements of DB. It's replaced when DB is.
+	stmtCache *stmtCache
+}
+
+const (
+	DefaultDBMaxOpenConns    = 20
+	DefaultDBMaxIdleConns    = 5
+	DefaultDBConnMaxLifetime = 30 * time.Minute
+)
+
+// DBPoolOptions configure the database connection pool. They should be tuned to the size of the Postgres server.
+type DBPoolOptions struct {
+	// MaxOpenConns is the maximum number of connections to Postgres, both in use and idle. Requests wait for a free
+	// connection once it's reached, so too low a value slows the API under load, and too high a value can exhaust
+	// the max_connections of Postgres. A value of 0 or less means no limit.
+	MaxOpenConns int
+	// MaxIdleConns is the maximum number of unused connections kept open for reuse. Higher values avoid the cost of
+	// new connections during bursts at the expense of holding connections on the Postgres server. A value of 0 or
+	// less means idle connections are closed.
+	MaxIdleConns int
+	// ConnMaxLifetime is how long a connection is reused before it is closed and replaced. This spreads connections
+	// across Postgres replicas behind a load balancer after a failover. A value of 0 or less means connections are
+	// reused forever.
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultDBPoolOptions returns the default database connection pool options.
+func DefaultDBPoolOptions() DBPoolOptions {
+	return DBPoolOptions{
+		MaxOpenConns:    DefaultDBMaxOpenConns,
+		MaxIdleConns:    DefaultDBMaxIdleConns,
+		ConnMaxLifetime: DefaultDBConnMaxLifetime,
+	}
+}
+
+// apply sets the connection pool options on the input database. If db is nil, this is a no-op.
+func (o DBPoolOptions) apply(db *sql.DB) {
+	if db == nil {
+		return
+	}
+
+	db.SetMaxOpenConns(o.MaxOpenConns)
+	db.SetMaxIdleConns(o.MaxIdleConns)
+	db.SetConnMaxLifetime(o.ConnMaxLifetime)
 }
 
 // NewComplianceServerCtx returns a ComplianceServerCtx with initialized values. It does not start a connection
@@ -100,17 +157,140 @@ func NewComplianceServerCtx(dbConnectionURL string, clusterID string) (*Complian
 		if openErr != nil {
 			err = fmt.Errorf("%w: %w", ErrInvalidConnectionURL, err)
 		}
+
+		DefaultDBPoolOptions().apply(db)
 	}
 
 	return &ComplianceServerCtx{
-		Lock:          sync.RWMutex{},
-		Queue:         workqueue.New(),
-		connectionURL: dbConnectionURL,
-		DB:            db,
-		ClusterID:     clusterID,
+		Lock:             sync.RWMutex{},
+		Queue:            workqueue.New(),
+		connectionURL:    dbConnectionURL,
+		DB:               db,
+		ParentPolicyToID: NewKeyCache(DefaultKeyCacheCapacity, DefaultKeyCacheTTL),
+		PolicyToID:       NewKeyCache(DefaultKeyCacheCapacity, DefaultKeyCacheTTL),
+		ClusterID:        clusterID,
+		dbPoolOptions:    DefaultDBPoolOptions(),
 	}, err
 }
 
+// ConfigureDBPool sets the connection pool options of the current database connection and of any database connection
+// opened later, such as when the connection secret changes.
+func (c *ComplianceServerCtx) ConfigureDBPool(options DBPoolOptions) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+
+	c.dbPoolOptions = options
+	c.dbPoolOptions.apply(c.DB)
+	c.dbPoolOptions.apply(c.readDB)
+}
+
+// ConfigureReadReplica opens a connection pool to a read replica of the database that the read-only compliance events
+// API endpoints use. Writes, including getting or creating the foreign keys of a compliance event, always use the
+// primary DB. A connect_timeout of 5 seconds is added to the connection URL if it doesn't set one. An empty connection
+// URL removes the read replica. ErrInvalidConnectionURL is returned if the connection URL can't be parsed.
+func (c *ComplianceServerCtx) ConfigureReadReplica(connectionURL string) error {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+
+	var db *sql.DB
+
+	if connectionURL != "" {
+		parsedURL, err := url.Parse(connectionURL)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConnectionURL, err)
+		}
+
+		if !parsedURL.Query().Has("connect_timeout") {
+			query := parsedURL.Query()
+			query.Set("connect_timeout", "5")
+			parsedURL.RawQuery = query.Encode()
+		}
+
+		connectionURL = parsedURL.String()
+
+		db, err = sql.Open("postgres", connectionURL)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConnectionURL, err)
+		}
+
+		c.dbPoolOptions.apply(db)
+	}
+
+	if c.readDB != nil {
+		if err := c.readDB.Close(); err != nil {
+			log.Error(err, "Failed to close the previous read replica database connection")
+		}
+	}
+
+	c.readDB = db
+	c.readConnectionURL = connectionURL
+
+	return nil
+}
+
+// ReadDB returns the connection pool for read-only queries. This is the read replica if one is configured and DB
+// otherwise. Since a read replica may lag behind the primary, a compliance event that was just recorded may not be
+// returned yet. Obtain a read lock before calling this method.
+func (c *ComplianceServerCtx) ReadDB() *sql.DB {
+	if c.readDB != nil {
+		return c.readDB
+	}
+
+	return c.DB
+}
+
+// DisableMigrations stops MigrateDB from applying the embedded schema migrations. This is for environments where the
+// database schema is managed externally. MigrateDB still verifies that the schema has the required tables and columns.
+func (c *ComplianceServerCtx) DisableMigrations() {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+
+	c.migrationsDisabled = true
+}
+
+// DisablePreparedStatements stops the queries that record compliance events from using cached prepared statements. This
+// is for connection poolers that don't support them, such as PgBouncer in transaction pooling mode.
+func (c *ComplianceServerCtx) DisablePreparedStatements() {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+
+	c.preparedStmtsDisabled = true
+}
+
+// preparedTx returns a dbQuerier that runs the queries of the transaction, which must be from DB, with the cached
+// prepared statements of DB. If prepared statements are disabled, the transaction runs the queries directly. The caller
+// must hold the lock.
+func (c *ComplianceServerCtx) preparedTx(tx *sql.Tx) dbQuerier {
+	if c.preparedStmtsDisabled {
+		return tx
+	}
+
+	c.stmtCacheLock.Lock()
+	defer c.stmtCacheLock.Unlock()
+
+	// The statements of a previous connection pool can't be used with a transaction from DB.
+	if c.stmtCache == nil || c.stmtCache.db != c.DB {
+		if c.stmtCache != nil {
+			c.stmtCache.close()
+		}
+
+		c.stmtCache = newStmtCache(c.DB)
+	}
+
+	return stmtTx{tx: tx, cache: c.stmtCache}
+}
+
+// ConfigureKeyCaches replaces the database ID caches with empty caches that hold at most capacity entries, each
+// valid for ttl. This should be called before the compliance events API is started.
+func (c *ComplianceServerCtx) ConfigureKeyCaches(capacity int, ttl time.Duration) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+
+	c.ParentPolicyToID = NewKeyCache(capacity, ttl)
+	c.PolicyToID = NewKeyCache(capacity, ttl)
+	clusterKeyCache = NewKeyCache(capacity, ttl)
+}
+
 // ComplianceDBSecretReconciler is responsible for managing the compliance events history database migrations and
 // keeping the shared database connection up to date.
 type ComplianceDBSecretReconciler struct {
@@ -186,9 +366,9 @@ func (r *ComplianceDBSecretReconciler) Reconcile(
 		r.ComplianceServerCtx.connectionURL = r.ConnectionURL
 
 		// Clear the database ID caches in case this is a new database or the database was restored
-		r.ComplianceServerCtx.ParentPolicyToID = sync.Map{}
-		r.ComplianceServerCtx.PolicyToID = sync.Map{}
-		clusterKeyCache = sync.Map{}
+		r.ComplianceServerCtx.ParentPolicyToID.Clear()
+		r.ComplianceServerCtx.PolicyToID.Clear()
+		clusterKeyCache.Clear()
 
 		if parsedConnectionURL == "" {
 			r.ComplianceServerCtx.DB = nil
@@ -203,6 +383,8 @@ func (r *ComplianceDBSecretReconciler) Reconcile(
 				)
 			}
 
+			r.ComplianceServerCtx.dbPoolOptions.apply(db)
+
 			// This may be nil and that is intentional.
 			r.ComplianceServerCtx.DB = db
 			// Once the connection URL changes, a migration is required in the event this is a new database or the
@@ -374,18 +556,13 @@ func RecordLocalClusterComplianceEvent(
 		// If it's a unique constraint violation, then the event is a duplicate and can be ignored. If it's a foreign
 		// key violation, that means the database experienced data loss and the foreign key is invalid, so the
 		// compliance event can't be recorded.
-		var pqErr *pq.Error
-
-		if errors.As(err, &pqErr) {
-			if pqErr.Code == postgresUniqueViolationCode {
-				return nil
-			}
-
-			if pqErr.Code == postgresForeignKeyViolationCode {
-				return fmt.Errorf(
-					"failed to record the compliance event because the foreign keys no longer apply: %w", err,
-				)
-			}
+		switch getSQLState(err) {
+		case postgresUniqueViolationCode:
+			return nil
+		case postgresForeignKeyViolationCode:
+			return fmt.Errorf(
+				"failed to record the compliance event because the foreign keys no longer apply: %w", err,
+			)
 		}
 
 		// If the error was because the database was down, then queue it up for later
@@ -399,9 +576,10 @@ func RecordLocalClusterComplianceEvent(
 	return nil
 }
 
-// MigrateDB will perform a database migration if required and send Kubernetes events if the migration fails.
-// ErrDBConnectionFailed will be returned if the database connection failed. Obtain a write lock before calling
-// this method if multiple goroutines use this ComplianceServerCtx instance.
+// MigrateDB will perform a database migration if required, verify the resulting schema, and send Kubernetes events if
+// the migration fails. ErrDBConnectionFailed will be returned if the database connection failed and
+// ErrInvalidDBSchema will be returned if the schema is missing required tables or columns. Obtain a write lock before
+// calling this method if multiple goroutines use this ComplianceServerCtx instance.
 func (c *ComplianceServerCtx) MigrateDB(
 	ctx context.Context, client *kubernetes.Clientset, controllerNamespace string,
 ) error {
@@ -411,6 +589,36 @@ func (c *ComplianceServerCtx) MigrateDB(
 		return fmt.Errorf("%w: the connection URL is not set", ErrDBConnectionFailed)
 	}
 
+	if c.migrationsDisabled {
+		log.V(2).Info("Skipping the database migration since migrations are disabled")
+	} else if err := c.applyMigrations(ctx, client, controllerNamespace); err != nil {
+		return err
+	}
+
+	if err := c.verifySchema(ctx); err != nil {
+		if errors.Is(err, ErrInvalidDBSchema) {
+			msg := "The compliance events database schema is missing required tables or columns. The compliance " +
+				"events endpoint will not start until this is resolved."
+
+			log.Error(err, msg)
+
+			_ = sendDBErrorEvent(ctx, client, controllerNamespace, msg)
+		} else {
+			log.Info("Failed to verify the database schema: " + err.Error())
+		}
+
+		return err
+	}
+
+	c.needsMigration = false
+
+	return nil
+}
+
+// applyMigrations applies the embedded database migrations that haven't been applied yet.
+func (c *ComplianceServerCtx) applyMigrations(
+	ctx context.Context, client *kubernetes.Clientset, controllerNamespace string,
+) error {
 	m, err := migrate.NewWithSourceInstance("iofs", migrationsSource, c.connectionURL)
 	if err != nil {
 		msg := "Failed to initialize the database migration client"
@@ -441,8 +649,8 @@ func (c *ComplianceServerCtx) MigrateDB(
 		version, _, _ := m.Version()
 		// The cache gets reset after a migration in case the database changed. If the database
 		// was restored to an older backup, then the propagator needs to restart to clear the cache.
-		c.ParentPolicyToID = sync.Map{}
-		c.PolicyToID = sync.Map{}
+		c.ParentPolicyToID.Clear()
+		c.PolicyToID.Clear()
 
 		msg := fmt.Sprintf("The compliance events database schema was successfully updated to version %d", version)
 		log.Info(msg)
@@ -450,13 +658,13 @@ func (c *ComplianceServerCtx) MigrateDB(
 		_ = sendDBEvent(ctx, client, controllerNamespace, "Normal", "OCMComplianceEventsDB", msg)
 	}
 
-	c.needsMigration = false
-
 	return nil
 }
 
-// ParseDBSecret will parse the input database secret and return a connection URL. If the secret contains invalid
-// connection information, then ErrInvalidDBSecret is returned.
+// ParseDBSecret will parse the input database secret and return a connection URL. If the secret has a schema value,
+// such as when the tables aren't in the public schema, it's set as the search_path of the connection unless the
+// connectionURL value already sets it. If the secret contains invalid connection information, then ErrInvalidDBSecret
+// is returned.
 func ParseDBSecret(dbSecret *corev1.Secret, tempDirPath string) (string, error) {
 	var connectionURL *url.URL
 	var err error
@@ -529,6 +737,21 @@ func ParseDBSecret(dbSecret *corev1.Secret, tempDirPath string) (string, error)
 		connectionURL.RawQuery += "connect_timeout=5"
 	}
 
+	// The search_path is sent by the database driver when each connection is opened, so every query, including the
+	// migrations, resolves the unqualified table names to the schema without changing the queries.
+	if dbSecret.Data["schema"] != nil && !strings.Contains(connectionURL.RawQuery, "search_path=") {
+		schema := strings.TrimSpace(string(dbSecret.Data["schema"]))
+		if schema == "" {
+			return "", fmt.Errorf("%w: the schema value must not be empty", ErrInvalidDBSecret)
+		}
+
+		if connectionURL.RawQuery != "" {
+			connectionURL.RawQuery += "&"
+		}
+
+		connectionURL.RawQuery += "search_path=" + url.QueryEscape(schema)
+	}
+
 	if dbSecret.Data["ca"] != nil {
 		caPath := path.Join(tempDirPath, "db-ca.crt")
 
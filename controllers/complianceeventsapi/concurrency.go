@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+)
+
+// concurrencyLimitHandler rejects requests with a 503 status code and a Retry-After header when limit requests are
+// already being handled, rather than letting every request wait on a database connection. Unlike rateLimitHandler,
+// this is a ceiling across all clients. A limit less than or equal to 0 disables this. The health endpoints and the
+// long lived compliance events stream don't count against the limit.
+func concurrencyLimitHandler(limit int, next http.Handler) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+
+	slots := make(chan struct{}, limit)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz", "/livez", "/readyz", "/api/v1/compliance-events/stream":
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			writeErrMsgJSON(w, "Too many concurrent requests", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		concurrencyLimitInUseMetric.Inc()
+
+		defer func() {
+			concurrencyLimitInUseMetric.Dec()
+			<-slots
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestConcurrencyLimitHandler(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	handler := concurrencyLimitHandler(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/compliance-events" && r.Method == http.MethodPost {
+			started <- struct{}{}
+			<-release
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(method string, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+
+		return recorder
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- send(http.MethodPost, "/api/v1/compliance-events")
+	}()
+
+	<-started
+
+	// The only slot is taken by the POST request.
+	resp := send(http.MethodGet, "/api/v1/compliance-events")
+	g.Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+	g.Expect(resp.Header().Get("Retry-After")).To(Equal("1"))
+	g.Expect(resp.Body.String()).To(ContainSubstring("Too many concurrent requests"))
+
+	// The health endpoints and the compliance events stream aren't limited.
+	g.Expect(send(http.MethodGet, "/readyz").Code).To(Equal(http.StatusOK))
+	g.Expect(send(http.MethodGet, "/api/v1/compliance-events/stream").Code).To(Equal(http.StatusOK))
+
+	close(release)
+	g.Expect((<-done).Code).To(Equal(http.StatusOK))
+
+	// The slot is released once the request is handled.
+	g.Expect(send(http.MethodGet, "/api/v1/compliance-events").Code).To(Equal(http.StatusOK))
+}
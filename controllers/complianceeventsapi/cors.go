@@ -0,0 +1,78 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+var (
+	corsAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+	corsAllowedHeaders = []string{
+		"Authorization", "Content-Type", "If-None-Match", "Prefer", idempotencyKeyHeader, requestIDHeader,
+	}
+	corsExposedHeaders = []string{
+		"Content-Disposition", "ETag", "Location", "Preference-Applied", "Retry-After", "X-Dry-Run", requestIDHeader,
+	}
+)
+
+// corsHandler sets the CORS headers on responses to requests from the allowed origins and answers CORS preflight
+// requests. Preflight requests from other origins get a 403 response and other requests from them don't get any CORS
+// headers, so the browser blocks them. If allowedOrigins contains "*", every origin is allowed and the
+// Access-Control-Allow-Origin header is "*" rather than the origin of the request. If allowedOrigins is empty, CORS
+// isn't enabled and next is returned.
+func corsHandler(allowedOrigins []string, next http.Handler) http.Handler {
+	if len(allowedOrigins) == 0 {
+		return next
+	}
+
+	anyOrigin := slices.Contains(allowedOrigins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		isPreflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allowed := anyOrigin || slices.Contains(allowedOrigins, origin)
+
+		if !allowed {
+			if isPreflight {
+				w.Header().Set("Content-Type", "application/json")
+				writeErrMsgJSON(w, "The origin is not allowed", http.StatusForbidden)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if isPreflight {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCORSHandler(t *testing.T) {
+	t.Parallel()
+
+	dashboard := []string{"https://dashboard.example.com"}
+
+	tests := []struct {
+		name           string
+		allowedOrigins []string
+		method         string
+		origin         string
+		preflight      bool
+		expectedCode   int
+		expectedAllow  string
+	}{
+		{"allowed preflight", dashboard, http.MethodOptions, "https://dashboard.example.com", true,
+			http.StatusNoContent, "https://dashboard.example.com"},
+		{"disallowed preflight", dashboard, http.MethodOptions, "https://evil.example.com", true,
+			http.StatusForbidden, ""},
+		{"allowed request", dashboard, http.MethodGet, "https://dashboard.example.com", false, http.StatusOK,
+			"https://dashboard.example.com"},
+		{"disallowed request", dashboard, http.MethodGet, "https://evil.example.com", false, http.StatusOK, ""},
+		{"no origin", dashboard, http.MethodGet, "", false, http.StatusOK, ""},
+		{"any origin preflight", []string{"*"}, http.MethodOptions, "https://other.example.com", true,
+			http.StatusNoContent, "*"},
+		{"any origin request", []string{"*"}, http.MethodGet, "https://other.example.com", false, http.StatusOK, "*"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			handler := corsHandler(
+				test.allowedOrigins,
+				http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}),
+			)
+
+			req := httptest.NewRequest(test.method, "/api/v1/compliance-events", nil)
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+
+			if test.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			g.Expect(recorder.Code).To(Equal(test.expectedCode))
+			g.Expect(recorder.Header().Get("Access-Control-Allow-Origin")).To(Equal(test.expectedAllow))
+		})
+	}
+}
+
+func TestCORSHandlerHeaders(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	handler := corsHandler(
+		[]string{"https://dashboard.example.com"},
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/compliance-events", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	allowedHeaders := strings.Split(recorder.Header().Get("Access-Control-Allow-Headers"), ", ")
+	g.Expect(allowedHeaders).To(ContainElements("Authorization", "Prefer", idempotencyKeyHeader))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/compliance-events", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	exposedHeaders := strings.Split(recorder.Header().Get("Access-Control-Expose-Headers"), ", ")
+	g.Expect(exposedHeaders).To(ContainElements("ETag", "Location", "Preference-Applied", "Retry-After", "X-Dry-Run"))
+}
@@ -0,0 +1,76 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventCursor is the position of the last compliance event returned by a page when using cursor based pagination.
+// Since compliance events can share a timestamp, the database ID is used as a tie breaker.
+type eventCursor struct {
+	Timestamp time.Time
+	ID        int32
+}
+
+// String returns the opaque value of the cursor query argument.
+func (c eventCursor) String() string {
+	raw := c.Timestamp.UTC().Format(time.RFC3339Nano) + "," + strconv.FormatInt(int64(c.ID), 10)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseEventCursor parses a cursor returned by eventCursor.String. An ErrInvalidQueryArgValue error is returned if the
+// cursor is malformed.
+func parseEventCursor(value string) (*eventCursor, error) {
+	errInvalidCursor := fmt.Errorf("%w: cursor must be a value returned in metadata.next_cursor", ErrInvalidQueryArgValue)
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	timestampStr, idStr, found := strings.Cut(string(raw), ",")
+	if !found {
+		return nil, errInvalidCursor
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, timestampStr)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 32)
+	if err != nil || id <= 0 {
+		return nil, errInvalidCursor
+	}
+
+	return &eventCursor{Timestamp: timestamp, ID: int32(id)}, nil
+}
+
+// addCursorFilter adds the keyset condition to the input where clause so that only compliance events after the cursor
+// in the requested direction are returned. The returned filter values include the cursor values.
+func addCursorFilter(whereClause string, filterValues []any, cursor *eventCursor, direction string) (string, []any) {
+	operator := "<"
+	if strings.EqualFold(direction, "asc") {
+		operator = ">"
+	}
+
+	filterValues = append(filterValues, cursor.Timestamp, cursor.ID)
+
+	// For example: (compliance_events.timestamp, compliance_events.id) < ($3, $4)
+	cursorSQL := fmt.Sprintf(
+		"(compliance_events.timestamp, compliance_events.id) %s ($%d, $%d)",
+		operator, len(filterValues)-1, len(filterValues),
+	)
+
+	if whereClause == "" {
+		return "\nWHERE " + cursorSQL, filterValues
+	}
+
+	return whereClause + " AND " + cursorSQL, filterValues
+}
@@ -0,0 +1,69 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEventCursorRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	timestamp := time.Date(2023, 4, 4, 4, 4, 4, 444123000, time.FixedZone("EDT", -4*60*60))
+	cursor := eventCursor{Timestamp: timestamp, ID: 42}
+
+	parsed, err := parseEventCursor(cursor.String())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(parsed.Timestamp.Equal(timestamp)).To(BeTrue())
+	g.Expect(parsed.ID).To(Equal(int32(42)))
+}
+
+func TestParseEventCursorInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"not base64":        "not base64!",
+		"no separator":      base64.RawURLEncoding.EncodeToString([]byte("2023-04-04T04:04:04Z")),
+		"invalid timestamp": base64.RawURLEncoding.EncodeToString([]byte("yesterday,1")),
+		"invalid ID":        base64.RawURLEncoding.EncodeToString([]byte("2023-04-04T04:04:04Z,abc")),
+		"zero ID":           base64.RawURLEncoding.EncodeToString([]byte("2023-04-04T04:04:04Z,0")),
+	}
+
+	for name, value := range tests {
+		value := value
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			_, err := parseEventCursor(value)
+			g.Expect(errors.Is(err, ErrInvalidQueryArgValue)).To(BeTrue())
+		})
+	}
+}
+
+func TestAddCursorFilter(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	cursor := &eventCursor{Timestamp: time.Date(2023, 4, 4, 4, 4, 4, 0, time.UTC), ID: 7}
+
+	whereClause, values := addCursorFilter("", []any{}, cursor, "desc")
+	g.Expect(whereClause).To(Equal("\nWHERE (compliance_events.timestamp, compliance_events.id) < ($1, $2)"))
+	g.Expect(values).To(Equal([]any{cursor.Timestamp, int32(7)}))
+
+	whereClause, values = addCursorFilter("\nWHERE (policies.name=$1)", []any{"policy"}, cursor, "ASC")
+	g.Expect(whereClause).To(Equal(
+		"\nWHERE (policies.name=$1) AND (compliance_events.timestamp, compliance_events.id) > ($2, $3)",
+	))
+	g.Expect(values).To(Equal([]any{"policy", cursor.Timestamp, int32(7)}))
+}
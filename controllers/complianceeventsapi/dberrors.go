@@ -0,0 +1,31 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// sqlStateError is implemented by the errors of Postgres drivers other than lib/pq, such as *pgconn.PgError from pgx.
+type sqlStateError interface {
+	SQLState() string
+}
+
+// getSQLState returns the Postgres SQLSTATE error code of the error, such as "23505" for a unique violation, or an
+// empty string if the error didn't come from Postgres. This supports the lib/pq driver and any driver whose errors
+// implement a SQLState method, so the error handling doesn't depend on the configured database driver.
+func getSQLState(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+
+	var stateErr sqlStateError
+	if errors.As(err, &stateErr) {
+		return stateErr.SQLState()
+	}
+
+	return ""
+}
@@ -0,0 +1,51 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	. "github.com/onsi/gomega"
+)
+
+type fakeSQLStateError struct {
+	code string
+}
+
+func (e *fakeSQLStateError) Error() string {
+	return "fake database error"
+}
+
+func (e *fakeSQLStateError) SQLState() string {
+	return e.code
+}
+
+func TestGetSQLState(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"lib/pq", &pq.Error{Code: postgresUniqueViolationCode}, postgresUniqueViolationCode},
+		{"wrapped lib/pq", fmt.Errorf("wrapped: %w", &pq.Error{Code: "08006"}), "08006"},
+		{"other driver", &fakeSQLStateError{code: postgresCheckViolationCode}, postgresCheckViolationCode},
+		{"not from Postgres", errors.New("some error"), ""},
+		{"no error", nil, ""},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+			g.Expect(getSQLState(test.err)).To(Equal(test.expected))
+		})
+	}
+}
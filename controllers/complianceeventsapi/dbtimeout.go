@@ -0,0 +1,65 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// DefaultDBQueryTimeout is the default maximum duration of the database queries of a request. It's shorter than
+// DefaultWriteTimeout so that the client gets a response before the connection is closed.
+const DefaultDBQueryTimeout = 10 * time.Second
+
+// withDBTimeout returns a handler that cancels the request context after timeout so that the database queries of next,
+// which use the request context, don't hold a database connection indefinitely when Postgres is overloaded. If next
+// responds with a 500 status code because the deadline was exceeded, the response is replaced with a 504 response. A
+// timeout less than or equal to 0 returns next. This must not wrap handlers that stream their responses.
+func withDBTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next(&dbTimeoutResponseWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+	}
+}
+
+// dbTimeoutResponseWriter wraps an http.ResponseWriter to replace a 500 response with a 504 response when the deadline
+// of ctx was exceeded.
+type dbTimeoutResponseWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+}
+
+func (d *dbTimeoutResponseWriter) WriteHeader(code int) {
+	if code == http.StatusInternalServerError && errors.Is(d.ctx.Err(), context.DeadlineExceeded) {
+		d.timedOut = true
+
+		writeErrMsgJSON(d.ResponseWriter, "The database did not respond in time", http.StatusGatewayTimeout)
+
+		return
+	}
+
+	d.ResponseWriter.WriteHeader(code)
+}
+
+// Write discards the body of the replaced 500 response.
+func (d *dbTimeoutResponseWriter) Write(p []byte) (int, error) {
+	if d.timedOut {
+		return len(p), nil
+	}
+
+	return d.ResponseWriter.Write(p)
+}
+
+// Unwrap allows http.ResponseController to access the underlying http.ResponseWriter.
+func (d *dbTimeoutResponseWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
@@ -0,0 +1,80 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWithDBTimeout(t *testing.T) {
+	t.Parallel()
+
+	slowHandler := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+	}
+
+	tests := []struct {
+		name            string
+		timeout         time.Duration
+		handler         http.HandlerFunc
+		expectedCode    int
+		expectedMessage string
+	}{
+		{
+			"timed out",
+			time.Millisecond,
+			slowHandler,
+			http.StatusGatewayTimeout,
+			"The database did not respond in time",
+		},
+		{
+			"internal error before the deadline",
+			time.Minute,
+			func(w http.ResponseWriter, _ *http.Request) {
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+			},
+			http.StatusInternalServerError,
+			"Internal Error",
+		},
+		{
+			"client error after the deadline",
+			time.Millisecond,
+			func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+
+				writeErrMsgJSON(w, "Forbidden", http.StatusForbidden)
+			},
+			http.StatusForbidden,
+			"Forbidden",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			recorder := httptest.NewRecorder()
+			withDBTimeout(test.timeout, test.handler)(
+				recorder, httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events/1", nil),
+			)
+
+			g.Expect(recorder.Code).To(Equal(test.expectedCode))
+
+			msg := errorMessage{}
+			g.Expect(json.Unmarshal(recorder.Body.Bytes(), &msg)).To(Succeed())
+			g.Expect(msg.Message).To(Equal(test.expectedMessage))
+		})
+	}
+}
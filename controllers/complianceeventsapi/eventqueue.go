@@ -0,0 +1,275 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// DefaultEventQueueWorkers is the default number of workers that record the compliance events in the event queue.
+	DefaultEventQueueWorkers = 1
+	// maxEventQueueRetryDelay caps the delay between attempts to record a queued compliance event during a database
+	// outage.
+	maxEventQueueRetryDelay = 30 * time.Second
+)
+
+var errDBUnavailable = errors.New("the database is unavailable")
+
+// queuedEvent is a compliance event that was accepted but not yet recorded, along with the request details needed to
+// log and audit it after the request finished.
+type queuedEvent struct {
+	event     *ComplianceEvent
+	requestID string
+	user      string
+}
+
+// eventQueue is a bounded in-process queue of compliance events that are recorded in the database by background
+// workers. This lets compliance events be accepted during short database outages, such as maintenance windows.
+type eventQueue struct {
+	// lock protects closed so that a compliance event is never sent on the closed events channel.
+	lock    sync.RWMutex
+	closed  bool
+	events  chan *queuedEvent
+	workers sync.WaitGroup
+	// cancel stops the workers from retrying when the queue isn't flushed in time.
+	cancel context.CancelFunc
+}
+
+// startEventQueue starts the EventQueueWorkers option of workers that record the compliance events sent to the
+// returned queue. The workers run until the queue is flushed.
+func (s *ComplianceAPIServer) startEventQueue(serverContext *ComplianceServerCtx) *eventQueue {
+	// The workers aren't stopped by the server's context since the queue is flushed after it's closed.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	queue := &eventQueue{
+		events: make(chan *queuedEvent, s.options.EventQueueSize),
+		cancel: cancel,
+	}
+
+	log.Info(
+		"Starting the compliance event queue",
+		"size", s.options.EventQueueSize,
+		"workers", s.options.EventQueueWorkers,
+	)
+
+	for i := 0; i < s.options.EventQueueWorkers; i++ {
+		queue.workers.Add(1)
+
+		go func() {
+			defer queue.workers.Done()
+
+			for queued := range queue.events {
+				eventQueueDepthMetric.Dec()
+
+				s.recordQueuedEvent(ctx, serverContext, queued)
+			}
+		}()
+	}
+
+	return queue
+}
+
+// enqueue adds the compliance event to the queue without blocking. False is returned if the queue is full or flushed.
+func (q *eventQueue) enqueue(queued *queuedEvent) bool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	if q.closed {
+		return false
+	}
+
+	select {
+	case q.events <- queued:
+		eventQueueDepthMetric.Inc()
+
+		return true
+	default:
+		return false
+	}
+}
+
+// flush stops accepting compliance events and waits for the workers to record the ones in the queue. If that takes
+// longer than timeout, the remaining compliance events are dropped.
+func (q *eventQueue) flush(timeout time.Duration) {
+	if q == nil {
+		return
+	}
+
+	q.lock.Lock()
+	q.closed = true
+	close(q.events)
+	q.lock.Unlock()
+
+	log.Info("Flushing the compliance event queue", "queued", len(q.events))
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		q.workers.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Info(
+			"Timed out flushing the compliance event queue. Dropping the remaining compliance events.",
+			"timeout", timeout.String(),
+		)
+
+		q.cancel()
+		<-done
+	}
+
+	q.cancel()
+}
+
+// enqueueComplianceEvent adds the validated and authorized compliance event to the event queue, completes the
+// reservation of the Idempotency-Key header, and writes a 202 response. False is returned without writing a response
+// if the queue is full.
+func (s *ComplianceAPIServer) enqueueComplianceEvent(
+	w http.ResponseWriter, r *http.Request, reqEvent *ComplianceEvent, reservation *idempotencyReservation,
+) bool {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	minimal := prefersMinimalReturn(r)
+
+	var resp []byte
+
+	// The response is marshaled before the compliance event is queued since a worker may modify it. Its ID is 0
+	// since the compliance event isn't recorded yet.
+	if !minimal {
+		respEvent := *reqEvent
+		respEvent.Policy.Spec = nil
+
+		var err error
+
+		resp, err = json.Marshal(respEvent)
+		if err != nil {
+			reqLog.Error(err, "error marshaling reqEvent for the response")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return true
+		}
+	}
+
+	queued := &queuedEvent{
+		event:     reqEvent,
+		requestID: w.Header().Get(requestIDHeader),
+		user:      getTokenUsername(parseToken(r)),
+	}
+
+	if !s.eventQueue.enqueue(queued) {
+		reqLog.Info("The compliance event queue is full")
+
+		return false
+	}
+
+	// The compliance event isn't recorded yet, so there's no ID to replay.
+	reservation.complete(1, nil)
+
+	if minimal {
+		writeMinimalReturn(w, http.StatusAccepted)
+
+		return true
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	if _, err := w.Write(resp); err != nil {
+		reqLog.Error(err, "error writing success response")
+	}
+
+	return true
+}
+
+// recordQueuedEvent records a compliance event from the event queue. Transient database errors, such as when the
+// database is down, are retried until ctx is closed. Other errors drop the compliance event since retrying won't
+// change the result.
+func (s *ComplianceAPIServer) recordQueuedEvent(
+	ctx context.Context, serverContext *ComplianceServerCtx, queued *queuedEvent,
+) {
+	ctx = ctrl.LoggerInto(ctx, log.WithValues("requestID", queued.requestID))
+	reqLog := ctrl.LoggerFrom(ctx)
+	delay := s.options.DBRetryBaseDelay
+
+	for {
+		deduplicated, err := s.insertQueuedEvent(ctx, serverContext, queued.event)
+		if err == nil {
+			if !deduplicated {
+				eventsCreatedMetric.Inc()
+				s.auditLog.record(queued.user, queued.requestID, queued.event)
+				s.eventStream.publish(queued.event)
+				s.webhook.notify(queued.event)
+			}
+
+			return
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		if !errors.Is(err, errDBUnavailable) && !isTransientDBError(err) {
+			eventQueueDroppedMetric.Inc()
+			reqLog.Error(err, "Dropping a queued compliance event that can't be recorded", getPqErrKeyVals(err)...)
+
+			return
+		}
+
+		reqLog.V(2).Info(
+			"Retrying a queued compliance event after a database error", "delay", delay.String(), "error", err.Error(),
+		)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		delay = min(delay*2, maxEventQueueRetryDelay)
+	}
+
+	eventQueueDroppedMetric.Inc()
+	reqLog.Info("Dropping a queued compliance event since the event queue wasn't flushed in time")
+}
+
+// insertQueuedEvent makes a single attempt at recording a compliance event from the event queue. The read lock is only
+// held per attempt so that the database connection can be replaced between attempts.
+func (s *ComplianceAPIServer) insertQueuedEvent(
+	ctx context.Context, serverContext *ComplianceServerCtx, event *ComplianceEvent,
+) (bool, error) {
+	serverContext.Lock.RLock()
+	defer serverContext.Lock.RUnlock()
+
+	if serverContext.DB == nil {
+		return false, errDBUnavailable
+	}
+
+	deduplicated, err := s.insertComplianceEvent(ctx, serverContext, event, false)
+	if err != nil {
+		// The caches may be out of date if the foreign key violation persisted after retryStaleForeignKeys. The error
+		// itself is logged by the caller.
+		if isForeignKeyViolation(err) {
+			handleInsertErr(ctx, serverContext, err)
+		}
+
+		return false, err
+	}
+
+	cacheForeignKeys(serverContext, event)
+
+	return deduplicated, nil
+}
@@ -0,0 +1,179 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+)
+
+func TestEventQueueEnqueue(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	_, cancel := context.WithCancel(context.Background())
+	queue := &eventQueue{events: make(chan *queuedEvent, 1), cancel: cancel}
+
+	g.Expect(queue.enqueue(&queuedEvent{requestID: "first"})).To(BeTrue())
+	// The queue is full, so this must not block
+	g.Expect(queue.enqueue(&queuedEvent{requestID: "second"})).To(BeFalse())
+
+	queued := <-queue.events
+	g.Expect(queued.requestID).To(Equal("first"))
+
+	g.Expect(queue.enqueue(&queuedEvent{requestID: "third"})).To(BeTrue())
+}
+
+func TestEventQueueFlush(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := &eventQueue{events: make(chan *queuedEvent, 2), cancel: cancel}
+
+	recorded := []string{}
+
+	queue.workers.Add(1)
+
+	go func() {
+		defer queue.workers.Done()
+
+		for queued := range queue.events {
+			recorded = append(recorded, queued.requestID)
+		}
+	}()
+
+	g.Expect(queue.enqueue(&queuedEvent{requestID: "first"})).To(BeTrue())
+	g.Expect(queue.enqueue(&queuedEvent{requestID: "second"})).To(BeTrue())
+
+	queue.flush(time.Minute)
+
+	g.Expect(recorded).To(Equal([]string{"first", "second"}))
+	g.Expect(ctx.Err()).To(HaveOccurred())
+
+	// A flushed queue doesn't accept compliance events and must not panic from sending on the closed channel
+	g.Expect(queue.enqueue(&queuedEvent{requestID: "third"})).To(BeFalse())
+}
+
+func TestEventQueueFlushTimeout(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := &eventQueue{events: make(chan *queuedEvent, 1), cancel: cancel}
+
+	queue.workers.Add(1)
+
+	// This simulates a worker retrying during a database outage until the flush times out
+	go func() {
+		defer queue.workers.Done()
+
+		<-ctx.Done()
+	}()
+
+	queue.flush(10 * time.Millisecond)
+
+	g.Expect(ctx.Err()).To(HaveOccurred())
+}
+
+func TestEventQueueFlushNil(t *testing.T) {
+	t.Parallel()
+
+	var queue *eventQueue
+
+	queue.flush(time.Second)
+}
+
+func TestPostComplianceEventQueueNoDB(t *testing.T) {
+	t.Parallel()
+
+	// The Kubernetes API allows recording every compliance event.
+	kubeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"SelfSubjectAccessReview","apiVersion":"authorization.k8s.io/v1",` +
+			`"status":{"allowed":true}}`))
+	}))
+	t.Cleanup(kubeAPI.Close)
+
+	event := `{
+		"cluster": {"name": "cluster1", "cluster_id": "test-queue-no-db"},
+		"event": {"compliance": "Compliant", "message": "Compliant", "timestamp": "2024-01-02T15:04:05Z"},
+		"policy": {"apiGroup": "policy.open-cluster-management.io", "kind": "ConfigurationPolicy", "name": "policy1",
+			"spec": {"remediationAction": "inform"}}
+	}`
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		queueFull    bool
+		syncFallback bool
+		expectedCode int
+	}{
+		{"queued", "/api/v1/compliance-events", event, false, false, http.StatusAccepted},
+		{"queue full", "/api/v1/compliance-events", event, true, false, http.StatusServiceUnavailable},
+		{"queue full with fallback", "/api/v1/compliance-events", event, true, true, http.StatusInternalServerError},
+		{"dry run", "/api/v1/compliance-events?dry_run=true", event, false, false, http.StatusInternalServerError},
+		{"multiple", "/api/v1/compliance-events", "[" + event + "]", false, false, http.StatusInternalServerError},
+		{
+			"policy ID",
+			"/api/v1/compliance-events",
+			`{"cluster": {"name": "cluster1", "cluster_id": "test-queue-no-db"}, "policy": {"id": 1},
+				"event": {"compliance": "Compliant", "message": "Compliant", "timestamp": "2024-01-02T15:04:05Z"}}`,
+			false,
+			false,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			_, cancel := context.WithCancel(context.Background())
+			queue := &eventQueue{events: make(chan *queuedEvent, 1), cancel: cancel}
+
+			if test.queueFull {
+				g.Expect(queue.enqueue(&queuedEvent{})).To(BeTrue())
+			}
+
+			server := &ComplianceAPIServer{
+				cfg:        &rest.Config{Host: kubeAPI.URL},
+				eventQueue: queue,
+				options: ComplianceAPIServerOptions{
+					MaxRequestBodyBytes:    DefaultMaxRequestBodyBytes,
+					EventQueueSyncFallback: test.syncFallback,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+			req.Header.Set("Authorization", "Bearer "+t.Name())
+			req.Header.Set("Content-Type", "application/json")
+
+			recorder := httptest.NewRecorder()
+
+			// The database was never connected.
+			server.postComplianceEvent(&ComplianceServerCtx{}, recorder, req)
+
+			g.Expect(recorder.Code).To(Equal(test.expectedCode), recorder.Body.String())
+
+			if test.expectedCode == http.StatusAccepted {
+				g.Expect(queue.events).To(HaveLen(1))
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// exportContentTypes are the Content-Type headers of the export formats.
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv",
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+}
+
+// exportFilename returns the name of the downloaded export file, such as compliance-events-20240102T150405Z.csv.
+func exportFilename(format string, now time.Time) string {
+	return fmt.Sprintf("compliance-events-%s.%s", now.UTC().Format("20060102T150405Z"), format)
+}
+
+// exportWriter writes the compliance events of an export in one of the export formats.
+type exportWriter struct {
+	w           io.Writer
+	format      string
+	includeSpec bool
+	csv         *csv.Writer
+	encoder     *json.Encoder
+	written     int
+}
+
+func newExportWriter(w io.Writer, format string, includeSpec bool) *exportWriter {
+	writer := &exportWriter{w: w, format: format, includeSpec: includeSpec}
+
+	if format == "csv" {
+		writer.csv = csv.NewWriter(w)
+	} else {
+		writer.encoder = json.NewEncoder(w)
+	}
+
+	return writer
+}
+
+// start writes what comes before the compliance events, which is the CSV header or the opening of the JSON array.
+func (e *exportWriter) start() error {
+	switch e.format {
+	case "csv":
+		return e.csv.Write(getCsvHeader(e.includeSpec))
+	case "json":
+		_, err := io.WriteString(e.w, "[")
+
+		return err
+	default:
+		return nil
+	}
+}
+
+func (e *exportWriter) write(ce *ComplianceEvent) error {
+	var err error
+
+	switch e.format {
+	case "csv":
+		err = e.csv.Write(convertToCsvLine(ce, e.includeSpec))
+	case "json":
+		if e.written > 0 {
+			if _, err := io.WriteString(e.w, ","); err != nil {
+				return err
+			}
+		}
+
+		err = e.encoder.Encode(ce)
+	default:
+		err = e.encoder.Encode(ce)
+	}
+
+	if err == nil {
+		e.written++
+	}
+
+	return err
+}
+
+// flush writes the buffered CSV rows to the underlying writer.
+func (e *exportWriter) flush() error {
+	if e.csv == nil {
+		return nil
+	}
+
+	e.csv.Flush()
+
+	return e.csv.Error()
+}
+
+// end writes what comes after the compliance events, which is the closing of the JSON array.
+func (e *exportWriter) end() error {
+	if e.format == "json" {
+		if _, err := io.WriteString(e.w, "]\n"); err != nil {
+			return err
+		}
+	}
+
+	return e.flush()
+}
+
+// exportComplianceEvents writes all the compliance events matching the filters in the query arguments as a
+// downloadable file in the format from getResponseFormat. The compliance events are written as they are read from the
+// database so the results aren't buffered in memory, which means that a database error after the first compliance
+// event can only cut the file short.
+func exportComplianceEvents(db *sql.DB, w http.ResponseWriter, r *http.Request, userConfig *rest.Config) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	format, err := getResponseFormat(r)
+	if err != nil {
+		writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	r = withoutFormatQueryArg(r)
+
+	noAccess := false
+
+	queryArgs, err := parseQueryArgs(r.Context(), r.URL.Query(), db, userConfig, "export")
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNoAccess):
+			// The user can't see any compliance events, so the export is empty.
+			noAccess = true
+		case errors.Is(err, ErrForbidden):
+			writeErrMsgJSON(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrInvalidQueryArg) || errors.Is(err, ErrInvalidQueryArgValue) ||
+			errors.Is(err, ErrInvalidSortOption):
+			writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+		default:
+			writeErrMsgJSON(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		if !noAccess {
+			return
+		}
+	}
+
+	var rows *sql.Rows
+
+	if !noAccess {
+		// Note that the where clause could be an empty string if no filters were passed in the query arguments.
+		whereClause, filterValues := getWhereClause(queryArgs)
+
+		query := getComplianceEventsQuery(whereClause, queryArgs)
+
+		logQuery(r.Context(), query, filterValues)
+
+		rows, err = db.QueryContext(r.Context(), query, filterValues...)
+		if err == nil {
+			err = rows.Err()
+		}
+
+		if err != nil {
+			reqLog.Error(err, "Failed to query for compliance events")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		defer rows.Close()
+	}
+
+	// The headers are set before anything is written since the response is sent in chunks.
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set(
+		"Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFilename(format, time.Now())),
+	)
+
+	writer := newExportWriter(w, format, queryArgs != nil && queryArgs.IncludeSpec)
+	responseController := http.NewResponseController(w)
+
+	if err := writer.start(); err != nil {
+		reqLog.Error(err, "Failed to write the export")
+
+		return
+	}
+
+	for rows != nil && rows.Next() {
+		ce, err := scanIntoComplianceEvent(rows, queryArgs.IncludeSpec)
+		if err != nil {
+			// The status code was already sent, so the export is just cut short.
+			reqLog.Error(err, "Failed to unmarshal the database results")
+
+			return
+		}
+
+		if err := writer.write(ce); err != nil {
+			reqLog.Error(err, "Failed to write the compliance event")
+
+			return
+		}
+
+		if writer.written%ndjsonFlushInterval == 0 {
+			if err := writer.flush(); err != nil {
+				reqLog.Error(err, "Failed to write the compliance events")
+
+				return
+			}
+
+			if err := responseController.Flush(); err != nil {
+				reqLog.V(2).Info("Failed to flush the response", "error", err.Error())
+			}
+		}
+	}
+
+	if rows != nil {
+		if err := rows.Err(); err != nil {
+			// The incomplete file isn't ended so that a JSON export fails to parse rather than silently missing rows.
+			reqLog.Error(err, "Failed to read the compliance events from the database")
+
+			return
+		}
+	}
+
+	if err := writer.end(); err != nil {
+		reqLog.Error(err, "Failed to write the export")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestExportFilename(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	now := time.Date(2024, 1, 2, 10, 4, 5, 0, time.FixedZone("EST", -5*60*60))
+
+	g.Expect(exportFilename("csv", now)).To(Equal("compliance-events-20240102T150405Z.csv"))
+	g.Expect(exportFilename("ndjson", now)).To(Equal("compliance-events-20240102T150405Z.ndjson"))
+}
+
+func TestExportWriter(t *testing.T) {
+	t.Parallel()
+
+	// Writing a CSV line modifies the compliance event, so each test gets its own.
+	newEvents := func() []*ComplianceEvent {
+		return []*ComplianceEvent{
+			{EventID: 1, Event: EventDetails{Compliance: "Compliant", Message: "message 1"}},
+			{EventID: 2, Event: EventDetails{Compliance: "NonCompliant", Message: "message, 2"}},
+		}
+	}
+
+	tests := map[string]struct {
+		events   []*ComplianceEvent
+		expected func(g *WithT, output []byte)
+	}{
+		"json": {
+			events: newEvents(),
+			expected: func(g *WithT, output []byte) {
+				exported := []ComplianceEvent{}
+				g.Expect(json.Unmarshal(output, &exported)).To(Succeed())
+				g.Expect(exported).To(HaveLen(2))
+				g.Expect(exported[1].EventID).To(Equal(int32(2)))
+			},
+		},
+		"json-empty": {
+			expected: func(g *WithT, output []byte) {
+				g.Expect(string(output)).To(Equal("[]\n"))
+			},
+		},
+		"ndjson": {
+			events: newEvents(),
+			expected: func(g *WithT, output []byte) {
+				lines := bytes.Split(bytes.TrimSpace(output), []byte("\n"))
+				g.Expect(lines).To(HaveLen(2))
+
+				exported := ComplianceEvent{}
+				g.Expect(json.Unmarshal(lines[0], &exported)).To(Succeed())
+				g.Expect(exported.EventID).To(Equal(int32(1)))
+			},
+		},
+		"csv": {
+			events: newEvents(),
+			expected: func(g *WithT, output []byte) {
+				lines := bytes.Split(bytes.TrimSpace(output), []byte("\n"))
+				g.Expect(lines).To(HaveLen(3))
+				g.Expect(string(lines[0])).To(HavePrefix("compliance_events_id,compliance_events_compliance,"))
+				g.Expect(string(lines[2])).To(HavePrefix(`2,NonCompliant,"message, 2",`))
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		format, _, _ := strings.Cut(name, "-")
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			output := &bytes.Buffer{}
+			writer := newExportWriter(output, format, false)
+
+			g.Expect(writer.start()).To(Succeed())
+
+			for _, event := range test.events {
+				g.Expect(writer.write(event)).To(Succeed())
+			}
+
+			g.Expect(writer.end()).To(Succeed())
+			g.Expect(writer.written).To(Equal(len(test.events)))
+
+			test.expected(g, output.Bytes())
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipMinSize is the response size in bytes at which responses start being compressed. Smaller responses aren't
+// worth the overhead.
+const gzipMinSize = 1400
+
+// gzipResponseWriter buffers the response until gzipMinSize is reached. At that point, the response is compressed.
+// If the handler finishes before then, the buffered response is written uncompressed in Close.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+
+	g.wroteHeader = true
+	g.code = code
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+
+	g.buf.Write(p)
+
+	if g.buf.Len() < gzipMinSize {
+		return len(p), nil
+	}
+
+	if err := g.startGzip(); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// startGzip writes the headers and starts compressing the response, beginning with the buffered response.
+func (g *gzipResponseWriter) startGzip() error {
+	g.Header().Set("Content-Encoding", "gzip")
+	g.Header().Del("Content-Length")
+	g.ResponseWriter.WriteHeader(g.code)
+
+	g.gz = gzip.NewWriter(g.ResponseWriter)
+
+	if _, err := g.gz.Write(g.buf.Bytes()); err != nil {
+		return err
+	}
+
+	g.buf.Reset()
+
+	return nil
+}
+
+// FlushError sends what has been written so far to the client. Since a streamed response can't be known to stay
+// small, compression starts on the first flush.
+func (g *gzipResponseWriter) FlushError() error {
+	if g.gz == nil {
+		if !g.wroteHeader {
+			g.WriteHeader(http.StatusOK)
+		}
+
+		if err := g.startGzip(); err != nil {
+			return err
+		}
+	}
+
+	if err := g.gz.Flush(); err != nil {
+		return err
+	}
+
+	return http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to access the underlying http.ResponseWriter.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// Close writes the buffered response if compression never started or finishes the compressed response.
+func (g *gzipResponseWriter) Close() error {
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+
+	if g.wroteHeader {
+		g.ResponseWriter.WriteHeader(g.code)
+	}
+
+	if g.buf.Len() == 0 {
+		return nil
+	}
+
+	_, err := g.ResponseWriter.Write(g.buf.Bytes())
+
+	return err
+}
+
+// gzipHandler compresses responses from next with gzip when the client accepts it.
+func gzipHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			if err := gw.Close(); err != nil {
+				log.Error(err, "error writing the compressed response")
+			}
+		}()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip returns true if the Accept-Encoding header of the request contains gzip without a q value of 0.
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, encoding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+			if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				continue
+			}
+
+			params = strings.ReplaceAll(params, " ", "")
+			if params == "q=0" || params == "q=0.0" || params == "q=0.00" || params == "q=0.000" {
+				return false
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
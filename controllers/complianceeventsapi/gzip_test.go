@@ -0,0 +1,72 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestGzipHandler(t *testing.T) {
+	t.Parallel()
+
+	largeBody := strings.Repeat("a", gzipMinSize*2)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		body           string
+		compressed     bool
+	}{
+		{"large response with gzip", "gzip, deflate", largeBody, true},
+		{"large response without gzip", "deflate", largeBody, false},
+		{"large response with gzip disabled", "gzip;q=0", largeBody, false},
+		{"small response with gzip", "gzip", `{"message":"Not found"}`, false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			handler := gzipHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(test.body))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events", nil)
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			g.Expect(recorder.Code).To(Equal(http.StatusNotFound))
+
+			var body io.Reader = recorder.Body
+
+			if test.compressed {
+				g.Expect(recorder.Header().Get("Content-Encoding")).To(Equal("gzip"))
+
+				reader, err := gzip.NewReader(recorder.Body)
+				g.Expect(err).ToNot(HaveOccurred())
+
+				body = reader
+			} else {
+				g.Expect(recorder.Header().Get("Content-Encoding")).To(BeEmpty())
+			}
+
+			bodyBytes, err := io.ReadAll(body)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(bodyBytes)).To(Equal(test.body))
+		})
+	}
+}
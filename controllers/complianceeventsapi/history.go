@@ -0,0 +1,73 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+// historyQueryArgs are the query arguments of the policy history API endpoint other than page and per_page. The
+// cluster, policy, and sort query arguments of the compliance events list API endpoint are set from the path instead.
+var historyQueryArgs = []string{
+	"cursor",
+	"direction",
+	"event.timestamp_after",
+	"event.timestamp_before",
+	"include_deleted",
+}
+
+// parseHistoryPath parses the cluster ID and policy ID from a path of the form
+// /api/v1/clusters/{cluster_id}/policies/{policy_id}/history. False is returned if the path doesn't have that form.
+func parseHistoryPath(path string) (clusterID string, policyID string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/api/v1/clusters/"), "/")
+	if len(parts) != 4 || parts[0] == "" || parts[1] != "policies" || parts[2] == "" || parts[3] != "history" {
+		return "", "", false
+	}
+
+	return parts[0], parts[2], true
+}
+
+// getPolicyHistory handles the GET API endpoint for the compliance history of a policy on a cluster. It's the
+// compliance events list API endpoint filtered by the cluster ID and policy ID in the path and sorted by timestamp, so
+// the response and pagination are the same. An empty list is returned if the policy has no compliance events on the
+// cluster.
+func getPolicyHistory(db *sql.DB, w http.ResponseWriter, r *http.Request, userConfig *rest.Config) {
+	clusterID, policyIDStr, _ := parseHistoryPath(r.URL.Path)
+
+	// A comma would be treated as multiple cluster IDs by the cluster.cluster_id filter.
+	if strings.Contains(clusterID, ",") {
+		writeErrMsgJSON(w, "The provided cluster ID is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	policyID, err := strconv.ParseUint(policyIDStr, 10, 64)
+	if err != nil || policyID == 0 {
+		writeErrMsgJSON(w, "The provided policy ID is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	queryArgs := r.URL.Query()
+
+	// The values are validated by getComplianceEvents, so this is only for rejecting unsupported query arguments.
+	if _, _, err := parsePaginationArgs(queryArgs, historyQueryArgs...); err != nil {
+		writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	queryArgs.Set("cluster.cluster_id", clusterID)
+	queryArgs.Set("policy.id", strconv.FormatUint(policyID, 10))
+	queryArgs.Set("sort", "event.timestamp")
+
+	listReq := r.Clone(r.Context())
+	listReq.URL.RawQuery = queryArgs.Encode()
+
+	getComplianceEvents(db, w, listReq, userConfig)
+}
@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseHistoryPath(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		path              string
+		expectedClusterID string
+		expectedPolicyID  string
+		expectedOK        bool
+	}{
+		"valid": {
+			path:              "/api/v1/clusters/some-uuid/policies/3/history",
+			expectedClusterID: "some-uuid",
+			expectedPolicyID:  "3",
+			expectedOK:        true,
+		},
+		"no history suffix":  {path: "/api/v1/clusters/some-uuid/policies/3"},
+		"empty cluster ID":   {path: "/api/v1/clusters//policies/3/history"},
+		"empty policy ID":    {path: "/api/v1/clusters/some-uuid/policies//history"},
+		"wrong resource":     {path: "/api/v1/clusters/some-uuid/parent-policies/3/history"},
+		"extra path segment": {path: "/api/v1/clusters/some-uuid/policies/3/history/1"},
+	}
+
+	for name, test := range tests {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			clusterID, policyID, ok := parseHistoryPath(test.path)
+			g.Expect(ok).To(Equal(test.expectedOK))
+			g.Expect(clusterID).To(Equal(test.expectedClusterID))
+			g.Expect(policyID).To(Equal(test.expectedPolicyID))
+		})
+	}
+}
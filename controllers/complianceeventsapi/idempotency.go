@@ -0,0 +1,177 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyKeyTTL is how long the result of a request with an Idempotency-Key header is kept for replays.
+	idempotencyKeyTTL       = 10 * time.Minute
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentIDs is the maximum number of compliance event IDs kept for a replay so that the memory used by a
+	// cached result doesn't grow with the size of a bulk request.
+	maxIdempotentIDs = 100
+)
+
+// idempotentResults caches an *idempotentEntry per Idempotency-Key header of POST requests. The keys are scoped to the
+// caller's token so that unrelated clients can't collide.
+var idempotentResults = NewKeyCache(DefaultKeyCacheCapacity, idempotencyKeyTTL)
+
+// idempotencyLock is held while reserving a key and while changing an *idempotentEntry so that concurrent requests
+// with the same key can't both be recorded.
+var idempotencyLock sync.Mutex
+
+// idempotentSummary is the response body of a replayed request.
+type idempotentSummary struct {
+	// Count is the number of compliance events in the original request.
+	Count int `json:"count"`
+	// IDs are the database IDs of the recorded compliance events. It's empty if the compliance events were queued or
+	// if there were more than maxIdempotentIDs of them.
+	IDs []int32 `json:"ids"`
+}
+
+type idempotentEntry struct {
+	// bodyHash is the hash of the request body so that reusing a key for a different request is rejected.
+	bodyHash string
+	// pending is true until the first request with the key succeeds.
+	pending bool
+	summary idempotentSummary
+}
+
+// idempotencyReservation is the reserved key of a request with an Idempotency-Key header. A nil reservation is valid
+// and means the request doesn't have the header.
+type idempotencyReservation struct {
+	cacheKey string
+	entry    *idempotentEntry
+}
+
+// idempotencyCacheKey returns the idempotentResults key for the request. An empty string is returned if the request
+// doesn't have an Idempotency-Key header.
+func idempotencyCacheKey(r *http.Request) string {
+	idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+	if idempotencyKey == "" {
+		return ""
+	}
+
+	return hashToken(parseToken(r)) + "/" + idempotencyKey
+}
+
+// reserveIdempotencyKey reserves the Idempotency-Key header of the request, which must already be authorized, before
+// the compliance events in body are recorded. If the key was already used with the same body, the summary of the
+// original result is replayed with a 200 status code. A 409 response is written if the original request is still in
+// progress, and a 422 response is written if the key was used with a different body. False is returned if a response
+// was written. Call release when done with the returned reservation, which may be nil.
+func reserveIdempotencyKey(w http.ResponseWriter, r *http.Request, body []byte) (*idempotencyReservation, bool) {
+	if len(r.Header.Get(idempotencyKeyHeader)) > maxIdempotencyKeyLength {
+		writeErrMsgJSON(
+			w,
+			fmt.Sprintf("The %s header must not be longer than %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength),
+			http.StatusBadRequest,
+		)
+
+		return nil, false
+	}
+
+	cacheKey := idempotencyCacheKey(r)
+	if cacheKey == "" {
+		return nil, true
+	}
+
+	bodyHash := sha256.Sum256(body)
+	bodyHashHex := hex.EncodeToString(bodyHash[:])
+
+	idempotencyLock.Lock()
+	defer idempotencyLock.Unlock()
+
+	cached, ok := idempotentResults.Load(cacheKey)
+	if !ok {
+		entry := &idempotentEntry{bodyHash: bodyHashHex, pending: true}
+		idempotentResults.Store(cacheKey, entry)
+
+		return &idempotencyReservation{cacheKey: cacheKey, entry: entry}, true
+	}
+
+	entry := cached.(*idempotentEntry)
+
+	switch {
+	case entry.bodyHash != bodyHashHex:
+		writeErrMsgJSON(
+			w,
+			fmt.Sprintf("The %s header was already used with a different request body", idempotencyKeyHeader),
+			http.StatusUnprocessableEntity,
+		)
+	case entry.pending:
+		w.Header().Set("Retry-After", "1")
+		writeErrMsgJSON(
+			w,
+			fmt.Sprintf("A request with the same %s header is still in progress", idempotencyKeyHeader),
+			http.StatusConflict,
+		)
+	default:
+		resp, err := json.Marshal(entry.summary)
+		if err != nil {
+			log.Error(err, "error marshaling the replayed response")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			break
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := w.Write(resp); err != nil {
+			log.Error(err, "error writing the replayed response")
+		}
+	}
+
+	return nil, false
+}
+
+// complete records the result of the request so that retries with the same key are replayed. The IDs are the database
+// IDs of the recorded compliance events, or nil if they were queued.
+func (res *idempotencyReservation) complete(count int, ids []int32) {
+	if res == nil {
+		return
+	}
+
+	if len(ids) > maxIdempotentIDs {
+		ids = nil
+	}
+
+	if ids == nil {
+		ids = []int32{}
+	}
+
+	idempotencyLock.Lock()
+	defer idempotencyLock.Unlock()
+
+	res.entry.pending = false
+	res.entry.summary = idempotentSummary{Count: count, IDs: ids}
+}
+
+// release removes the reservation if the request didn't complete so that it can be retried with the same key.
+func (res *idempotencyReservation) release() {
+	if res == nil {
+		return
+	}
+
+	idempotencyLock.Lock()
+	defer idempotencyLock.Unlock()
+
+	if !res.entry.pending {
+		return
+	}
+
+	// Only remove the entry if it's still this reservation's, since it may have expired and been replaced.
+	if cached, ok := idempotentResults.Load(res.cacheKey); ok && cached == res.entry {
+		idempotentResults.Delete(res.cacheKey)
+	}
+}
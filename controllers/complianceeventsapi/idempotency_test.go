@@ -0,0 +1,231 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func newIdempotentRequest(token string, key string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/compliance-events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+
+	return req
+}
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// first is run with the key and the first body before the retry, if set.
+		first         func(reservation *idempotencyReservation)
+		key           string
+		retryBody     string
+		expectedOK    bool
+		expectedCode  int
+		expectedCount int
+		expectedIDs   []int32
+	}{
+		{"no header", nil, "", "first", true, http.StatusOK, 0, nil},
+		{"too long", nil, strings.Repeat("k", maxIdempotencyKeyLength+1), "first", false, http.StatusBadRequest, 0, nil},
+		{"new key", nil, "new", "first", true, http.StatusOK, 0, nil},
+		{"in progress", func(*idempotencyReservation) {}, "in-progress", "first", false, http.StatusConflict, 0, nil},
+		{
+			"replayed",
+			func(res *idempotencyReservation) { res.complete(1, []int32{7}) },
+			"replayed",
+			"first",
+			false,
+			http.StatusOK,
+			1,
+			[]int32{7},
+		},
+		{
+			"queued",
+			func(res *idempotencyReservation) { res.complete(1, nil) },
+			"queued",
+			"first",
+			false,
+			http.StatusOK,
+			1,
+			[]int32{},
+		},
+		{
+			"too many IDs",
+			func(res *idempotencyReservation) { res.complete(maxIdempotentIDs+1, make([]int32, maxIdempotentIDs+1)) },
+			"too-many-ids",
+			"first",
+			false,
+			http.StatusOK,
+			maxIdempotentIDs + 1,
+			[]int32{},
+		},
+		{
+			"different body",
+			func(res *idempotencyReservation) { res.complete(1, []int32{7}) },
+			"different-body",
+			"second",
+			false,
+			http.StatusUnprocessableEntity,
+			0,
+			nil,
+		},
+		{
+			"released",
+			func(res *idempotencyReservation) { res.release() },
+			"released",
+			"first",
+			true,
+			http.StatusOK,
+			0,
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			// The token is unique to the test case since the cached results are shared by the package.
+			token := "reserve-idempotency-key-" + test.name
+
+			if test.first != nil {
+				reservation, ok := reserveIdempotencyKey(
+					httptest.NewRecorder(), newIdempotentRequest(token, test.key), []byte("first"),
+				)
+				g.Expect(ok).To(BeTrue())
+				g.Expect(reservation).ToNot(BeNil())
+
+				test.first(reservation)
+			}
+
+			recorder := httptest.NewRecorder()
+
+			reservation, ok := reserveIdempotencyKey(
+				recorder, newIdempotentRequest(token, test.key), []byte(test.retryBody),
+			)
+			g.Expect(ok).To(Equal(test.expectedOK))
+			g.Expect(recorder.Code).To(Equal(test.expectedCode))
+
+			if test.expectedOK {
+				g.Expect(reservation == nil).To(Equal(test.key == ""))
+
+				return
+			}
+
+			g.Expect(reservation).To(BeNil())
+
+			if test.expectedIDs != nil {
+				summary := idempotentSummary{}
+				g.Expect(json.Unmarshal(recorder.Body.Bytes(), &summary)).To(Succeed())
+				g.Expect(summary.Count).To(Equal(test.expectedCount))
+				g.Expect(summary.IDs).To(Equal(test.expectedIDs))
+			}
+		})
+	}
+}
+
+func TestReserveIdempotencyKeyConcurrent(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	reserved := 0
+	codes := []int{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			recorder := httptest.NewRecorder()
+
+			_, ok := reserveIdempotencyKey(
+				recorder, newIdempotentRequest("reserve-idempotency-key-concurrent", "concurrent"), []byte("body"),
+			)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if ok {
+				reserved++
+			} else {
+				codes = append(codes, recorder.Code)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Only one of the concurrent requests can record the compliance event.
+	g.Expect(reserved).To(Equal(1))
+	g.Expect(codes).To(HaveLen(9))
+	g.Expect(codes).To(HaveEach(http.StatusConflict))
+}
+
+func TestPostComplianceEventIdempotencyAuthorization(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	api, cfg := newFakeAuthzAPI(t)
+	token := "post-idempotency-authorization"
+	api.setAllowed(token, true)
+
+	_, cancel := context.WithCancel(context.Background())
+	queue := &eventQueue{events: make(chan *queuedEvent, 10), cancel: cancel}
+
+	server := &ComplianceAPIServer{
+		cfg:        cfg,
+		eventQueue: queue,
+		options:    ComplianceAPIServerOptions{MaxRequestBodyBytes: DefaultMaxRequestBodyBytes},
+	}
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/compliance-events", strings.NewReader(`{
+			"cluster": {"name": "cluster1", "cluster_id": "test-idempotency-authorization"},
+			"event": {"compliance": "Compliant", "message": "Compliant", "timestamp": "2024-01-02T15:04:05Z"},
+			"policy": {"apiGroup": "policy.open-cluster-management.io", "kind": "ConfigurationPolicy",
+				"name": "policy1", "spec": {"remediationAction": "inform"}}
+		}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, "authorization")
+
+		recorder := httptest.NewRecorder()
+		server.postComplianceEvent(&ComplianceServerCtx{}, recorder, req)
+
+		return recorder
+	}
+
+	g.Expect(post().Code).To(Equal(http.StatusAccepted))
+	g.Expect(post().Code).To(Equal(http.StatusOK))
+	g.Expect(queue.events).To(HaveLen(1))
+
+	// A retry is authorized again before the result is replayed.
+	api.setAllowed(token, false)
+	expireKeyCacheEntry(recordAuthzCache, recordAuthzCacheKey(token, "cluster1"))
+
+	g.Expect(post().Code).To(Equal(http.StatusForbidden))
+}
@@ -0,0 +1,307 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// ClusterWithID is a cluster in the response of the clusters list API endpoint.
+type ClusterWithID struct {
+	ID int32 `json:"id"`
+	Cluster
+}
+
+type ClusterListResponse struct {
+	Data     []ClusterWithID `json:"data"`
+	Metadata metadata        `json:"metadata"`
+}
+
+// ParentPolicyWithCounts is a parent policy in the response of the parent policies list API endpoint.
+type ParentPolicyWithCounts struct {
+	ParentPolicy
+	ChildPolicyCount uint64 `json:"child_policy_count"`
+	EventCount       uint64 `json:"event_count"`
+}
+
+type ParentPolicyListResponse struct {
+	Data     []ParentPolicyWithCounts `json:"data"`
+	Metadata metadata                 `json:"metadata"`
+}
+
+// parsePaginationArgs parses the page and per_page query arguments with the same defaults and limits as the compliance
+// events list API endpoint. Any query argument not in validArgs results in an ErrInvalidQueryArgValue error.
+func parsePaginationArgs(queryArgs url.Values, validArgs ...string) (page uint64, perPage uint64, err error) {
+	page = 1
+	perPage = 20
+	validArgs = append([]string{"page", "per_page"}, validArgs...)
+
+	for arg := range queryArgs {
+		if !slices.Contains(validArgs, arg) {
+			return 0, 0, fmt.Errorf(
+				"%w: %s is not supported, choose from: %s", ErrInvalidQueryArgValue, arg, strings.Join(validArgs, ", "),
+			)
+		}
+	}
+
+	if value := queryArgs.Get("page"); value != "" {
+		page, err = strconv.ParseUint(value, 10, 64)
+		if err != nil || page == 0 {
+			return 0, 0, fmt.Errorf("%w: page must be a positive integer", ErrInvalidQueryArgValue)
+		}
+	}
+
+	if value := queryArgs.Get("per_page"); value != "" {
+		perPage, err = strconv.ParseUint(value, 10, 64)
+		if err != nil || perPage == 0 || perPage > 100 {
+			return 0, 0, fmt.Errorf("%w: per_page must be a value between 1 and 100", ErrInvalidQueryArgValue)
+		}
+	}
+
+	return page, perPage, nil
+}
+
+// getAuthorizedClustersWhereClause returns a SQL condition limiting the clusters table to the managed clusters the user
+// has access to and the values for it. An empty condition means the user has access to all managed clusters.
+// ErrNoAccess is returned if the user has no access to any managed cluster.
+func getAuthorizedClustersWhereClause(r *http.Request, db *sql.DB, userConfig *rest.Config) (string, []any, error) {
+	parsed := &queryOptions{Filters: map[string][]string{}}
+
+	parsed, err := setAuthorizedClusters(r.Context(), db, parsed, userConfig)
+	if err != nil {
+		return "", nil, err
+	}
+
+	whereClause, values := getWhereClause(parsed)
+
+	return strings.TrimPrefix(whereClause, "\nWHERE "), values, nil
+}
+
+// getClusters handles the clusters list API endpoint. It returns the clusters referenced by at least one compliance
+// event that the user has access to.
+func getClusters(db *sql.DB, w http.ResponseWriter, r *http.Request, userConfig *rest.Config) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	page, perPage, err := parsePaginationArgs(r.URL.Query())
+	if err != nil {
+		writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	response := ClusterListResponse{
+		Data:     []ClusterWithID{},
+		Metadata: metadata{Page: page, PerPage: perPage},
+	}
+
+	authzCondition, filterValues, err := getAuthorizedClustersWhereClause(r, db, userConfig)
+	if err != nil && !errors.Is(err, ErrNoAccess) {
+		reqLog.Error(err, "Failed to determine the managed clusters the user has access to")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if err == nil {
+		conditions := []string{
+			"EXISTS (SELECT 1 FROM compliance_events WHERE compliance_events.cluster_id = clusters.id AND " +
+				"compliance_events.deleted_at IS NULL)",
+		}
+
+		if authzCondition != "" {
+			conditions = append(conditions, authzCondition)
+		}
+
+		whereClause := "\nWHERE " + strings.Join(conditions, " AND ")
+
+		countQuery := "SELECT COUNT(*) FROM clusters" + whereClause // #nosec G202
+
+		if err := db.QueryRowContext(r.Context(), countQuery, filterValues...).Scan(&response.Metadata.Total); err != nil {
+			reqLog.Error(err, "Failed to get the count of clusters", getPqErrKeyVals(err)...)
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		query := fmt.Sprintf(
+			"SELECT clusters.id, clusters.name, clusters.cluster_id FROM clusters%s\n"+
+				"ORDER BY clusters.name, clusters.cluster_id LIMIT %d OFFSET %d",
+			whereClause, perPage, (page-1)*perPage,
+		) // #nosec G201 -- the limit and offset are validated integers
+
+		rows, err := db.QueryContext(r.Context(), query, filterValues...)
+		if err == nil {
+			err = rows.Err()
+		}
+
+		if err != nil {
+			reqLog.Error(err, "Failed to query for clusters", getPqErrKeyVals(err)...)
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			cluster := ClusterWithID{}
+
+			if err := rows.Scan(&cluster.ID, &cluster.Name, &cluster.ClusterID); err != nil {
+				reqLog.Error(err, "Failed to unmarshal the database results")
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+				return
+			}
+
+			response.Data = append(response.Data, cluster)
+		}
+
+		response.Metadata.Pages = uint64(math.Ceil(float64(response.Metadata.Total) / float64(perPage)))
+	}
+
+	writeListResponseJSON(w, r, response)
+}
+
+// getParentPolicies handles the parent policies list API endpoint. It returns the parent policies with the number of
+// distinct child policies and compliance events associated with them. If the user only has access to a subset of the
+// managed clusters, only the compliance events from those managed clusters are counted and parent policies without such
+// compliance events are omitted.
+func getParentPolicies(db *sql.DB, w http.ResponseWriter, r *http.Request, userConfig *rest.Config) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	queryArgs := r.URL.Query()
+
+	page, perPage, err := parsePaginationArgs(queryArgs, "name")
+	if err != nil {
+		writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	response := ParentPolicyListResponse{
+		Data:     []ParentPolicyWithCounts{},
+		Metadata: metadata{Page: page, PerPage: perPage},
+	}
+
+	authzCondition, filterValues, err := getAuthorizedClustersWhereClause(r, db, userConfig)
+	if errors.Is(err, ErrNoAccess) {
+		writeListResponseJSON(w, r, response)
+
+		return
+	}
+
+	if err != nil {
+		reqLog.Error(err, "Failed to determine the managed clusters the user has access to")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	joinCondition := "compliance_events.parent_policy_id = parent_policies.id AND compliance_events.deleted_at IS NULL"
+	havingClause := ""
+
+	if authzCondition != "" {
+		joinCondition += " AND " + authzCondition
+		havingClause = "\nHAVING COUNT(compliance_events.id) > 0"
+	}
+
+	whereClause := ""
+
+	if names := splitQueryValue(queryArgs.Get("name")); len(names) > 0 {
+		filterValues = append(filterValues, pq.StringArray(names))
+		whereClause = fmt.Sprintf("\nWHERE parent_policies.name = ANY($%d)", len(filterValues))
+	}
+
+	// For example:
+	// FROM parent_policies
+	// LEFT JOIN (compliance_events JOIN clusters ON compliance_events.cluster_id = clusters.id)
+	// ON compliance_events.parent_policy_id = parent_policies.id AND (clusters.name=$1)
+	// WHERE parent_policies.name = ANY($2)
+	// GROUP BY parent_policies.id
+	// HAVING COUNT(compliance_events.id) > 0
+	fromClause := "FROM parent_policies\n" +
+		"LEFT JOIN (compliance_events JOIN clusters ON compliance_events.cluster_id = clusters.id)\n" +
+		"ON " + joinCondition + whereClause + "\nGROUP BY parent_policies.id" + havingClause
+
+	countQuery := "SELECT COUNT(*) FROM (SELECT parent_policies.id " + fromClause + ") AS matches" // #nosec G202
+
+	if err := db.QueryRowContext(r.Context(), countQuery, filterValues...).Scan(&response.Metadata.Total); err != nil {
+		reqLog.Error(err, "Failed to get the count of parent policies", getPqErrKeyVals(err)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	query := fmt.Sprintf(
+		"SELECT parent_policies.id, parent_policies.name, parent_policies.namespace, parent_policies.categories, "+
+			"parent_policies.controls, parent_policies.standards, COUNT(DISTINCT compliance_events.policy_id), "+
+			"COUNT(compliance_events.id)\n%s\n"+
+			"ORDER BY parent_policies.name, parent_policies.namespace, parent_policies.id LIMIT %d OFFSET %d",
+		fromClause, perPage, (page-1)*perPage,
+	) // #nosec G201 -- the limit and offset are validated integers
+
+	rows, err := db.QueryContext(r.Context(), query, filterValues...)
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if err != nil {
+		reqLog.Error(err, "Failed to query for parent policies", getPqErrKeyVals(err)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		pp := ParentPolicyWithCounts{}
+
+		err := rows.Scan(
+			&pp.KeyID, &pp.Name, &pp.Namespace, &pp.Categories, &pp.Controls, &pp.Standards, &pp.ChildPolicyCount,
+			&pp.EventCount,
+		)
+		if err != nil {
+			reqLog.Error(err, "Failed to unmarshal the database results")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		response.Data = append(response.Data, pp)
+	}
+
+	response.Metadata.Pages = uint64(math.Ceil(float64(response.Metadata.Total) / float64(perPage)))
+
+	writeListResponseJSON(w, r, response)
+}
+
+// writeListResponseJSON writes the response as JSON with a 200 status code.
+func writeListResponseJSON(w http.ResponseWriter, r *http.Request, response any) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	jsonResp, err := json.Marshal(response)
+	if err != nil {
+		reqLog.Error(err, "Failed to marshal the response")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if _, err = w.Write(jsonResp); err != nil {
+		reqLog.Error(err, "Error writing success response")
+	}
+}
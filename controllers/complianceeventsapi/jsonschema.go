@@ -0,0 +1,198 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errSchemaRequestNotJSON = errors.New("the request body is not valid JSON")
+
+// schemaValidator validates request bodies against the schemas in the OpenAPI document so that the documented schema
+// is enforced rather than only the hand-written Validate methods. Only the schema keywords used by the OpenAPI
+// document for request bodies are supported: $ref, allOf, type, format, nullable, required, properties, items, and
+// enum.
+type schemaValidator struct {
+	schemas map[string]any
+}
+
+// newSchemaValidator parses the component schemas of the embedded OpenAPI document.
+func newSchemaValidator() (*schemaValidator, error) {
+	document := struct {
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}{}
+
+	if err := json.Unmarshal(openAPIDocument, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse the OpenAPI document: %w", err)
+	}
+
+	if _, ok := document.Components.Schemas["ComplianceEvent"]; !ok {
+		return nil, errors.New("the OpenAPI document doesn't have the ComplianceEvent schema")
+	}
+
+	return &schemaValidator{schemas: document.Components.Schemas}, nil
+}
+
+// validateComplianceEvents validates the raw request body of a compliance event or a JSON array of compliance events.
+// The returned error joins a FieldError for every violation, with the field as a JSON pointer such as /policy/spec.
+// errSchemaRequestNotJSON is returned if the body is not valid JSON.
+func (v *schemaValidator) validateComplianceEvents(body []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+
+	if err := decoder.Decode(&value); err != nil {
+		return errSchemaRequestNotJSON
+	}
+
+	errs := []error{}
+	eventSchema := map[string]any{"$ref": "#/components/schemas/ComplianceEvent"}
+
+	if events, ok := value.([]any); ok {
+		for i, event := range events {
+			errs = append(errs, v.validate(event, eventSchema, "/"+strconv.Itoa(i))...)
+		}
+	} else {
+		errs = append(errs, v.validate(value, eventSchema, "")...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate returns a FieldError for every violation of the schema by the value at the JSON pointer path.
+func (v *schemaValidator) validate(value any, schema map[string]any, path string) []error {
+	if ref, ok := schema["$ref"].(string); ok {
+		refSchema, ok := v.schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+		if !ok {
+			return []error{newInvalidFieldError(schemaErrPath(path), "has an unsupported schema")}
+		}
+
+		return v.validate(value, refSchema, path)
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+	}
+
+	errs := []error{}
+
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, subSchema := range allOf {
+			if subSchema, ok := subSchema.(map[string]any); ok {
+				// A null value is allowed if the schema with the allOf is nullable, which was already checked.
+				if value != nil {
+					errs = append(errs, v.validate(value, subSchema, path)...)
+				}
+			}
+		}
+	}
+
+	schemaType, _ := schema["type"].(string)
+
+	switch schemaType {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return append(errs, newInvalidFieldError(schemaErrPath(path), "must be an object"))
+		}
+
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, found := object[name]; !found {
+						errs = append(errs, newRequiredFieldError(path+"/"+name))
+					}
+				}
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+
+		// Sort the properties so that the errors are in a consistent order.
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+
+		slices.Sort(names)
+
+		for _, name := range names {
+			if propSchema, ok := properties[name].(map[string]any); ok {
+				errs = append(errs, v.validate(object[name], propSchema, path+"/"+name)...)
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return append(errs, newInvalidFieldError(schemaErrPath(path), "must be an array"))
+		}
+
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range array {
+				errs = append(errs, v.validate(item, items, path+"/"+strconv.Itoa(i))...)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return append(errs, newInvalidFieldError(schemaErrPath(path), "must be a string"))
+		}
+
+		if format, _ := schema["format"].(string); format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				errs = append(errs, newInvalidFieldError(schemaErrPath(path), "must be a date-time in RFC 3339 format"))
+			}
+		}
+
+		if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, any(str)) {
+			allowed := make([]string, 0, len(enum))
+			for _, enumVal := range enum {
+				allowed = append(allowed, fmt.Sprint(enumVal))
+			}
+
+			errs = append(
+				errs,
+				newInvalidFieldError(schemaErrPath(path), "must be one of: "+strings.Join(allowed, ", ")),
+			)
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return append(errs, newInvalidFieldError(schemaErrPath(path), "must be an integer"))
+		}
+
+		integer, err := number.Int64()
+		if err != nil {
+			return append(errs, newInvalidFieldError(schemaErrPath(path), "must be an integer"))
+		}
+
+		if format, _ := schema["format"].(string); format == "int32" &&
+			(integer > math.MaxInt32 || integer < math.MinInt32) {
+			errs = append(errs, newInvalidFieldError(schemaErrPath(path), "must be a 32-bit integer"))
+		}
+	}
+
+	return errs
+}
+
+// schemaErrPath returns the JSON pointer to use in an error message, which is "/" for the root of the document.
+func schemaErrPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
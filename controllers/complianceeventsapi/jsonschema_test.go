@@ -0,0 +1,99 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSchemaValidatorValidateComplianceEvents(t *testing.T) {
+	t.Parallel()
+
+	validator, err := newSchemaValidator()
+	if err != nil {
+		t.Fatal("failed to create the schema validator", err)
+	}
+
+	validEvent := `{
+		"cluster": {"name": "cluster1", "cluster_id": "cluster1-uuid"},
+		"parent_policy": null,
+		"policy": {"apiGroup": "policy.open-cluster-management.io", "kind": "ConfigurationPolicy", "name": "p",
+			"spec": {"test": "one"}},
+		"event": {"compliance": "Compliant", "message": "ok", "timestamp": "2023-04-04T04:04:04.444Z"}
+	}`
+
+	tests := []struct {
+		name     string
+		body     string
+		expected []FieldError
+	}{
+		{"valid", validEvent, []FieldError{}},
+		{"valid array", "[" + validEvent + "," + validEvent + "]", []FieldError{}},
+		{
+			"missing fields",
+			`{"cluster": {"name": "cluster1"}, "policy": {"id": 1}}`,
+			[]FieldError{
+				{Field: "/event", Message: "is required"},
+				{Field: "/cluster/cluster_id", Message: "is required"},
+			},
+		},
+		{
+			"wrong types",
+			`{
+				"cluster": {"name": 1, "cluster_id": "cluster1-uuid"},
+				"parent_policy": {"id": 1, "categories": "cat1"},
+				"policy": {"id": 3000000000, "spec": []},
+				"event": {"compliance": "Good", "message": "ok", "timestamp": "yesterday", "reported_by": null}
+			}`,
+			[]FieldError{
+				{Field: "/cluster/name", Message: "must be a string"},
+				{Field: "/event/compliance", Message: "must be one of: Compliant, NonCompliant, Disabled, Pending"},
+				{Field: "/event/timestamp", Message: "must be a date-time in RFC 3339 format"},
+				{Field: "/parent_policy/categories", Message: "must be an array"},
+				{Field: "/policy/id", Message: "must be a 32-bit integer"},
+				{Field: "/policy/spec", Message: "must be an object"},
+			},
+		},
+		{
+			"array index",
+			"[" + validEvent + `, {"cluster": null, "event": {}, "policy": {}}]`,
+			[]FieldError{
+				{Field: "/1/cluster", Message: "must be an object"},
+				{Field: "/1/event/compliance", Message: "is required"},
+				{Field: "/1/event/message", Message: "is required"},
+				{Field: "/1/event/timestamp", Message: "is required"},
+			},
+		},
+		{"not an object", `"event"`, []FieldError{{Field: "/", Message: "must be an object"}}},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			fieldErrs := getFieldErrors(validator.validateComplianceEvents([]byte(test.body)))
+			for i := range fieldErrs {
+				fieldErrs[i].err = nil
+			}
+
+			g.Expect(fieldErrs).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestSchemaValidatorInvalidJSON(t *testing.T) {
+	t.Parallel()
+
+	validator, err := newSchemaValidator()
+	if err != nil {
+		t.Fatal("failed to create the schema validator", err)
+	}
+
+	NewWithT(t).Expect(validator.validateComplianceEvents([]byte(`{"cluster":`))).To(MatchError(errSchemaRequestNotJSON))
+}
@@ -0,0 +1,168 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultKeyCacheCapacity is the default maximum number of entries in each database ID cache.
+	DefaultKeyCacheCapacity = 10000
+	// DefaultKeyCacheTTL is the default duration that an entry in a database ID cache is valid for.
+	DefaultKeyCacheTTL = time.Hour
+)
+
+// KeyCache is a size bounded, least recently used cache with an expiration on each entry. It is used to cache
+// database IDs and is safe for concurrent use.
+type KeyCache struct {
+	lock     sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[any]*list.Element
+	// order has the most recently used entry at the front.
+	order *list.List
+	// These are for KeyCache.Stats and aren't reset when the cache is cleared.
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// KeyCacheStats is a snapshot of the size and usage of a KeyCache.
+type KeyCacheStats struct {
+	Entries  int `json:"entries"`
+	Capacity int `json:"capacity"`
+	// Hits and Misses count the calls to Load. Loading an expired entry is a miss.
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// HitRatio is Hits divided by the total calls to Load, or 0 if Load wasn't called.
+	HitRatio float64 `json:"hit_ratio"` //nolint:tagliatelle
+	// Evictions counts the least recently used entries removed to stay within the capacity.
+	Evictions uint64 `json:"evictions"`
+}
+
+type keyCacheEntry struct {
+	key     any
+	value   any
+	expires time.Time
+}
+
+// NewKeyCache returns a KeyCache that holds at most capacity entries, each valid for ttl. A capacity less than 1
+// uses DefaultKeyCacheCapacity and a ttl less than or equal to 0 means entries don't expire.
+func NewKeyCache(capacity int, ttl time.Duration) *KeyCache {
+	if capacity < 1 {
+		capacity = DefaultKeyCacheCapacity
+	}
+
+	return &KeyCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  map[any]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Load returns the value stored for the key and whether it was found. Expired entries are removed and not returned.
+func (c *KeyCache) Load(key any) (any, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+
+		return nil, false
+	}
+
+	entry := element.Value.(*keyCacheEntry)
+
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		c.misses++
+
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits++
+
+	return entry.value, true
+}
+
+// Store sets the value for the key. If the cache is full, the least recently used entry is evicted.
+func (c *KeyCache) Store(key any, value any) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*keyCacheEntry)
+		entry.value = value
+		entry.expires = expires
+
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&keyCacheEntry{key: key, value: value, expires: expires})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*keyCacheEntry).key)
+		c.evictions++
+	}
+}
+
+// Delete removes the entry for the key if it exists.
+func (c *KeyCache) Delete(key any) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Len returns the number of entries in the cache, including those that have expired but not yet been removed.
+func (c *KeyCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.order.Len()
+}
+
+// Stats returns the current size of the cache and its usage since it was created.
+func (c *KeyCache) Stats() KeyCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stats := KeyCacheStats{
+		Entries:   c.order.Len(),
+		Capacity:  c.capacity,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+
+	if loads := c.hits + c.misses; loads > 0 {
+		stats.HitRatio = float64(c.hits) / float64(loads)
+	}
+
+	return stats
+}
+
+// Clear removes all entries from the cache.
+func (c *KeyCache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = map[any]*list.Element{}
+	c.order.Init()
+}
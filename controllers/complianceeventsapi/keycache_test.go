@@ -0,0 +1,119 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestKeyCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	cache := NewKeyCache(2, time.Hour)
+	cache.Store("a", int32(1))
+	cache.Store("b", int32(2))
+
+	// Use "a" so that "b" is the least recently used.
+	_, ok := cache.Load("a")
+	g.Expect(ok).To(BeTrue())
+
+	cache.Store("c", int32(3))
+	g.Expect(cache.Len()).To(Equal(2))
+
+	_, ok = cache.Load("b")
+	g.Expect(ok).To(BeFalse())
+
+	value, ok := cache.Load("a")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(value).To(Equal(int32(1)))
+
+	value, ok = cache.Load("c")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(value).To(Equal(int32(3)))
+}
+
+func TestKeyCacheExpiration(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	cache := NewKeyCache(10, time.Millisecond)
+	cache.Store("a", int32(1))
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok := cache.Load("a")
+	g.Expect(ok).To(BeFalse())
+	g.Expect(cache.Len()).To(Equal(0))
+}
+
+func TestKeyCacheClear(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	cache := NewKeyCache(10, 0)
+	cache.Store("a", int32(1))
+	cache.Store("b", int32(2))
+	cache.Clear()
+
+	g.Expect(cache.Len()).To(Equal(0))
+
+	_, ok := cache.Load("a")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestKeyCacheDelete(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	cache := NewKeyCache(10, 0)
+	cache.Store("a", int32(1))
+	cache.Store("b", int32(2))
+	cache.Delete("a")
+	cache.Delete("c")
+
+	g.Expect(cache.Len()).To(Equal(1))
+
+	_, ok := cache.Load("a")
+	g.Expect(ok).To(BeFalse())
+
+	value, ok := cache.Load("b")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(value).To(Equal(int32(2)))
+}
+
+func TestKeyCacheStats(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	cache := NewKeyCache(2, 0)
+	g.Expect(cache.Stats()).To(Equal(KeyCacheStats{Capacity: 2}))
+
+	cache.Store("a", int32(1))
+	cache.Store("b", int32(2))
+	cache.Store("c", int32(3))
+
+	_, _ = cache.Load("a")
+	_, _ = cache.Load("b")
+	_, _ = cache.Load("c")
+	_, _ = cache.Load("c")
+
+	cache.Clear()
+
+	g.Expect(cache.Stats()).To(Equal(KeyCacheStats{
+		Entries:   0,
+		Capacity:  2,
+		Hits:      3,
+		Misses:    1,
+		HitRatio:  0.75,
+		Evictions: 1,
+	}))
+}
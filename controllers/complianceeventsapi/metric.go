@@ -0,0 +1,206 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// inflightRequests is the number of requests currently being handled by the compliance events API.
+var inflightRequests atomic.Int64
+
+var (
+	inflightRequestsMetric = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "compliance_events_api_inflight_requests",
+			Help: "The number of requests currently being handled by the compliance events API",
+		},
+		func() float64 {
+			return float64(inflightRequests.Load())
+		},
+	)
+	requestDurationMetric = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "compliance_events_api_request_duration_seconds",
+			Help: "The time it takes the compliance events API to respond to a request",
+		},
+		[]string{"method", "path", "code"},
+	)
+	concurrencyLimitInUseMetric = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "compliance_events_api_concurrency_limit_in_use",
+			Help: "The number of requests holding a slot of the compliance events API's concurrent request limit",
+		},
+	)
+	eventsCreatedMetric = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "compliance_events_api_events_created_total",
+			Help: "The number of compliance events recorded through the compliance events API",
+		},
+	)
+	eventQueueDepthMetric = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "compliance_events_api_event_queue_depth",
+			Help: "The number of accepted compliance events waiting in the event queue to be recorded",
+		},
+	)
+	eventQueueDroppedMetric = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "compliance_events_api_event_queue_dropped_total",
+			Help: "The number of accepted compliance events in the event queue that failed to be recorded",
+		},
+	)
+	insertBatchSizeMetric = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "compliance_events_api_insert_batch_size",
+			Help:    "The number of compliance events recorded together by the insert batcher",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+		},
+	)
+	eventStreamClientsMetric = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "compliance_events_api_event_stream_clients",
+			Help: "The number of clients connected to the compliance events stream",
+		},
+	)
+	eventStreamDroppedMetric = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "compliance_events_api_event_stream_dropped_total",
+			Help: "The number of compliance events stream clients disconnected for falling behind",
+		},
+	)
+	webhookDeliveriesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "compliance_events_api_webhook_deliveries_total",
+			Help: "The number of compliance event webhook deliveries by result (success, failed, or dropped)",
+		},
+		[]string{"result"},
+	)
+	cacheHitsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "compliance_events_api_cache_hits_total",
+			Help: "The number of database ID lookups answered by the compliance events API cache",
+		},
+		[]string{"cache"},
+	)
+	cacheMissesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "compliance_events_api_cache_misses_total",
+			Help: "The number of database ID lookups not found in the compliance events API cache",
+		},
+		[]string{"cache"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(inflightRequestsMetric)
+	metrics.Registry.MustRegister(requestDurationMetric)
+	metrics.Registry.MustRegister(concurrencyLimitInUseMetric)
+	metrics.Registry.MustRegister(eventsCreatedMetric)
+	metrics.Registry.MustRegister(eventQueueDepthMetric)
+	metrics.Registry.MustRegister(eventQueueDroppedMetric)
+	metrics.Registry.MustRegister(insertBatchSizeMetric)
+	metrics.Registry.MustRegister(eventStreamClientsMetric)
+	metrics.Registry.MustRegister(eventStreamDroppedMetric)
+	metrics.Registry.MustRegister(webhookDeliveriesMetric)
+	metrics.Registry.MustRegister(cacheHitsMetric)
+	metrics.Registry.MustRegister(cacheMissesMetric)
+}
+
+// statusRecorder wraps an http.ResponseWriter to record the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap allows http.ResponseController to access the underlying http.ResponseWriter, such as for flushing.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// metricPath returns the route of the request path so that the path label has a bounded cardinality.
+func metricPath(path string) string {
+	switch {
+	case path == "/api/v1/compliance-events",
+		path == "/api/v1/compliance-events/stats",
+		path == "/api/v1/compliance-events/by-cluster",
+		path == "/api/v1/compliance-events/batch-get",
+		path == "/api/v1/compliance-events/stream",
+		path == "/api/v1/compliance-events/export",
+		path == "/api/v1/reports/compliance-events",
+		path == "/api/v1/clusters",
+		path == "/api/v1/parent-policies",
+		path == "/api/v1/openapi.json",
+		path == "/api/v1/admin/cache/flush",
+		path == "/api/v1/admin/cache/stats",
+		path == "/healthz",
+		path == "/livez",
+		path == "/readyz",
+		path == "/version":
+		return path
+	case strings.HasPrefix(path, "/api/v1/compliance-events/") && strings.HasSuffix(path, "/spec"):
+		return "/api/v1/compliance-events/{id}/spec"
+	case strings.HasPrefix(path, "/api/v1/compliance-events/"):
+		return "/api/v1/compliance-events/{id}"
+	case strings.HasPrefix(path, "/api/v1/clusters/") && strings.HasSuffix(path, "/history"):
+		return "/api/v1/clusters/{cluster_id}/policies/{policy_id}/history"
+	default:
+		return "other"
+	}
+}
+
+// metricMethod returns the request method if it's a standard HTTP method and "other" otherwise so that the method label
+// has a bounded cardinality, since clients can send any method.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet,
+		http.MethodHead,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+		http.MethodConnect,
+		http.MethodOptions,
+		http.MethodTrace:
+		return method
+	default:
+		return "other"
+	}
+}
+
+// inflightHandler counts the requests being handled by next in inflightRequests so that latency can be correlated with
+// concurrency.
+func inflightHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inflightRequests.Add(1)
+		defer inflightRequests.Add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// instrumentHandler records the duration of every request handled by next in requestDurationMetric.
+func instrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		requestDurationMetric.WithLabelValues(
+			metricMethod(r.Method), metricPath(r.URL.Path), strconv.Itoa(recorder.code),
+		).Observe(time.Since(start).Seconds())
+	})
+}
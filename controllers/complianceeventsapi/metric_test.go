@@ -0,0 +1,98 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMetricPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/api/v1/compliance-events", "/api/v1/compliance-events"},
+		{"/api/v1/compliance-events/12", "/api/v1/compliance-events/{id}"},
+		{"/api/v1/compliance-events/12/spec", "/api/v1/compliance-events/{id}/spec"},
+		{"/api/v1/compliance-events/stats", "/api/v1/compliance-events/stats"},
+		{"/api/v1/compliance-events/by-cluster", "/api/v1/compliance-events/by-cluster"},
+		{"/version", "/version"},
+		{"/api/v1/compliance-events/batch-get", "/api/v1/compliance-events/batch-get"},
+		{"/api/v1/compliance-events/stream", "/api/v1/compliance-events/stream"},
+		{"/api/v1/compliance-events/export", "/api/v1/compliance-events/export"},
+		{"/api/v1/reports/compliance-events", "/api/v1/reports/compliance-events"},
+		{"/api/v1/clusters", "/api/v1/clusters"},
+		{
+			"/api/v1/clusters/some-uuid/policies/3/history",
+			"/api/v1/clusters/{cluster_id}/policies/{policy_id}/history",
+		},
+		{"/api/v1/parent-policies", "/api/v1/parent-policies"},
+		{"/api/v1/openapi.json", "/api/v1/openapi.json"},
+		{"/api/v1/admin/cache/flush", "/api/v1/admin/cache/flush"},
+		{"/healthz", "/healthz"},
+		{"/livez", "/livez"},
+		{"/readyz", "/readyz"},
+		{"/something-else", "other"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.path, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+			g.Expect(metricPath(test.path)).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestMetricMethod(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		method   string
+		expected string
+	}{
+		{http.MethodGet, http.MethodGet},
+		{http.MethodPost, http.MethodPost},
+		{http.MethodOptions, http.MethodOptions},
+		{"get", "other"},
+		{"PROPFIND", "other"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.method, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+			g.Expect(metricMethod(test.method)).To(Equal(test.expected))
+		})
+	}
+}
+
+// TestInflightHandler isn't parallel since it reads the package level in-flight request counter.
+func TestInflightHandler(t *testing.T) {
+	g := NewWithT(t)
+
+	before := inflightRequests.Load()
+
+	var during int64
+
+	handler := inflightHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = inflightRequests.Load()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	g.Expect(during).To(Equal(before + 1))
+	g.Expect(inflightRequests.Load()).To(Equal(before))
+}
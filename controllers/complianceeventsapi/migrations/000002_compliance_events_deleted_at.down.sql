@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_compliance_events_deleted_at;
+
+ALTER TABLE compliance_events DROP COLUMN IF EXISTS deleted_at;
+
+COMMIT;
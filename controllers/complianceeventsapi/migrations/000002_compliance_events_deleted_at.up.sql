@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE compliance_events ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_compliance_events_deleted_at ON compliance_events (deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMIT;
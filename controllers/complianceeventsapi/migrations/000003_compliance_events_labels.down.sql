@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_compliance_events_labels;
+
+ALTER TABLE compliance_events DROP COLUMN IF EXISTS labels;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE compliance_events ADD COLUMN IF NOT EXISTS labels JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_compliance_events_labels ON compliance_events USING GIN (labels jsonb_path_ops);
+
+COMMIT;
@@ -0,0 +1,29 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPIDocument is the OpenAPI 3.0 document describing the compliance API. It must be kept in sync with the routes
+// registered in Start and the types they return.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// serveOpenAPIDocument serves the static OpenAPI document. It doesn't require authentication or a database connection.
+func serveOpenAPIDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+
+		return
+	}
+
+	if _, err := w.Write(openAPIDocument); err != nil {
+		log.Error(err, "Error writing the OpenAPI document")
+	}
+}
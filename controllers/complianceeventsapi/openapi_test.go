@@ -0,0 +1,48 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	document := map[string]any{}
+	g.Expect(json.Unmarshal(openAPIDocument, &document)).To(Succeed())
+	g.Expect(document).To(HaveKeyWithValue("openapi", HavePrefix("3.0")))
+
+	paths, ok := document["paths"].(map[string]any)
+	g.Expect(ok).To(BeTrue())
+
+	// Every route with a dedicated metric path label should be documented.
+	for _, path := range []string{
+		"/api/v1/compliance-events",
+		"/api/v1/compliance-events/stats",
+		"/api/v1/compliance-events/by-cluster",
+		"/api/v1/compliance-events/batch-get",
+		"/api/v1/compliance-events/stream",
+		"/api/v1/compliance-events/export",
+		"/api/v1/compliance-events/{id}/spec",
+		"/api/v1/reports/compliance-events",
+		"/api/v1/clusters",
+		"/api/v1/clusters/{cluster_id}/policies/{policy_id}/history",
+		"/api/v1/parent-policies",
+		"/api/v1/openapi.json",
+		"/healthz",
+		"/livez",
+		"/readyz",
+		"/version",
+	} {
+		g.Expect(metricPath(path)).To(Equal(path))
+		g.Expect(paths).To(HaveKey(path))
+	}
+
+	g.Expect(paths).To(HaveKey("/api/v1/compliance-events/{id}"))
+}
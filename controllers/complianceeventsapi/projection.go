@@ -0,0 +1,162 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// projectionOnlyFields are the values of the fields query argument that aren't also filter query arguments since they
+// are JSONB columns.
+var projectionOnlyFields = map[string]string{
+	"event.labels":   "compliance_events.labels",
+	"event.metadata": "compliance_events.metadata",
+	"policy.spec":    "policies.spec",
+}
+
+// projectedFieldColumn returns the SQL column of a value of the fields query argument. The values are the JSON paths in
+// a compliance event, which match the filter query arguments.
+func projectedFieldColumn(field string) (string, bool) {
+	if column, ok := projectionOnlyFields[field]; ok {
+		return column, true
+	}
+
+	column, ok := queryOptionsToSQL[field]
+
+	return column, ok
+}
+
+// parseFieldsQueryArg parses the comma separated value of the fields query argument. An ErrInvalidQueryArgValue error
+// is returned if a field is unknown.
+func parseFieldsQueryArg(value string) ([]string, error) {
+	fields := []string{}
+
+	for _, field := range splitQueryValue(value) {
+		if _, ok := projectedFieldColumn(field); !ok {
+			validFields := make([]string, 0, len(queryOptionsToSQL)+len(projectionOnlyFields))
+
+			for validField := range queryOptionsToSQL {
+				validFields = append(validFields, validField)
+			}
+
+			for validField := range projectionOnlyFields {
+				validFields = append(validFields, validField)
+			}
+
+			sort.Strings(validFields)
+
+			return nil, fmt.Errorf(
+				"%w: fields must be from %s but got: %s",
+				ErrInvalidQueryArgValue, strings.Join(validFields, ", "), field,
+			)
+		}
+
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+// generateProjectedSelectArgs returns the columns to select for the input fields. The compliance event ID and
+// timestamp are always selected first since they are needed for cursor based pagination.
+func generateProjectedSelectArgs(fields []string) []string {
+	selectArgs := []string{"compliance_events.id", "compliance_events.timestamp"}
+
+	for _, field := range fields {
+		column, _ := projectedFieldColumn(field)
+		selectArgs = append(selectArgs, column)
+	}
+
+	return selectArgs
+}
+
+// scanIntoProjectedEvent scans the row result from the SELECT query generated with generateProjectedSelectArgs. The
+// returned compliance event only has the ID and timestamp set. The returned map has only the input fields, nested the
+// same way as in a compliance event, such as {"cluster": {"name": "cluster1"}} for cluster.name.
+func scanIntoProjectedEvent(rows Scannable, fields []string) (*ComplianceEvent, map[string]any, error) {
+	ce := &ComplianceEvent{}
+
+	scanArgs := []any{&ce.EventID, &ce.Event.Timestamp}
+	values := make([]any, 0, len(fields))
+
+	for _, field := range fields {
+		column, _ := projectedFieldColumn(field)
+
+		var value any
+
+		switch column {
+		case "compliance_events.id", "parent_policies.id", "policies.id":
+			value = &sql.NullInt32{}
+		case "compliance_events.timestamp":
+			value = &sql.NullTime{}
+		case "compliance_events.labels", "compliance_events.metadata", "policies.spec":
+			value = &[]byte{}
+		case "parent_policies.categories", "parent_policies.controls", "parent_policies.standards":
+			value = &pq.StringArray{}
+		default:
+			value = &sql.NullString{}
+		}
+
+		values = append(values, value)
+		scanArgs = append(scanArgs, value)
+	}
+
+	if err := rows.Scan(scanArgs...); err != nil {
+		return nil, nil, err
+	}
+
+	projected := map[string]any{}
+
+	for i, field := range fields {
+		var value any
+
+		switch typedValue := values[i].(type) {
+		case *sql.NullInt32:
+			if typedValue.Valid {
+				value = typedValue.Int32
+			}
+		case *sql.NullTime:
+			if typedValue.Valid {
+				value = typedValue.Time
+			}
+		case *sql.NullString:
+			if typedValue.Valid {
+				value = typedValue.String
+			}
+		case *[]byte:
+			if *typedValue != nil {
+				value = json.RawMessage(*typedValue)
+			}
+		case *pq.StringArray:
+			if *typedValue != nil {
+				value = []string(*typedValue)
+			}
+		}
+
+		parent, key, nested := strings.Cut(field, ".")
+		if !nested {
+			projected[field] = value
+
+			continue
+		}
+
+		parentMap, ok := projected[parent].(map[string]any)
+		if !ok {
+			parentMap = map[string]any{}
+			projected[parent] = parentMap
+		}
+
+		parentMap[key] = value
+	}
+
+	return ce, projected, nil
+}
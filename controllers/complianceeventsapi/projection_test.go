@@ -0,0 +1,141 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// fakeRow is a Scannable that returns the input values as if they came from the database driver.
+type fakeRow []any
+
+func (f fakeRow) Scan(dest ...any) error {
+	if len(dest) != len(f) {
+		return errors.New("the number of destinations doesn't match the number of columns")
+	}
+
+	for i, value := range f {
+		switch typedDest := dest[i].(type) {
+		case sql.Scanner:
+			if err := typedDest.Scan(value); err != nil {
+				return err
+			}
+		case *int32:
+			*typedDest = value.(int32)
+		case *time.Time:
+			*typedDest = value.(time.Time)
+		case *[]byte:
+			if value != nil {
+				*typedDest = value.([]byte)
+			} else {
+				*typedDest = nil
+			}
+		default:
+			return errors.New("unsupported destination type")
+		}
+	}
+
+	return nil
+}
+
+func TestParseFieldsQueryArg(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		value    string
+		expected []string
+		errMsg   string
+	}{
+		"nested fields": {
+			value:    "id,cluster.name,event.compliance",
+			expected: []string{"id", "cluster.name", "event.compliance"},
+		},
+		"JSONB fields": {
+			value:    "policy.spec,event.metadata",
+			expected: []string{"policy.spec", "event.metadata"},
+		},
+		"duplicates": {
+			value:    "id,id,cluster.name",
+			expected: []string{"id", "cluster.name"},
+		},
+		"unknown field": {
+			value:  "id,compliance",
+			errMsg: "but got: compliance",
+		},
+		"unknown nested field": {
+			value:  "policy.spec_hash",
+			errMsg: "but got: policy.spec_hash",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			fields, err := parseFieldsQueryArg(test.value)
+
+			if test.errMsg != "" {
+				g.Expect(err).To(MatchError(ErrInvalidQueryArgValue))
+				g.Expect(err.Error()).To(ContainSubstring(test.errMsg))
+
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(fields).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestGenerateProjectedSelectArgs(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	selectArgs := generateProjectedSelectArgs([]string{"cluster.name", "policy.spec"})
+
+	g.Expect(selectArgs).To(Equal([]string{
+		"compliance_events.id", "compliance_events.timestamp", "clusters.name", "policies.spec",
+	}))
+}
+
+func TestScanIntoProjectedEvent(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	timestamp := time.Date(2023, 4, 4, 4, 4, 4, 0, time.UTC)
+	fields := []string{
+		"id", "cluster.name", "event.compliance", "parent_policy.name", "parent_policy.categories", "policy.spec",
+	}
+
+	row := fakeRow{
+		int32(3), timestamp, // The ID and timestamp that are always selected
+		int64(3), "cluster1", "Compliant", nil, nil, []byte(`{"test": "spec"}`),
+	}
+
+	ce, projected, err := scanIntoProjectedEvent(row, fields)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ce.EventID).To(Equal(int32(3)))
+	g.Expect(ce.Event.Timestamp).To(Equal(timestamp))
+
+	projectedJSON, err := json.Marshal(projected)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(projectedJSON).To(MatchJSON(`{
+		"id": 3,
+		"cluster": {"name": "cluster1"},
+		"event": {"compliance": "Compliant"},
+		"parent_policy": {"name": null, "categories": null},
+		"policy": {"spec": {"test": "spec"}}
+	}`))
+}
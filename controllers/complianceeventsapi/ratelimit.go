@@ -0,0 +1,118 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultRateLimitBurst is the default number of requests a client can make at once before being rate limited.
+	DefaultRateLimitBurst = 20
+	// rateLimiterCapacity is the maximum number of clients tracked by the rate limiter. The least recently seen
+	// clients are forgotten first.
+	rateLimiterCapacity = 10000
+	// rateLimiterTTL is how long an idle client is tracked by the rate limiter.
+	rateLimiterTTL = 10 * time.Minute
+)
+
+// clientRateLimiter is a token bucket rate limiter per client. The number of clients tracked is bounded.
+type clientRateLimiter struct {
+	lock     sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters *KeyCache
+}
+
+func newClientRateLimiter(limit float64, burst int) *clientRateLimiter {
+	return &clientRateLimiter{
+		limit:    rate.Limit(limit),
+		burst:    burst,
+		limiters: NewKeyCache(rateLimiterCapacity, rateLimiterTTL),
+	}
+}
+
+// reserve takes a token for the client and returns how long the client must wait before the request is allowed. A
+// zero duration means the request is allowed.
+func (c *clientRateLimiter) reserve(client string, now time.Time) time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var limiter *rate.Limiter
+
+	if cached, ok := c.limiters.Load(client); ok {
+		limiter = cached.(*rate.Limiter)
+	} else {
+		limiter = rate.NewLimiter(c.limit, c.burst)
+		c.limiters.Store(client, limiter)
+	}
+
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return time.Second
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		// The request is rejected, so don't count it against the client.
+		reservation.CancelAt(now)
+	}
+
+	return delay
+}
+
+// getRateLimitClient returns the key identifying the client of the request. The identity of the user is used if the
+// bearer token was already verified by the Kubernetes API, since many clients may share an IP address through a proxy.
+// Otherwise, the remote IP address is used so that sending a new unverified token on every request doesn't get around
+// the limit.
+func getRateLimitClient(r *http.Request) string {
+	if token := parseToken(r); token != "" {
+		if identity, ok := getAuthenticatedIdentity(token); ok {
+			return "user/" + identity
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip/" + host
+}
+
+// rateLimitHandler rejects requests with a 429 status code and a Retry-After header when the client exceeds limit
+// requests per second with the given burst. A limit less than or equal to 0 disables rate limiting. The health
+// endpoints are never rate limited.
+func rateLimitHandler(limit float64, burst int, next http.Handler) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+
+	limiter := newClientRateLimiter(limit, burst)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/livez" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		delay := limiter.reserve(getRateLimitClient(r), time.Now())
+		if delay > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(delay.Seconds()))))
+			writeErrMsgJSON(w, "Too many requests", http.StatusTooManyRequests)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
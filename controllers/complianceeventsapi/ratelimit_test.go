@@ -0,0 +1,148 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestClientRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	limiter := newClientRateLimiter(1, 2)
+	now := time.Now()
+
+	g.Expect(limiter.reserve("client-a", now)).To(BeZero())
+	g.Expect(limiter.reserve("client-a", now)).To(BeZero())
+	g.Expect(limiter.reserve("client-a", now)).To(BeNumerically(">", 0))
+
+	// Other clients have their own bucket
+	g.Expect(limiter.reserve("client-b", now)).To(BeZero())
+
+	// A rejected request doesn't use a token, so the client can make a request after a second
+	g.Expect(limiter.reserve("client-a", now.Add(time.Second))).To(BeZero())
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	handler := rateLimitHandler(0.001, 1, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// The tokens are unique to this test since the authenticated tokens are shared by the package.
+	recordAuthenticatedToken("rate-limit-handler-token-a")
+	recordAuthenticatedToken("rate-limit-handler-token-b")
+
+	send := func(path string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.10:1234"
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	g.Expect(send("/api/v1/compliance-events", "rate-limit-handler-token-a").Code).To(Equal(http.StatusOK))
+
+	resp := send("/api/v1/compliance-events", "rate-limit-handler-token-a")
+	g.Expect(resp.Code).To(Equal(http.StatusTooManyRequests))
+	g.Expect(resp.Header().Get("Retry-After")).ToNot(BeEmpty())
+
+	// Authenticated clients behind the same IP address have their own bucket.
+	g.Expect(send("/api/v1/compliance-events", "rate-limit-handler-token-b").Code).To(Equal(http.StatusOK))
+	g.Expect(send("/api/v1/compliance-events", "").Code).To(Equal(http.StatusOK))
+	g.Expect(send("/api/v1/compliance-events", "").Code).To(Equal(http.StatusTooManyRequests))
+
+	g.Expect(send("/healthz", "rate-limit-handler-token-a").Code).To(Equal(http.StatusOK))
+	g.Expect(send("/livez", "rate-limit-handler-token-a").Code).To(Equal(http.StatusOK))
+	g.Expect(send("/readyz", "rate-limit-handler-token-a").Code).To(Equal(http.StatusOK))
+}
+
+func TestRateLimitHandlerRotatingTokens(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	handler := rateLimitHandler(0.001, 2, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := []int{}
+
+	// Tokens that were never verified share the bucket of the IP address, so a new token per request is throttled.
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events", nil)
+		req.RemoteAddr = "192.0.2.20:1234"
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer rate-limit-rotating-token-%d", i))
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		codes = append(codes, recorder.Code)
+	}
+
+	g.Expect(codes).To(Equal([]int{
+		http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests,
+	}))
+}
+
+func TestGetRateLimitClient(t *testing.T) {
+	t.Parallel()
+
+	recordAuthenticatedToken("rate-limit-client-verified")
+
+	tests := []struct {
+		name     string
+		token    string
+		expected string
+	}{
+		{"no token", "", "ip/192.0.2.30"},
+		{"unverified token", "rate-limit-client-unverified", "ip/192.0.2.30"},
+		{"verified token", "rate-limit-client-verified", "user/" + hashToken("rate-limit-client-verified")},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events", nil)
+			req.RemoteAddr = "192.0.2.30:1234"
+
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			g.Expect(getRateLimitClient(req)).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestRateLimitHandlerDisabled(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+
+	g.Expect(rateLimitHandler(0, 1, next)).To(BeAssignableToTypeOf(next))
+}
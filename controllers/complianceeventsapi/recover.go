@@ -0,0 +1,70 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// recoverHandler recovers from a panic in next, logs it with the stack trace, and responds with a 500 JSON error so
+// that a bug in a single handler doesn't drop the connection without a response. If next already started the
+// response, the connection is aborted instead since the response can't be replaced. It must be wrapped by
+// requestIDHandler so that the log message includes the request ID.
+func recoverHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseStartedWriter{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+
+			// Handlers panic with http.ErrAbortHandler to intentionally abort the response.
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			ctrl.LoggerFrom(r.Context()).Error(
+				fmt.Errorf("%v", p),
+				"Recovered from a panic in the handler",
+				"method", r.Method, "path", r.URL.Path, "stack", string(debug.Stack()),
+			)
+
+			if rw.started {
+				panic(http.ErrAbortHandler)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// responseStartedWriter wraps an http.ResponseWriter to record if the response was started.
+type responseStartedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (rw *responseStartedWriter) WriteHeader(code int) {
+	rw.started = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseStartedWriter) Write(b []byte) (int, error) {
+	rw.started = true
+
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to access the underlying http.ResponseWriter, such as for flushing.
+func (rw *responseStartedWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
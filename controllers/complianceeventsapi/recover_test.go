@@ -0,0 +1,53 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRecoverHandler(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	handler := requestIDHandler(recoverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		var event *ComplianceEvent
+
+		_ = event.EventID
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events/1", nil)
+	req.Header.Set(requestIDHeader, "my-request-1")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	g.Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+	g.Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+	g.Expect(recorder.Body.String()).To(Equal(`{"message":"Internal Error","request_id":"my-request-1"}`))
+}
+
+func TestRecoverHandlerResponseStarted(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	handler := recoverHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+
+		panic("unexpected")
+	}))
+
+	recorder := httptest.NewRecorder()
+
+	// The response can't be replaced, so the connection is aborted.
+	g.Expect(func() {
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events", nil))
+	}).To(PanicWith(http.ErrAbortHandler))
+	g.Expect(recorder.Code).To(Equal(http.StatusOK))
+}
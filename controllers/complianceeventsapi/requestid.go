@@ -0,0 +1,77 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	requestIDHeader = "X-Request-Id"
+	// maxRequestIDLength is the longest client provided request ID that is accepted. Longer IDs are replaced with a
+	// generated one to avoid bloating the logs.
+	maxRequestIDLength = 128
+)
+
+// requestIDHandler sets the X-Request-Id response header to the request ID provided by the client or to a generated
+// one. The request context gets a logger with the request ID so that log messages can be correlated with a request.
+// This is used instead of distributed tracing since a request only spans this server and its database queries.
+func requestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+
+		ctx := ctrl.LoggerInto(r.Context(), log.WithValues("requestID", requestID))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestLogHandler logs every request handled by next at the debug level with its status code and duration. The
+// health endpoints aren't logged since they're polled by the probes. It must be wrapped by requestIDHandler so that the
+// log messages include the request ID.
+func requestLogHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqLog := ctrl.LoggerFrom(r.Context()).V(1)
+		if !reqLog.Enabled() || r.URL.Path == "/healthz" || r.URL.Path == "/livez" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+
+		reqLog.Info("Handling the request", "method", r.Method, "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+
+		next.ServeHTTP(recorder, r)
+
+		reqLog.Info(
+			"Handled the request",
+			"method", r.Method, "path", r.URL.Path, "code", recorder.code, "duration", time.Since(start).String(),
+		)
+	})
+}
+
+// validRequestID returns true if the request ID is not empty, not too long, and only has printable ASCII characters.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, char := range requestID {
+		if char < '!' || char > '~' {
+			return false
+		}
+	}
+
+	return true
+}
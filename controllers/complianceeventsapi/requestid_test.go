@@ -0,0 +1,140 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/gomega"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		requestID string
+		kept      bool
+	}{
+		{"client provided", "my-request-1", true},
+		{"not provided", "", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"has spaces", "my request", false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			handler := requestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				writeErrMsgJSON(w, "Not found", http.StatusNotFound)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events/1", nil)
+			if test.requestID != "" {
+				req.Header.Set(requestIDHeader, test.requestID)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			requestID := recorder.Header().Get(requestIDHeader)
+			g.Expect(requestID).ToNot(BeEmpty())
+
+			if test.kept {
+				g.Expect(requestID).To(Equal(test.requestID))
+			} else {
+				g.Expect(requestID).ToNot(Equal(test.requestID))
+			}
+
+			g.Expect(recorder.Body.String()).To(
+				Equal(`{"message":"Not found","request_id":"` + requestID + `"}`),
+			)
+		})
+	}
+}
+
+func TestRequestLogHandler(t *testing.T) {
+	t.Parallel()
+
+	for _, verbosity := range []int{0, 1} {
+		verbosity := verbosity
+
+		t.Run(fmt.Sprintf("verbosity %d", verbosity), func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			var logLines []string
+
+			logger := funcr.New(
+				func(_, args string) { logLines = append(logLines, args) }, funcr.Options{Verbosity: verbosity},
+			)
+
+			handler := requestLogHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				writeErrMsgJSON(w, "Not found", http.StatusNotFound)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events/1", nil)
+			req = req.WithContext(ctrl.LoggerInto(req.Context(), logger))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			g.Expect(recorder.Code).To(Equal(http.StatusNotFound))
+
+			if verbosity == 0 {
+				g.Expect(logLines).To(BeEmpty())
+
+				return
+			}
+
+			g.Expect(logLines).To(HaveLen(2))
+			g.Expect(logLines[0]).To(ContainSubstring(`"msg"="Handling the request"`))
+			g.Expect(logLines[1]).To(ContainSubstring(`"msg"="Handled the request"`))
+			g.Expect(logLines[1]).To(ContainSubstring(`"path"="/api/v1/compliance-events/1"`))
+			g.Expect(logLines[1]).To(ContainSubstring(`"code"=404`))
+		})
+	}
+}
+
+func TestRequestLogHandlerSkipsProbes(t *testing.T) {
+	t.Parallel()
+
+	for _, path := range []string{"/healthz", "/livez", "/readyz"} {
+		path := path
+
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			var logLines []string
+
+			logger := funcr.New(func(_, args string) { logLines = append(logLines, args) }, funcr.Options{Verbosity: 1})
+
+			handler := requestLogHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req = req.WithContext(ctrl.LoggerInto(req.Context(), logger))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			g.Expect(recorder.Code).To(Equal(http.StatusOK))
+			g.Expect(logLines).To(BeEmpty())
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// requestTimeoutHandler responds with a 503 JSON error if next doesn't finish within timeout. The request context of
+// next is canceled at the deadline so that its database queries are canceled. The response of next is buffered until it
+// finishes, so streamed responses, as determined by isStreamingRequest, are passed through without a timeout and are
+// only limited by the write timeout of the server. A timeout less than or equal to 0 returns next.
+//
+// When the DBQueryTimeout option is shorter than timeout, a slow database query gets its 504 response from
+// withDBTimeout before this deadline is reached.
+func requestTimeoutHandler(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isStreamingRequest(r) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		// Headers set by the outer middleware, such as the request ID, are kept on both the buffered and the timeout
+		// response.
+		tw := &timeoutResponseWriter{w: w, header: w.Header().Clone(), code: http.StatusOK}
+
+		done := make(chan struct{})
+		panicChan := make(chan any, 1)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicChan <- p
+				}
+			}()
+
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			// Let the server handle the panic the same way as without the timeout.
+			panic(p)
+		case <-done:
+			tw.lock.Lock()
+			defer tw.lock.Unlock()
+
+			dst := w.Header()
+			for key, values := range tw.header {
+				dst[key] = values
+			}
+
+			w.WriteHeader(tw.code)
+
+			if _, err := w.Write(tw.buf.Bytes()); err != nil {
+				log.Error(err, "error writing the response", "requestID", w.Header().Get(requestIDHeader))
+			}
+		case <-ctx.Done():
+			tw.lock.Lock()
+			defer tw.lock.Unlock()
+
+			tw.timedOut = true
+
+			// The client disconnected, so there is no one to respond to.
+			if r.Context().Err() != nil {
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			writeErrMsgJSON(w, "The request did not complete in time", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// isStreamingRequest returns true if the response of the request is streamed to the client as it's generated, which
+// are the CSV and NDJSON formats of the compliance events, the export, and the compliance events stream.
+func isStreamingRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/v1/reports/compliance-events", "/api/v1/compliance-events/stream",
+		"/api/v1/compliance-events/export":
+		return true
+	case "/api/v1/compliance-events":
+		if r.Method != http.MethodGet {
+			return false
+		}
+
+		format, err := getResponseFormat(r)
+
+		return err == nil && format != "json"
+	default:
+		return false
+	}
+}
+
+// timeoutResponseWriter buffers the response of a handler wrapped by requestTimeoutHandler. Writes after the timeout
+// are discarded and return http.ErrHandlerTimeout.
+type timeoutResponseWriter struct {
+	w        http.ResponseWriter
+	header   http.Header
+	lock     sync.Mutex
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+	// wroteHeader is set once the status code is set, either explicitly or by the first write.
+	wroteHeader bool
+}
+
+func (t *timeoutResponseWriter) Header() http.Header {
+	return t.header
+}
+
+func (t *timeoutResponseWriter) WriteHeader(code int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.timedOut || t.wroteHeader {
+		return
+	}
+
+	t.wroteHeader = true
+	t.code = code
+}
+
+func (t *timeoutResponseWriter) Write(p []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	t.wroteHeader = true
+
+	return t.buf.Write(p)
+}
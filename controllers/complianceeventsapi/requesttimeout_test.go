@@ -0,0 +1,109 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRequestTimeoutHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		timeout      time.Duration
+		url          string
+		handler      http.HandlerFunc
+		expectedCode int
+		expectedBody string
+	}{
+		"timed out": {
+			timeout: time.Millisecond,
+			url:     "/api/v1/compliance-events/1",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+
+				// This is discarded since the timeout response was already sent
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+			},
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"message": "The request did not complete in time", "request_id": "some-id"}`,
+		},
+		"finished before the deadline": {
+			timeout: time.Minute,
+			url:     "/api/v1/compliance-events/1",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(`{"id": 1}`))
+			},
+			expectedCode: http.StatusCreated,
+			expectedBody: `{"id": 1}`,
+		},
+		"streamed response": {
+			timeout: time.Millisecond,
+			url:     "/api/v1/compliance-events?format=ndjson",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				time.Sleep(10 * time.Millisecond)
+
+				_, _ = w.Write([]byte(`{"id": 1}`))
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id": 1}`,
+		},
+		"disabled": {
+			timeout: 0,
+			url:     "/api/v1/compliance-events/1",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				time.Sleep(10 * time.Millisecond)
+
+				_, _ = w.Write([]byte(`{"id": 1}`))
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id": 1}`,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			recorder := httptest.NewRecorder()
+			recorder.Header().Set(requestIDHeader, "some-id")
+
+			requestTimeoutHandler(test.timeout, test.handler).ServeHTTP(
+				recorder, httptest.NewRequest(http.MethodGet, test.url, nil),
+			)
+
+			g.Expect(recorder.Code).To(Equal(test.expectedCode))
+			g.Expect(recorder.Header().Get(requestIDHeader)).To(Equal("some-id"))
+			g.Expect(recorder.Body.String()).To(MatchJSON(test.expectedBody))
+		})
+	}
+}
+
+func TestRequestTimeoutHandlerHeaders(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	handler := requestTimeoutHandler(time.Minute, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		w.WriteHeader(http.StatusNotModified)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events/1", nil))
+
+	g.Expect(recorder.Code).To(Equal(http.StatusNotModified))
+	g.Expect(recorder.Header().Get("ETag")).To(Equal(`"abc"`))
+	g.Expect(recorder.Body.Len()).To(Equal(0))
+}
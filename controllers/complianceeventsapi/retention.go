@@ -0,0 +1,105 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultRetentionInterval is the default time between purges of compliance events older than the retention
+	// period.
+	DefaultRetentionInterval = time.Hour
+	// DefaultRetentionBatchSize is the default maximum number of compliance events deleted in a single statement.
+	DefaultRetentionBatchSize = 1000
+)
+
+// runRetention periodically purges the compliance events older than the RetentionPeriod option until ctx is closed.
+// It returns immediately if the RetentionPeriod option is not set.
+func (s *ComplianceAPIServer) runRetention(ctx context.Context, serverContext *ComplianceServerCtx) {
+	if s.options.RetentionPeriod <= 0 {
+		return
+	}
+
+	log.Info(
+		"Starting the compliance events retention job",
+		"retentionPeriod", s.options.RetentionPeriod.String(),
+		"interval", s.options.RetentionInterval.String(),
+	)
+
+	ticker := time.NewTicker(s.options.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		cutoff := time.Now().UTC().Add(-s.options.RetentionPeriod)
+
+		deleted, err := s.purgeOldComplianceEvents(ctx, serverContext, cutoff)
+
+		switch {
+		case errors.Is(err, errDBUnavailable):
+			log.Info("Skipped purging old compliance events since the database is unavailable")
+		case err != nil:
+			log.Error(err, "Failed to purge old compliance events", getPqErrKeyVals(err, "deleted", deleted)...)
+		default:
+			log.Info("Purged old compliance events", "deleted", deleted, "olderThan", cutoff.Format(time.RFC3339))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeOldComplianceEvents deletes the compliance events with a timestamp before cutoff and returns how many were
+// deleted. The deletes are batched by the RetentionBatchSize option to avoid holding locks on the table for a long
+// time. An errDBUnavailable error is returned if the database connection isn't established.
+func (s *ComplianceAPIServer) purgeOldComplianceEvents(
+	ctx context.Context, serverContext *ComplianceServerCtx, cutoff time.Time,
+) (int64, error) {
+	var deleted int64
+
+	for ctx.Err() == nil {
+		count, err := s.purgeComplianceEventsBatch(ctx, serverContext, cutoff)
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += count
+
+		if count < int64(s.options.RetentionBatchSize) {
+			break
+		}
+	}
+
+	return deleted, nil
+}
+
+// purgeComplianceEventsBatch deletes up to the RetentionBatchSize option of compliance events with a timestamp before
+// cutoff and returns how many were deleted.
+func (s *ComplianceAPIServer) purgeComplianceEventsBatch(
+	ctx context.Context, serverContext *ComplianceServerCtx, cutoff time.Time,
+) (int64, error) {
+	// The lock is only held per batch so that the database connection can be replaced between batches.
+	serverContext.Lock.RLock()
+	defer serverContext.Lock.RUnlock()
+
+	if serverContext.DB == nil {
+		return 0, errDBUnavailable
+	}
+
+	result, err := serverContext.DB.ExecContext(
+		ctx,
+		"DELETE FROM compliance_events WHERE id IN "+
+			"(SELECT id FROM compliance_events WHERE timestamp < $1 LIMIT $2)",
+		cutoff, s.options.RetentionBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
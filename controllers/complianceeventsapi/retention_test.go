@@ -0,0 +1,208 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// retentionDriver is a database/sql driver with a compliance_events table of only timestamps. It runs the retention
+// DELETE statement by deleting up to the limit of the timestamps that match the comparison in the query.
+type retentionDriver struct {
+	lock       sync.Mutex
+	timestamps []time.Time
+	deletes    int
+}
+
+func (d *retentionDriver) Open(string) (driver.Conn, error) {
+	return &retentionConn{driver: d}, nil
+}
+
+func (d *retentionDriver) remaining() []time.Time {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return append([]time.Time{}, d.timestamps...)
+}
+
+func (d *retentionDriver) deleteCount() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.deletes
+}
+
+type retentionConn struct {
+	driver *retentionDriver
+}
+
+func (c *retentionConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !strings.HasPrefix(query, "DELETE FROM compliance_events") || len(args) != 2 {
+		return nil, errors.New("unexpected query: " + query)
+	}
+
+	cutoff, _ := args[0].Value.(time.Time)
+	limit, _ := args[1].Value.(int64)
+
+	var matches func(timestamp time.Time) bool
+
+	switch {
+	case strings.Contains(query, "timestamp < $1"):
+		matches = func(timestamp time.Time) bool { return timestamp.Before(cutoff) }
+	case strings.Contains(query, "timestamp <= $1"):
+		matches = func(timestamp time.Time) bool { return !timestamp.After(cutoff) }
+	default:
+		return nil, errors.New("unexpected timestamp comparison: " + query)
+	}
+
+	c.driver.lock.Lock()
+	defer c.driver.lock.Unlock()
+
+	c.driver.deletes++
+
+	kept := []time.Time{}
+	deleted := int64(0)
+
+	for _, timestamp := range c.driver.timestamps {
+		if deleted < limit && matches(timestamp) {
+			deleted++
+
+			continue
+		}
+
+		kept = append(kept, timestamp)
+	}
+
+	c.driver.timestamps = kept
+
+	return driver.RowsAffected(deleted), nil
+}
+
+func (c *retentionConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *retentionConn) Close() error {
+	return nil
+}
+
+func (c *retentionConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type retentionConnector struct {
+	driver *retentionDriver
+}
+
+func (c retentionConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c retentionConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// newRetentionDB returns a connection pool with a compliance_events table of the timestamps.
+func newRetentionDB(t *testing.T, timestamps ...time.Time) (*sql.DB, *retentionDriver) {
+	t.Helper()
+
+	retentionDrv := &retentionDriver{timestamps: timestamps}
+
+	db := sql.OpenDB(retentionConnector{driver: retentionDrv})
+
+	t.Cleanup(func() { db.Close() })
+
+	return db, retentionDrv
+}
+
+func TestPurgeOldComplianceEventsCutoff(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	cutoff := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	db, retentionDrv := newRetentionDB(
+		t, cutoff.Add(-time.Hour), cutoff.Add(-time.Nanosecond), cutoff, cutoff.Add(time.Hour),
+	)
+
+	server := &ComplianceAPIServer{options: ComplianceAPIServerOptions{RetentionBatchSize: 10}}
+
+	deleted, err := server.purgeOldComplianceEvents(context.Background(), &ComplianceServerCtx{DB: db}, cutoff)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(deleted).To(Equal(int64(2)))
+
+	// A compliance event exactly at the cutoff is kept.
+	g.Expect(retentionDrv.remaining()).To(Equal([]time.Time{cutoff, cutoff.Add(time.Hour)}))
+}
+
+func TestPurgeOldComplianceEventsBatches(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	cutoff := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	timestamps := []time.Time{cutoff.Add(time.Minute)}
+
+	for i := 1; i <= 5; i++ {
+		timestamps = append(timestamps, cutoff.Add(-time.Duration(i)*time.Minute))
+	}
+
+	db, retentionDrv := newRetentionDB(t, timestamps...)
+
+	server := &ComplianceAPIServer{options: ComplianceAPIServerOptions{RetentionBatchSize: 2}}
+
+	deleted, err := server.purgeOldComplianceEvents(context.Background(), &ComplianceServerCtx{DB: db}, cutoff)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(deleted).To(Equal(int64(5)))
+	g.Expect(retentionDrv.remaining()).To(Equal([]time.Time{cutoff.Add(time.Minute)}))
+
+	// Two full batches and a partial batch, which ends the purge.
+	g.Expect(retentionDrv.deleteCount()).To(Equal(3))
+}
+
+func TestPurgeOldComplianceEventsNoDB(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	server := &ComplianceAPIServer{options: ComplianceAPIServerOptions{RetentionBatchSize: 10}}
+
+	deleted, err := server.purgeOldComplianceEvents(context.Background(), &ComplianceServerCtx{}, time.Now())
+	g.Expect(err).To(MatchError(errDBUnavailable))
+	g.Expect(deleted).To(BeZero())
+}
+
+func TestRunRetentionDisabled(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	db, retentionDrv := newRetentionDB(t, time.Now().Add(-365*24*time.Hour))
+
+	server := &ComplianceAPIServer{
+		options: ComplianceAPIServerOptions{RetentionInterval: time.Hour, RetentionBatchSize: 10},
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		// The context is never closed, so this only returns because retention is disabled.
+		server.runRetention(context.Background(), &ComplianceServerCtx{DB: db})
+	}()
+
+	g.Eventually(done, "5s").Should(BeClosed())
+	g.Expect(retentionDrv.deleteCount()).To(BeZero())
+	g.Expect(retentionDrv.remaining()).To(HaveLen(1))
+}
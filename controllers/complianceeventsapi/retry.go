@@ -0,0 +1,121 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// DefaultDBRetries is the default number of times a transaction is retried after a transient database error.
+	DefaultDBRetries = 3
+	// DefaultDBRetryBaseDelay is the default delay before the first retry of a transaction.
+	DefaultDBRetryBaseDelay = 100 * time.Millisecond
+)
+
+// inTransaction runs fn in a database transaction and commits it if fn doesn't return an error.
+func inTransaction(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// This is a no-op if the transaction was committed.
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// retryTransientDBErrors calls fn until it succeeds, it returns an error that isn't transient, or the retries are
+// exhausted. The delay between attempts starts at the DBRetryBaseDelay option and doubles each time.
+func (s *ComplianceAPIServer) retryTransientDBErrors(ctx context.Context, fn func() error) error {
+	reqLog := ctrl.LoggerFrom(ctx)
+	delay := s.options.DBRetryBaseDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransientDBError(err) || attempt > s.options.DBRetries {
+			return err
+		}
+
+		reqLog.V(2).Info(
+			"Retrying after a transient database error", "attempt", attempt, "delay", delay.String(), "error", err.Error(),
+		)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// isTransientDBError returns true if the error is due to a lost or unavailable database connection. Errors such as
+// constraint violations are not transient since retrying won't change the result.
+func isTransientDBError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	if code := getSQLState(err); code != "" {
+		switch code {
+		case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+			return true
+		}
+
+		// Class 08 is for connection exceptions
+		return strings.HasPrefix(code, "08")
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
+
+// retryStaleForeignKeys calls fn and if it returns a foreign key violation, the cached database IDs of the input
+// compliance events are removed and fn is called once more. This recovers from cached IDs of rows that were deleted
+// from the database, since fn will then look up or recreate the rows. fn must set the foreign keys with
+// setForeignKeys in a new transaction each time it's called.
+func retryStaleForeignKeys(
+	ctx context.Context, serverContext *ComplianceServerCtx, reqEvents []*ComplianceEvent, fn func() error,
+) error {
+	err := fn()
+	if !isForeignKeyViolation(err) {
+		return err
+	}
+
+	ctrl.LoggerFrom(ctx).Info(
+		"Retrying after a foreign key violation since the cached database IDs may refer to deleted rows",
+		"error", err.Error(),
+	)
+
+	for _, reqEvent := range reqEvents {
+		uncacheForeignKeys(serverContext, reqEvent)
+	}
+
+	return fn()
+}
+
+// isForeignKeyViolation returns true if the error is a foreign key constraint violation.
+func isForeignKeyViolation(err error) bool {
+	return getSQLState(err) == postgresForeignKeyViolationCode
+}
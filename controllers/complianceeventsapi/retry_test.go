@@ -0,0 +1,70 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+	. "github.com/onsi/gomega"
+)
+
+func TestIsTransientDBError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"bad connection", fmt.Errorf("wrapped: %w", driver.ErrBadConn), true},
+		{"connection reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"unique violation", &pq.Error{Code: postgresUniqueViolationCode}, false},
+		{"duplicate compliance event", errDuplicateComplianceEvent, false},
+		{"no rows", sql.ErrNoRows, false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+			g.Expect(isTransientDBError(test.err)).To(Equal(test.transient))
+		})
+	}
+}
+
+func TestIsForeignKeyViolation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		violation bool
+	}{
+		{"foreign key violation", &pq.Error{Code: postgresForeignKeyViolationCode}, true},
+		{"wrapped", fmt.Errorf("wrapped: %w", &pq.Error{Code: postgresForeignKeyViolationCode}), true},
+		{"unique violation", &pq.Error{Code: postgresUniqueViolationCode}, false},
+		{"no error", nil, false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+			g.Expect(isForeignKeyViolation(test.err)).To(Equal(test.violation))
+		})
+	}
+}
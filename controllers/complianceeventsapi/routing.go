@@ -0,0 +1,37 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// trimTrailingSlashHandler removes trailing slashes from the request path before next handles it so that a path such
+// as /api/v1/compliance-events/ is routed the same as /api/v1/compliance-events. Clients generated from the OpenAPI
+// document are inconsistent about trailing slashes.
+func trimTrailingSlashHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) <= 1 || !strings.HasSuffix(r.URL.Path, "/") {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		// This copies the request the same way as http.StripPrefix.
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = strings.TrimRight(r.URL.Path, "/")
+		r2.URL.RawPath = strings.TrimRight(r.URL.RawPath, "/")
+
+		// A path of only slashes is the root.
+		if r2.URL.Path == "" {
+			r2.URL.Path = "/"
+		}
+
+		next.ServeHTTP(w, r2)
+	})
+}
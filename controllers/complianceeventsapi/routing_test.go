@@ -0,0 +1,61 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTrimTrailingSlashHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		path     string
+		expected string
+	}{
+		"no trailing slash":         {"/api/v1/compliance-events", "/api/v1/compliance-events"},
+		"trailing slash":            {"/api/v1/compliance-events/", "/api/v1/compliance-events"},
+		"multiple trailing slashes": {"/api/v1/compliance-events/1//", "/api/v1/compliance-events/1"},
+		"root":                      {"/", "/"},
+		"only slashes":              {"//", "/"},
+		"query arguments":           {"/api/v1/clusters/?per_page=5", "/api/v1/clusters"},
+	}
+
+	for name, test := range tests {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			var routedPath string
+
+			handler := trimTrailingSlashHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				routedPath = r.URL.Path
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			g.Expect(routedPath).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestWriteMethodNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	recorder := httptest.NewRecorder()
+	writeMethodNotAllowed(recorder, http.MethodGet, http.MethodPost)
+
+	g.Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	g.Expect(recorder.Header().Get("Allow")).To(Equal("GET, POST"))
+	g.Expect(recorder.Body.String()).To(MatchJSON(`{"message": "Method not allowed"}`))
+}
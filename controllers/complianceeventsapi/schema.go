@@ -0,0 +1,143 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/lib/pq"
+)
+
+// migrationsTableName is the golang-migrate default table that records the applied migration version.
+const migrationsTableName = "schema_migrations"
+
+// requiredSchema is every table and column that the compliance events API queries, mapped from the table name to its
+// column names. This must be updated when a migration adds a table or column that the code depends on.
+var requiredSchema = map[string][]string{
+	"clusters":        {"id", "name", "cluster_id"},
+	"parent_policies": {"id", "name", "namespace", "categories", "controls", "standards"},
+	"policies":        {"id", "kind", "api_group", "name", "namespace", "spec", "severity"},
+	"compliance_events": {
+		"id",
+		"cluster_id",
+		"policy_id",
+		"parent_policy_id",
+		"compliance",
+		"message",
+		"timestamp",
+		"metadata",
+		"labels",
+		"reported_by",
+		"deleted_at",
+	},
+}
+
+// missingSchema returns the tables and columns in requiredSchema that aren't in the input columns, which is mapped from
+// the table name to its column names. Each entry is the table name or the table name and column name separated by a
+// period, sorted alphabetically.
+func missingSchema(columns map[string][]string) []string {
+	missing := []string{}
+
+	for table, requiredColumns := range requiredSchema {
+		existingColumns, ok := columns[table]
+		if !ok {
+			missing = append(missing, table)
+
+			continue
+		}
+
+		for _, column := range requiredColumns {
+			if !slices.Contains(existingColumns, column) {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+// verifySchema checks that every table and column in requiredSchema is in the current schema of the database so that
+// a database that wasn't migrated fails with a clear error rather than on the first query. The check holds a shared
+// advisory lock on the same key as the golang-migrate Postgres driver so that it waits for a migration in progress,
+// such as from another replica, to finish. ErrInvalidDBSchema is returned if anything is missing and
+// ErrDBConnectionFailed is returned if the check couldn't be performed.
+func (c *ComplianceServerCtx) verifySchema(ctx context.Context) error {
+	if c.DB == nil {
+		return fmt.Errorf("%w: the database connection is not set", ErrDBConnectionFailed)
+	}
+
+	tx, err := c.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDBConnectionFailed, err)
+	}
+
+	// The transaction is only read from, so rolling it back releases the advisory lock without side effects.
+	defer func() { _ = tx.Rollback() }()
+
+	var dbName, schemaName string
+
+	err = tx.QueryRowContext(ctx, "SELECT current_database(), current_schema()").Scan(&dbName, &schemaName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDBConnectionFailed, err)
+	}
+
+	lockID, err := database.GenerateAdvisoryLockId(dbName, schemaName, migrationsTableName)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDBConnectionFailed, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock_shared($1)", lockID); err != nil {
+		return fmt.Errorf("%w: %w", ErrDBConnectionFailed, err)
+	}
+
+	tables := make([]string, 0, len(requiredSchema))
+
+	for table := range requiredSchema {
+		tables = append(tables, table)
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT table_name, column_name FROM information_schema.columns "+
+			"WHERE table_schema = $1 AND table_name = ANY($2)",
+		schemaName, pq.Array(tables),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDBConnectionFailed, err)
+	}
+
+	defer rows.Close()
+
+	columns := map[string][]string{}
+
+	for rows.Next() {
+		var table, column string
+
+		if err := rows.Scan(&table, &column); err != nil {
+			return fmt.Errorf("%w: %w", ErrDBConnectionFailed, err)
+		}
+
+		columns[table] = append(columns[table], column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDBConnectionFailed, err)
+	}
+
+	if missing := missingSchema(columns); len(missing) != 0 {
+		return fmt.Errorf(
+			"%w: the %s schema is missing the following tables or columns: %s",
+			ErrInvalidDBSchema, schemaName, strings.Join(missing, ", "),
+		)
+	}
+
+	return nil
+}
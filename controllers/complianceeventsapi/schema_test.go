@@ -0,0 +1,173 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// schemaDriver is a database/sql driver that answers the schema verification queries with the columns it's given.
+type schemaDriver struct {
+	columns map[string][]string
+}
+
+func (d *schemaDriver) Open(string) (driver.Conn, error) {
+	return &schemaConn{driver: d}, nil
+}
+
+type schemaConn struct {
+	driver *schemaDriver
+}
+
+func (c *schemaConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	switch {
+	case strings.HasPrefix(query, "SELECT current_database()"):
+		return &schemaRows{
+			columns: []string{"current_database", "current_schema"},
+			values:  [][]driver.Value{{"compliance", "public"}},
+		}, nil
+	case strings.HasPrefix(query, "SELECT table_name, column_name FROM information_schema.columns"):
+		rows := &schemaRows{columns: []string{"table_name", "column_name"}}
+
+		for table, columns := range c.driver.columns {
+			for _, column := range columns {
+				rows.values = append(rows.values, []driver.Value{table, column})
+			}
+		}
+
+		return rows, nil
+	default:
+		return nil, errors.New("unexpected query: " + query)
+	}
+}
+
+func (c *schemaConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if !strings.HasPrefix(query, "SELECT pg_advisory_xact_lock_shared(") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func (c *schemaConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *schemaConn) Close() error {
+	return nil
+}
+
+func (c *schemaConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *schemaConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *schemaConn) Commit() error {
+	return nil
+}
+
+func (c *schemaConn) Rollback() error {
+	return nil
+}
+
+// schemaRows returns the rows of values in order.
+type schemaRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *schemaRows) Columns() []string {
+	return r.columns
+}
+
+func (r *schemaRows) Close() error {
+	return nil
+}
+
+func (r *schemaRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+}
+
+type schemaConnector struct {
+	driver *schemaDriver
+}
+
+func (c schemaConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c schemaConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func TestMissingSchema(t *testing.T) {
+	t.Parallel()
+
+	complete := map[string][]string{}
+
+	for table, columns := range requiredSchema {
+		complete[table] = append([]string{"extra"}, columns...)
+	}
+
+	missingColumn := map[string][]string{}
+
+	for table, columns := range complete {
+		missingColumn[table] = columns
+	}
+
+	missingColumn["compliance_events"] = []string{"id", "cluster_id", "policy_id", "compliance", "message"}
+
+	tests := map[string]struct {
+		columns  map[string][]string
+		expected []string
+	}{
+		"complete": {
+			columns:  complete,
+			expected: []string{},
+		},
+		"empty database": {
+			columns:  map[string][]string{},
+			expected: []string{"clusters", "compliance_events", "parent_policies", "policies"},
+		},
+		"missing columns": {
+			columns: missingColumn,
+			expected: []string{
+				"compliance_events.deleted_at",
+				"compliance_events.labels",
+				"compliance_events.metadata",
+				"compliance_events.parent_policy_id",
+				"compliance_events.reported_by",
+				"compliance_events.timestamp",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			g.Expect(missingSchema(test.columns)).To(Equal(test.expected))
+		})
+	}
+}
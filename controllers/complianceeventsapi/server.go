@@ -1,29 +1,39 @@
 package complianceeventsapi
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"database/sql"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	stdlog "log"
 	"math"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"reflect"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ghodss/yaml"
 	"github.com/lib/pq"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 // init dynamically parses the database columns of each struct type to create a mapping of user provided sort/filter
@@ -72,7 +82,7 @@ func init() {
 				continue
 			}
 
-			if tableName == "compliance_events" && dbColumn == "metadata" {
+			if tableName == "compliance_events" && (dbColumn == "metadata" || dbColumn == "labels") {
 				continue
 			}
 
@@ -92,12 +102,16 @@ func init() {
 	)
 
 	validQueryArgs = []string{
+		"cursor",
 		"direction",
 		"event.message_includes",
 		"event.message_like",
 		"event.timestamp_after",
 		"event.timestamp_before",
+		"fields",
+		"include_deleted",
 		"include_spec",
+		"latest_only",
 		"page",
 		"per_page",
 		"sort",
@@ -119,10 +133,17 @@ func init() {
 const (
 	postgresForeignKeyViolationCode = "23503"
 	postgresUniqueViolationCode     = "23505"
+	postgresCheckViolationCode      = "23514"
+	// maxNDJSONPerPage is the largest per_page value allowed when the response format is NDJSON.
+	maxNDJSONPerPage = 10000
+	// ndjsonFlushInterval is how many compliance events are written between flushes of an NDJSON response.
+	ndjsonFlushInterval = 100
+	// healthCheckTimeout is how long the /readyz and /healthz endpoints wait for the database to respond.
+	healthCheckTimeout = 5 * time.Second
 )
 
 var (
-	clusterKeyCache         sync.Map
+	clusterKeyCache         = NewKeyCache(DefaultKeyCacheCapacity, DefaultKeyCacheTTL)
 	queryOptionsToSQL       map[string]string
 	validQueryArgs          []string
 	ErrInvalidSortOption    error
@@ -132,20 +153,281 @@ var (
 	ErrForbidden            = errors.New("the request is not allowed")
 	// The user has no access to any managed cluster
 	ErrNoAccess = errors.New("the user has no access")
+	// errDryRunRollback is returned in a transaction to roll it back when a dry run was requested.
+	errDryRunRollback = errors.New("the transaction was rolled back for a dry run")
 )
 
+// DefaultMaxRequestBodyBytes is the default maximum size of a request body. Policy specs can be large, so this is
+// generous.
+const DefaultMaxRequestBodyBytes int64 = 10 * 1024 * 1024
+
+// DefaultShutdownTimeout is the default time that in-flight requests are given to finish when the server stops.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// drainLogInterval is how often the remaining requests are logged while the server is draining on shutdown.
+const drainLogInterval = time.Second
+
+const (
+	// DefaultReadTimeout is the default maximum duration for reading an entire request, including the body.
+	DefaultReadTimeout = 15 * time.Second
+	// DefaultReadHeaderTimeout is the default maximum duration for reading the request headers. This is shorter than
+	// DefaultReadTimeout to defend against slowloris attacks.
+	DefaultReadHeaderTimeout = 5 * time.Second
+	// DefaultWriteTimeout is the default maximum duration before timing out writes of the response.
+	DefaultWriteTimeout = 15 * time.Second
+	// DefaultIdleTimeout is the default maximum amount of time to wait for the next request on a keep-alive
+	// connection.
+	DefaultIdleTimeout = 15 * time.Second
+)
+
+// ComplianceAPIServerOptions are the optional settings of the compliance API server. Zero values use the defaults.
+type ComplianceAPIServerOptions struct {
+	// MaxRequestBodyBytes is the maximum size of a request body. Larger requests get a 413 response.
+	MaxRequestBodyBytes int64
+	// MaxPolicySpecBytes is the maximum size of the JSON encoding of a single policy spec in a compliance event. Larger
+	// policy specs get a 400 response. This is separate from MaxRequestBodyBytes so that large bulk requests can be
+	// allowed while still rejecting enormous policy specs. The default of 0 disables this.
+	MaxPolicySpecBytes int64
+	// ShutdownTimeout is the drain deadline, which is how long in-flight requests are given to finish when the server
+	// stops before the remaining connections are forcibly closed. New connections are refused while draining.
+	ShutdownTimeout time.Duration
+	// ListenNetwork is the network of the listen address, either "tcp" or "unix". With "unix", the listen address is
+	// the path of a Unix domain socket. Defaults to "tcp".
+	ListenNetwork string
+	// ReadTimeout is the maximum duration for reading an entire request, including the body. Defaults to
+	// DefaultReadTimeout (15s).
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is the maximum duration for reading the request headers. Defaults to
+	// DefaultReadHeaderTimeout (5s).
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out writes of the response. Large bulk inserts may need a
+	// higher value. Defaults to DefaultWriteTimeout (15s).
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum amount of time to wait for the next request on a keep-alive connection. Defaults to
+	// DefaultIdleTimeout (15s).
+	IdleTimeout time.Duration
+	// DBRetries is how many times a transaction that failed due to a transient database error, such as a dropped
+	// connection during a failover, is retried. A negative value disables retries.
+	DBRetries int
+	// DBRetryBaseDelay is the delay before the first retry of a transaction. The delay doubles on each retry.
+	DBRetryBaseDelay time.Duration
+	// DedupWindow enables skipping the insertion of a compliance event when an identical one, other than the
+	// timestamp, was recorded within this duration of it. The existing compliance event is returned instead. The
+	// default of 0 disables this.
+	DedupWindow time.Duration
+	// CORSAllowedOrigins are the origins that browsers may call the API from. A value of "*" allows any origin. If
+	// empty, CORS is not enabled.
+	CORSAllowedOrigins []string
+	// CacheWarmupSize enables preloading the database ID caches at startup with up to this many of the clusters,
+	// parent policies, and policies with the most recent compliance events. The default of 0 disables this.
+	CacheWarmupSize int
+	// DBQueryTimeout is the maximum duration of the database queries of a request, other than the streamed CSV and
+	// NDJSON responses. Requests exceeding it get a 504 response. Defaults to DefaultDBQueryTimeout (10s) and a
+	// negative value disables it.
+	DBQueryTimeout time.Duration
+	// RequestTimeout is the maximum duration of a request, other than the streamed CSV and NDJSON responses. Requests
+	// exceeding it get a 503 response. It should be longer than DBQueryTimeout so that slow database queries still get
+	// a 504 response, and shorter than WriteTimeout so that the client gets a response before the connection is
+	// closed. The default of 0 disables this.
+	RequestTimeout time.Duration
+	// RateLimit enables limiting each client, identified by its user once its token is verified or else its IP
+	// address, to this many requests per second. Clients exceeding it get a 429 response. The default of 0 disables
+	// this.
+	RateLimit float64
+	// RateLimitBurst is the number of requests a client can make at once before being rate limited.
+	RateLimitBurst int
+	// MaxConcurrentRequests enables rejecting requests with a 503 response when this many requests are already being
+	// handled, which keeps a burst of clients from piling up on the database connections. Unlike RateLimit, this applies
+	// to all clients together. The health endpoints and the compliance events stream aren't counted. The default of 0
+	// disables this.
+	MaxConcurrentRequests int
+	// RetentionPeriod enables periodically deleting the compliance events with a timestamp older than this duration.
+	// The default of 0 disables this.
+	RetentionPeriod time.Duration
+	// RetentionInterval is the time between purges of old compliance events.
+	RetentionInterval time.Duration
+	// RetentionBatchSize is the maximum number of compliance events deleted in a single statement.
+	RetentionBatchSize int
+	// ValidateJSONSchema enables validating the request body of recording compliance events against the schema in the
+	// OpenAPI document before it's unmarshaled. This gives JSON pointer based errors for structural problems at some
+	// performance cost.
+	ValidateJSONSchema bool
+	// StrictJSON enables rejecting a request body of recorded compliance events with a 400 response when it has a
+	// field that isn't part of the API, such as a misspelled field name. By default, unknown fields are ignored so that
+	// existing clients aren't broken.
+	StrictJSON bool
+	// EventQueueSize enables accepting compliance events with a 202 response and recording them in the database from
+	// an in-process queue of this size. This lets compliance events be accepted during short database outages, but
+	// queued compliance events are lost if the process crashes. Dry runs and requests with multiple compliance events
+	// are still recorded synchronously. The default of 0 disables this.
+	EventQueueSize int
+	// EventQueueWorkers is the number of workers that record the compliance events in the event queue.
+	EventQueueWorkers int
+	// EventQueueSyncFallback enables recording a compliance event synchronously when the event queue is full. By
+	// default, a 503 response is returned instead.
+	EventQueueSyncFallback bool
+	// InsertBatchWindow enables accumulating the compliance events of concurrent requests for up to this duration, such
+	// as 50ms, and recording them in a single transaction. Each request still waits for its compliance event to be
+	// committed and gets its database ID. This replaces a transaction commit per compliance event with one per batch at
+	// the cost of up to this much latency per request. The default of 0 disables this.
+	InsertBatchWindow time.Duration
+	// InsertBatchMaxSize is the maximum number of compliance events in a batch. A batch is recorded right away once it
+	// reaches this size. Defaults to DefaultInsertBatchMaxSize (100).
+	InsertBatchMaxSize int
+	// EventStreamBufferSize is the number of compliance events buffered for each client of the compliance events
+	// stream. Clients that fall further behind are disconnected. Defaults to DefaultEventStreamBufferSize (100).
+	EventStreamBufferSize int
+	// EventStreamMaxClients is the maximum number of concurrent clients of the compliance events stream, which isn't
+	// counted by MaxConcurrentRequests. Additional clients get a 503 response. Defaults to DefaultEventStreamMaxClients
+	// (100).
+	EventStreamMaxClients int
+	// EventStreamMaxDuration is how long a compliance events stream stays open before it's closed. Since the client's
+	// access is only checked when the stream starts, this bounds how long a client keeps getting compliance events
+	// after its access is revoked. Defaults to DefaultEventStreamMaxDuration (30 minutes).
+	EventStreamMaxDuration time.Duration
+	// WebhookURL enables sending a JSON payload of every recorded compliance event with one of the WebhookStatuses
+	// compliance statuses to this URL in a POST request, such as to page a security team. Deliveries are sent in the
+	// background, so they don't slow down recording compliance events. The default of an empty string disables this.
+	WebhookURL string
+	// WebhookStatuses are the compliance statuses that trigger a webhook delivery. Defaults to DefaultWebhookStatuses
+	// (NonCompliant).
+	WebhookStatuses []string
+	// WebhookRetries is how many times a webhook delivery that failed due to a network error or a 429 or 5xx response
+	// is retried. A negative value disables retries. Defaults to DefaultWebhookRetries (3).
+	WebhookRetries int
+	// WebhookTimeout is the maximum duration of a single webhook delivery attempt. Defaults to DefaultWebhookTimeout
+	// (10s).
+	WebhookTimeout time.Duration
+	// AuditLogPath enables writing an audit record as a line of JSON for every recorded compliance event to the file at
+	// this path. A value of "-" writes to standard output. The default of an empty string disables this.
+	AuditLogPath string
+	// H2C enables serving HTTP/2 without TLS (h2c) in addition to HTTP/1.1 so that clients can send many requests on a
+	// single connection. It's ignored when serving HTTPS since HTTP/2 is then negotiated with TLS.
+	H2C bool
+	// BasePath is a path prefix, such as "/compliance", that all routes are served under when the API is behind an
+	// ingress that doesn't strip the prefix. The default of an empty string serves the routes at the root.
+	BasePath string
+}
+
 type ComplianceAPIServer struct {
-	server *http.Server
-	addr   string
-	cert   *tls.Certificate
-	cfg    *rest.Config
+	server  *http.Server
+	addr    string
+	cert    *tls.Certificate
+	cfg     *rest.Config
+	options ComplianceAPIServerOptions
+	// auditLog is nil if audit logging is disabled.
+	auditLog *auditLogger
+	// schemaValidator is nil if JSON schema validation is disabled.
+	schemaValidator *schemaValidator
+	// eventQueue is nil if the event queue is disabled.
+	eventQueue *eventQueue
+	// insertBatcher is nil if insert batching is disabled.
+	insertBatcher *insertBatcher
+	// webhook is nil if the webhook is disabled.
+	webhook *webhookNotifier
+	// eventStream publishes the recorded compliance events to the clients of the compliance events stream.
+	eventStream *eventBroadcaster
+	// openConns is the number of open client connections. It's used for logging while the server is draining.
+	openConns atomic.Int64
 }
 
-func NewComplianceAPIServer(listenAddress string, cfg *rest.Config, cert *tls.Certificate) *ComplianceAPIServer {
+func NewComplianceAPIServer(
+	listenAddress string, cfg *rest.Config, cert *tls.Certificate, options ComplianceAPIServerOptions,
+) *ComplianceAPIServer {
+	if options.MaxRequestBodyBytes <= 0 {
+		options.MaxRequestBodyBytes = DefaultMaxRequestBodyBytes
+	}
+
+	if options.ShutdownTimeout <= 0 {
+		options.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	if options.ListenNetwork == "" {
+		options.ListenNetwork = "tcp"
+	}
+
+	if options.ReadTimeout <= 0 {
+		options.ReadTimeout = DefaultReadTimeout
+	}
+
+	if options.ReadHeaderTimeout <= 0 {
+		options.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+
+	if options.WriteTimeout <= 0 {
+		options.WriteTimeout = DefaultWriteTimeout
+	}
+
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = DefaultIdleTimeout
+	}
+
+	if options.DBRetries == 0 {
+		options.DBRetries = DefaultDBRetries
+	}
+
+	if options.DBRetryBaseDelay <= 0 {
+		options.DBRetryBaseDelay = DefaultDBRetryBaseDelay
+	}
+
+	if options.DBQueryTimeout == 0 {
+		options.DBQueryTimeout = DefaultDBQueryTimeout
+	}
+
+	if options.RateLimitBurst <= 0 {
+		options.RateLimitBurst = DefaultRateLimitBurst
+	}
+
+	if options.RetentionInterval <= 0 {
+		options.RetentionInterval = DefaultRetentionInterval
+	}
+
+	if options.RetentionBatchSize <= 0 {
+		options.RetentionBatchSize = DefaultRetentionBatchSize
+	}
+
+	if options.EventQueueWorkers <= 0 {
+		options.EventQueueWorkers = DefaultEventQueueWorkers
+	}
+
+	if options.InsertBatchMaxSize <= 0 {
+		options.InsertBatchMaxSize = DefaultInsertBatchMaxSize
+	}
+
+	if options.EventStreamBufferSize <= 0 {
+		options.EventStreamBufferSize = DefaultEventStreamBufferSize
+	}
+
+	if options.EventStreamMaxClients <= 0 {
+		options.EventStreamMaxClients = DefaultEventStreamMaxClients
+	}
+
+	if options.EventStreamMaxDuration <= 0 {
+		options.EventStreamMaxDuration = DefaultEventStreamMaxDuration
+	}
+
+	if len(options.WebhookStatuses) == 0 {
+		options.WebhookStatuses = DefaultWebhookStatuses
+	}
+
+	if options.WebhookRetries == 0 {
+		options.WebhookRetries = DefaultWebhookRetries
+	}
+
+	if options.WebhookTimeout <= 0 {
+		options.WebhookTimeout = DefaultWebhookTimeout
+	}
+
+	options.BasePath = strings.TrimSuffix(options.BasePath, "/")
+	if options.BasePath != "" && !strings.HasPrefix(options.BasePath, "/") {
+		options.BasePath = "/" + options.BasePath
+	}
+
 	return &ComplianceAPIServer{
-		addr: listenAddress,
-		cert: cert,
-		cfg:  cfg,
+		addr:    listenAddress,
+		cert:    cert,
+		cfg:     cfg,
+		options: options,
 	}
 }
 
@@ -174,18 +456,113 @@ func newServerErrorLog() *stdlog.Logger {
 func (s *ComplianceAPIServer) Start(ctx context.Context, serverContext *ComplianceServerCtx) error {
 	mux := http.NewServeMux()
 
+	// The middleware is applied from the inside out, so trimTrailingSlashHandler sees every request first. Panics are
+	// recovered closest to the routes so that the response still goes through the other middleware.
+	var handler http.Handler = gzipHandler(recoverHandler(mux))
+	// Requests rejected by the other middleware don't take up a slot of the concurrency limit.
+	handler = concurrencyLimitHandler(s.options.MaxConcurrentRequests, handler)
+	handler = rateLimitHandler(s.options.RateLimit, s.options.RateLimitBurst, handler)
+	handler = requestTimeoutHandler(s.options.RequestTimeout, handler)
+	handler = corsHandler(s.options.CORSAllowedOrigins, handler)
+	handler = requestLogHandler(handler)
+	handler = requestIDHandler(handler)
+	handler = instrumentHandler(handler)
+	handler = inflightHandler(handler)
+	handler = trimTrailingSlashHandler(handler)
+
+	// The routes and middleware only deal with the paths without the base path, so it's stripped before anything else.
+	// Requests outside of the base path get a 404 response.
+	if s.options.BasePath != "" {
+		handler = http.StripPrefix(s.options.BasePath, handler)
+	}
+
+	// The HTTP/2 server uses the timeouts of the HTTP server below for each stream, other than the idle timeout.
+	if s.options.H2C && s.cert == nil {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: s.options.IdleTimeout})
+	}
+
 	s.server = &http.Server{
 		Addr:    s.addr,
-		Handler: mux,
+		Handler: handler,
+
+		ReadTimeout:       s.options.ReadTimeout,
+		ReadHeaderTimeout: s.options.ReadHeaderTimeout,
+		WriteTimeout:      s.options.WriteTimeout,
+		IdleTimeout:       s.options.IdleTimeout,
+		ErrorLog:          newServerErrorLog(),
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				s.openConns.Add(1)
+			case http.StateClosed, http.StateHijacked:
+				s.openConns.Add(-1)
+			}
+		},
+	}
+
+	s.eventStream = newEventBroadcaster(s.options.EventStreamBufferSize, s.options.EventStreamMaxClients)
+	// The compliance events streams never finish on their own, so they must be closed for the shutdown to complete.
+	s.server.RegisterOnShutdown(s.eventStream.close)
+
+	if s.options.ValidateJSONSchema {
+		var err error
+
+		s.schemaValidator, err = newSchemaValidator()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.options.AuditLogPath != "" {
+		auditLog, err := newAuditLogger(s.options.AuditLogPath)
+		if err != nil {
+			return fmt.Errorf("failed to open the audit log: %w", err)
+		}
+
+		s.auditLog = auditLog
+
+		// Start only returns after the server stops, so no more audit records will be written.
+		defer func() {
+			if err := s.auditLog.close(); err != nil {
+				log.Error(err, "Failed to close the audit log", "path", s.options.AuditLogPath)
+			}
+		}()
+	}
+
+	if s.options.WebhookURL != "" {
+		if err := validateWebhookURL(s.options.WebhookURL); err != nil {
+			return err
+		}
+
+		s.webhook = s.startWebhookNotifier()
+
+		// This runs after the event queue is flushed so that the flushed compliance events are delivered.
+		defer s.webhook.stop(s.options.ShutdownTimeout)
+	}
 
-		// need to investigate ideal values for these
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  15 * time.Second,
-		ErrorLog:     newServerErrorLog(),
+	if s.options.EventQueueSize > 0 {
+		s.eventQueue = s.startEventQueue(serverContext)
+
+		// This runs after the server stops so that no more compliance events are queued. It runs before the audit log
+		// is closed so that the flushed compliance events are audited.
+		defer s.eventQueue.flush(s.options.ShutdownTimeout)
+	}
+
+	if s.options.InsertBatchWindow > 0 {
+		s.insertBatcher = s.startInsertBatcher(serverContext)
+
+		// This runs after the server stops so that the requests waiting on a batch get their responses first.
+		defer s.insertBatcher.stop()
+	}
+
+	if s.options.ListenNetwork == "unix" {
+		// Remove a stale socket file left behind by a previous process that didn't shutdown cleanly.
+		if err := removeSocketFile(s.addr); err != nil {
+			return err
+		}
 	}
 
-	listener, err := net.Listen("tcp", s.addr)
+	listener, err := net.Listen(s.options.ListenNetwork, s.addr)
 	if err != nil {
 		return err
 	}
@@ -199,6 +576,11 @@ func (s *ComplianceAPIServer) Start(ctx context.Context, serverContext *Complian
 		listener = tls.NewListener(listener, s.server.TLSConfig)
 	}
 
+	// handleWithDBTimeout registers handlers that don't stream their responses with the database query timeout.
+	handleWithDBTimeout := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, withDBTimeout(s.options.DBQueryTimeout, handler))
+	}
+
 	// register handlers here
 	mux.HandleFunc("/api/v1/compliance-events", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -206,7 +588,16 @@ func (s *ComplianceAPIServer) Start(ctx context.Context, serverContext *Complian
 		serverContext.Lock.RLock()
 		defer serverContext.Lock.RUnlock()
 
-		if serverContext.DB == nil || serverContext.DB.PingContext(r.Context()) != nil {
+		// With the event queue, compliance events are still accepted while the database is unreachable or not yet
+		// connected.
+		queueable := r.Method == http.MethodPost && s.eventQueue != nil
+
+		db := serverContext.DB
+		if r.Method == http.MethodGet {
+			db = serverContext.ReadDB()
+		}
+
+		if !queueable && (db == nil || db.PingContext(r.Context()) != nil) {
 			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
 
 			return
@@ -223,28 +614,53 @@ func (s *ComplianceAPIServer) Start(ctx context.Context, serverContext *Complian
 
 				return
 			}
-			getComplianceEvents(serverContext.DB, w, r, userConfig)
+
+			format, err := getResponseFormat(r)
+			if err != nil {
+				writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			switch format {
+			case "csv":
+				getComplianceEventsCSV(db, w, withoutFormatQueryArg(r), userConfig)
+			case "ndjson":
+				getComplianceEventsNDJSON(db, w, withoutFormatQueryArg(r), userConfig)
+			default:
+				withDBTimeout(s.options.DBQueryTimeout, func(w http.ResponseWriter, r *http.Request) {
+					getComplianceEvents(db, w, r, userConfig)
+				})(w, withoutFormatQueryArg(r))
+			}
 		case http.MethodPost:
-			postComplianceEvent(serverContext, s.cfg, w, r)
+			withDBTimeout(s.options.DBQueryTimeout, func(w http.ResponseWriter, r *http.Request) {
+				s.postComplianceEvent(serverContext, w, r)
+			})(w, r)
 		default:
-			writeErrMsgJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
 		}
 	})
 
-	mux.HandleFunc("/api/v1/compliance-events/", func(w http.ResponseWriter, r *http.Request) {
+	handleWithDBTimeout("/api/v1/compliance-events/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		serverContext.Lock.RLock()
 		defer serverContext.Lock.RUnlock()
 
-		if serverContext.DB == nil || serverContext.DB.PingContext(r.Context()) != nil {
+		db := serverContext.DB
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			db = serverContext.ReadDB()
+		}
+
+		if db == nil || db.PingContext(r.Context()) != nil {
 			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
 
 			return
 		}
 
-		if r.Method != http.MethodGet {
-			writeErrMsgJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPatch &&
+			r.Method != http.MethodDelete {
+			writeMethodNotAllowed(w, http.MethodGet, http.MethodHead, http.MethodPatch, http.MethodDelete)
 
 			return
 		}
@@ -259,13 +675,50 @@ func (s *ComplianceAPIServer) Start(ctx context.Context, serverContext *Complian
 			return
 		}
 
-		getSingleComplianceEvent(serverContext.DB, w, r, userConfig)
+		if strings.HasSuffix(r.URL.Path, "/spec") {
+			if r.Method != http.MethodGet {
+				writeMethodNotAllowed(w, http.MethodGet)
+
+				return
+			}
+
+			getComplianceEventSpec(db, w, r, userConfig)
+
+			return
+		}
+
+		switch r.Method {
+		case http.MethodHead:
+			headComplianceEvent(db, w, r, userConfig)
+		case http.MethodPatch:
+			s.patchComplianceEvent(serverContext.DB, w, r)
+		case http.MethodDelete:
+			s.deleteComplianceEvent(serverContext.DB, w, r)
+		default:
+			getSingleComplianceEvent(db, w, r, userConfig)
+		}
 	})
 
-	mux.HandleFunc("/api/v1/reports/compliance-events", func(w http.ResponseWriter, r *http.Request) {
-		// This header is for error writings
+	// The export is streamed, so it doesn't have the database query timeout.
+	mux.HandleFunc("/api/v1/compliance-events/export", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
+
+		db := serverContext.ReadDB()
+		if db == nil || db.PingContext(r.Context()) != nil {
+			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
+
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+
+			return
+		}
+
 		// To verify each request independently
 		userConfig, err := getUserKubeConfig(s.cfg, r)
 		if err != nil {
@@ -276,868 +729,2785 @@ func (s *ComplianceAPIServer) Start(ctx context.Context, serverContext *Complian
 			return
 		}
 
+		exportComplianceEvents(db, w, r, userConfig)
+	})
+
+	// The compliance events stream is long lived, so it doesn't have the database query timeout and only holds the
+	// lock while replaying compliance events from the database.
+	mux.HandleFunc("/api/v1/compliance-events/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
 		if r.Method != http.MethodGet {
-			writeErrMsgJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeMethodNotAllowed(w, http.MethodGet)
+
+			return
+		}
+
+		// To verify each request independently
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
+			}
 
 			return
 		}
 
-		getComplianceEventsCSV(serverContext.DB, w, r, userConfig)
+		s.streamComplianceEvents(serverContext, w, r, userConfig)
 	})
 
-	serveErr := make(chan error)
+	handleWithDBTimeout("/api/v1/compliance-events/batch-get", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 
-	go func() {
-		defer close(serveErr)
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
 
-		err := s.server.Serve(listener)
-		if err != nil && err != http.ErrServerClosed {
-			serveErr <- err
+		db := serverContext.ReadDB()
+		if db == nil || db.PingContext(r.Context()) != nil {
+			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
+
+			return
 		}
-	}()
 
-	select {
-	case <-ctx.Done():
-		err := s.server.Shutdown(context.Background())
-		if err != nil {
-			log.Error(err, "Failed to shutdown the compliance API server")
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+
+			return
 		}
 
-		return nil
-	case err, closed := <-serveErr:
+		// To verify each request independently
+		userConfig, err := getUserKubeConfig(s.cfg, r)
 		if err != nil {
-			return err
-		}
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
+			}
 
-		if closed {
-			return errors.New("the compliance API server unexpectedly shutdown without an error")
+			return
 		}
 
-		return nil
-	}
-}
+		getComplianceEventsByIDs(db, w, r, userConfig, s.options.MaxRequestBodyBytes)
+	})
 
-// splitQueryValue will parse a string and split on unescaped commas. Empty values are discarded.
-func splitQueryValue(value string) []string {
-	values := []string{}
+	handleWithDBTimeout("/api/v1/compliance-events/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 
-	var currentVal string
-	var previousChar rune
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
 
-	for _, char := range value {
-		if char == ',' {
-			if previousChar == '\\' {
-				// This comma was escaped, so remove the escape character and keep the comma. Runes are used in case
-				// unicode characters are present in currentVal.
-				runeCurrentVal := []rune(currentVal)
-				currentVal = string(runeCurrentVal[:len(runeCurrentVal)-1]) + ","
-			} else {
-				// The comma was not escaped so we encountered a new value.
-				if currentVal != "" {
-					values = append(values, currentVal)
-				}
+		db := serverContext.ReadDB()
+		if db == nil || db.PingContext(r.Context()) != nil {
+			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
 
-				currentVal = ""
-			}
-		} else {
-			// A non-special character was encountered so just append the character.
-			currentVal += string(char)
+			return
 		}
 
-		previousChar = char
-	}
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
 
-	if currentVal != "" {
-		values = append(values, currentVal)
-	}
+			return
+		}
 
-	return values
-}
+		// To verify each request independently
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
+			}
 
-// parseQueryArgs will parse the HTTP request's query arguments and convert them to a usable format for constructing
-// the SQL query. All defaults are set and any invalid query arguments result in an error being returned.
-func parseQueryArgs(ctx context.Context, queryArgs url.Values, db *sql.DB,
-	userConfig *rest.Config, isCSV bool,
-) (*queryOptions, error) {
-	parsed := &queryOptions{
-		Direction:    "desc",
-		Page:         1,
-		PerPage:      20,
-		Sort:         []string{"compliance_events.timestamp"},
-		ArrayFilters: map[string][]string{},
-		Filters:      map[string][]string{},
-		NullFilters:  []string{},
-	}
+			return
+		}
 
-	// Case return CSV file, default PerPage is 0. Unlimited
-	if isCSV {
-		parsed.PerPage = 0
-	}
+		getComplianceEventsStats(db, w, r, userConfig)
+	})
 
-	for arg := range queryArgs {
-		valid := false
+	handleWithDBTimeout("/api/v1/compliance-events/by-cluster", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 
-		for _, validQueryArg := range validQueryArgs {
-			if arg == validQueryArg {
-				valid = true
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
 
-				break
-			}
-		}
+		db := serverContext.ReadDB()
+		if db == nil || db.PingContext(r.Context()) != nil {
+			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
 
-		if !valid {
-			return nil, ErrInvalidQueryArg
+			return
 		}
 
-		sqlName, hasSQLName := queryOptionsToSQL[arg]
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
 
-		value := queryArgs.Get(arg)
-		if value == "" && arg != "include_spec" {
-			// Only support null filters if it's a SQL column
-			if !hasSQLName {
-				return nil, fmt.Errorf("%w: %s must have a value", ErrInvalidQueryArgValue, arg)
+			return
+		}
+
+		// To verify each request independently
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
 			}
 
-			parsed.NullFilters = append(parsed.NullFilters, sqlName)
+			return
+		}
 
-			continue
+		getComplianceByCluster(db, w, r, userConfig)
+	})
+
+	handleWithDBTimeout("/api/v1/clusters", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
+
+		db := serverContext.ReadDB()
+		if db == nil || db.PingContext(r.Context()) != nil {
+			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
+
+			return
 		}
 
-		switch arg {
-		case "direction":
-			if value == "desc" {
-				parsed.Direction = "DESC"
-			} else if value == "asc" {
-				parsed.Direction = "ASC"
-			} else {
-				return nil, fmt.Errorf("%w: direction must be one of: asc, desc", ErrInvalidQueryArg)
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+
+			return
+		}
+
+		// To verify each request independently
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
 			}
-		case "include_spec":
-			if value != "" {
-				return nil, fmt.Errorf("%w: include_spec is a flag and does not accept a value", ErrInvalidQueryArg)
+
+			return
+		}
+
+		getClusters(db, w, r, userConfig)
+	})
+
+	handleWithDBTimeout("/api/v1/clusters/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// The only route under a cluster is the compliance history of a policy on it.
+		if _, _, ok := parseHistoryPath(r.URL.Path); !ok {
+			writeErrMsgJSON(w, "Not found", http.StatusNotFound)
+
+			return
+		}
+
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
+
+		db := serverContext.ReadDB()
+		if db == nil || db.PingContext(r.Context()) != nil {
+			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
+
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+
+			return
+		}
+
+		// To verify each request independently
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
 			}
 
-			parsed.IncludeSpec = true
-		case "page":
-			var err error
+			return
+		}
 
-			parsed.Page, err = strconv.ParseUint(value, 10, 64)
-			if err != nil || parsed.Page == 0 {
-				return nil, fmt.Errorf("%w: page must be a positive integer", ErrInvalidQueryArg)
+		getPolicyHistory(db, w, r, userConfig)
+	})
+
+	handleWithDBTimeout("/api/v1/parent-policies", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
+
+		db := serverContext.ReadDB()
+		if db == nil || db.PingContext(r.Context()) != nil {
+			writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
+
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+
+			return
+		}
+
+		// To verify each request independently
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
 			}
-		case "per_page":
-			var err error
 
-			parsed.PerPage, err = strconv.ParseUint(value, 10, 64)
-			if err != nil || parsed.PerPage == 0 || parsed.PerPage > 100 {
-				return nil, fmt.Errorf("%w: per_page must be a value between 1 and 100", ErrInvalidQueryArg)
+			return
+		}
+
+		getParentPolicies(db, w, r, userConfig)
+	})
+
+	mux.HandleFunc("/api/v1/reports/compliance-events", func(w http.ResponseWriter, r *http.Request) {
+		// This header is for error writings
+		w.Header().Set("Content-Type", "application/json")
+
+		// To verify each request independently
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
 			}
-		case "sort":
-			sortArgs := splitQueryValue(value)
 
-			sortSQL := []string{}
+			return
+		}
 
-			for _, sortArg := range sortArgs {
-				sortOption, ok := queryOptionsToSQL[sortArg]
-				if !ok {
-					return nil, ErrInvalidSortOption
-				}
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
 
-				sortSQL = append(sortSQL, sortOption)
+			return
+		}
+
+		getComplianceEventsCSV(serverContext.ReadDB(), w, r, userConfig)
+	})
+
+	mux.HandleFunc("/api/v1/admin/cache/flush", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+
+			return
+		}
+
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
 			}
 
-			parsed.Sort = sortSQL
-		case "parent_policy.categories", "parent_policy.controls", "parent_policy.standards":
-			parsed.ArrayFilters[sqlName] = splitQueryValue(value)
-		case "event.message_includes":
-			// Escape the SQL LIKE operators because we aren't exposing that functionality.
-			escapedVal := strings.ReplaceAll(value, "%", `\%`)
-			escapedVal = strings.ReplaceAll(escapedVal, "_", `\_`)
-			// Add wildcards at the beginning and end of the search keyword for substring matching.
-			parsed.MessageIncludes = "%" + escapedVal + "%"
-		case "event.message_like":
-			parsed.MessageLike = value
-		case "event.timestamp_before":
-			var err error
+			return
+		}
+
+		if !authorizeAdminRequest(w, r, userConfig) {
+			return
+		}
+
+		// The write lock ensures no request is between reading and storing a cached database ID during the flush.
+		serverContext.Lock.Lock()
+		defer serverContext.Lock.Unlock()
+
+		flushKeyCaches(serverContext, w, r)
+	})
+
+	mux.HandleFunc("/api/v1/admin/cache/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+
+			return
+		}
+
+		userConfig, err := getUserKubeConfig(s.cfg, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "The Authorization header is not set", http.StatusUnauthorized)
+			}
+
+			return
+		}
+
+		if !authorizeAdminRequest(w, r, userConfig) {
+			return
+		}
+
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
+
+		getKeyCacheStats(serverContext, w, r)
+	})
+
+	mux.HandleFunc("/api/v1/openapi.json", serveOpenAPIDocument)
+
+	mux.HandleFunc("/version", serveVersion)
+
+	// /livez only reports that the server is able to respond so that a database outage doesn't cause a restart.
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+
+			return
+		}
+
+		writeHealthStatusJSON(w, "ok", http.StatusOK)
+	})
+
+	// /readyz reports if the database is available. /healthz is the same check for backwards compatibility.
+	readinessHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+
+			return
+		}
+
+		serverContext.Lock.RLock()
+		defer serverContext.Lock.RUnlock()
+
+		pingCtx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		if serverContext.DB == nil || serverContext.DB.PingContext(pingCtx) != nil {
+			writeHealthStatusJSON(w, "unavailable", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		writeHealthStatusJSON(w, "ok", http.StatusOK)
+	}
+
+	mux.HandleFunc("/readyz", readinessHandler)
+	mux.HandleFunc("/healthz", readinessHandler)
+
+	// This handles every path that doesn't match a route so that the 404 response is JSON like the other errors.
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		writeErrMsgJSON(w, "Not found", http.StatusNotFound)
+	})
+
+	// This runs asynchronously so that it doesn't delay the server from accepting requests.
+	go s.warmKeyCaches(ctx, serverContext)
+
+	retentionDone := make(chan struct{})
+
+	go func() {
+		defer close(retentionDone)
+
+		s.runRetention(ctx, serverContext)
+	}()
+
+	serveErr := make(chan error)
+
+	go func() {
+		defer close(serveErr)
+
+		err := s.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		s.shutdown()
+		<-retentionDone
+
+		return nil
+	case err, closed := <-serveErr:
+		if err != nil {
+			return err
+		}
+
+		if closed {
+			return errors.New("the compliance API server unexpectedly shutdown without an error")
+		}
+
+		return nil
+	}
+}
+
+// removeSocketFile removes the Unix domain socket file at path if it exists. An error is returned if the path exists
+// but is not a socket so that other files are never removed.
+func removeSocketFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("the listen address %s exists and is not a socket", path)
+	}
+
+	return os.Remove(path)
+}
+
+// shutdown gracefully stops the HTTP server. The listener is closed first so that new connections are refused right
+// away, such as during a rolling update, while the in-flight requests are drained. The number of remaining requests and
+// connections is logged every drainLogInterval. If in-flight requests don't finish within the shutdown timeout, the
+// remaining connections are forcibly closed.
+func (s *ComplianceAPIServer) shutdown() {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.options.ShutdownTimeout)
+	defer cancel()
+
+	if s.options.ListenNetwork == "unix" {
+		// Closing the listener normally removes the socket file, but this ensures it's also removed when the
+		// shutdown times out.
+		defer func() {
+			if err := removeSocketFile(s.addr); err != nil {
+				log.Error(err, "Failed to remove the compliance API server socket file", "path", s.addr)
+			}
+		}()
+	}
+
+	log.Info(
+		"Draining the compliance API server",
+		"timeout", s.options.ShutdownTimeout.String(),
+		"inflightRequests", inflightRequests.Load(),
+		"openConnections", s.openConns.Load(),
+	)
+
+	drained := make(chan struct{})
+	go s.logDrainProgress(drained)
+
+	// Shutdown closes the listener before waiting for the connections to become idle.
+	err := s.server.Shutdown(shutdownCtx)
+	close(drained)
+
+	if err == nil {
+		log.Info("The compliance API server drained all connections")
+
+		return
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Info(
+			"Timed out waiting for in-flight requests to finish. Forcibly closing the remaining connections.",
+			"timeout", s.options.ShutdownTimeout.String(),
+			"openConnections", s.openConns.Load(),
+		)
+	} else {
+		log.Error(err, "Failed to shutdown the compliance API server")
+	}
+
+	if err := s.server.Close(); err != nil {
+		log.Error(err, "Failed to close the compliance API server")
+	}
+}
+
+// logDrainProgress logs the number of in-flight requests and open connections every drainLogInterval until done is
+// closed.
+func (s *ComplianceAPIServer) logDrainProgress(done <-chan struct{}) {
+	ticker := time.NewTicker(drainLogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			log.Info(
+				"Waiting for the compliance API server to drain",
+				"inflightRequests", inflightRequests.Load(),
+				"openConnections", s.openConns.Load(),
+			)
+		}
+	}
+}
+
+// isDryRun returns true if the request asks for a dry run with the dry_run=true query argument or the
+// `Prefer: dry-run` header. In a dry run, the request is fully processed, including resolving the foreign keys, but
+// the database transaction is rolled back so that nothing is persisted.
+func isDryRun(r *http.Request) (bool, error) {
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("%w: dry_run must be true or false", ErrInvalidQueryArgValue)
+		}
+
+		if dryRun {
+			return true, nil
+		}
+	}
+
+	for _, preference := range splitPreferHeader(r) {
+		if preference == "dry-run" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// splitPreferHeader returns the lowercase preferences from the Prefer headers of the request, such as "dry-run" and
+// "return=minimal" from `Prefer: dry-run, return=minimal`. Preference parameters are discarded.
+func splitPreferHeader(r *http.Request) []string {
+	preferences := []string{}
+
+	for _, header := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			preference, _, _ = strings.Cut(preference, ";")
+			name, value, hasValue := strings.Cut(preference, "=")
+
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+
+			if hasValue {
+				name += "=" + strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`))
+			}
+
+			preferences = append(preferences, name)
+		}
+	}
+
+	return preferences
+}
+
+// prefersMinimalReturn returns true if the request has the `Prefer: return=minimal` header, which means that the client
+// doesn't need the compliance events in the response body.
+func prefersMinimalReturn(r *http.Request) bool {
+	return slices.Contains(splitPreferHeader(r), "return=minimal")
+}
+
+// writeMinimalReturn writes an empty response body with the input status code for a request that prefers a minimal
+// return.
+func writeMinimalReturn(w http.ResponseWriter, code int) {
+	w.Header().Del("Content-Type")
+	w.Header().Add("Preference-Applied", "return=minimal")
+	w.WriteHeader(code)
+}
+
+// setDryRunHeaders marks the response of a dry run. If the dry run was requested with the Prefer header, the
+// Preference-Applied header is also set.
+func setDryRunHeaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Dry-Run", "true")
+
+	if slices.Contains(splitPreferHeader(r), "dry-run") {
+		w.Header().Set("Preference-Applied", "dry-run")
+	}
+}
+
+// isYAMLRequest returns true if the Content-Type header of the request is a YAML media type. Otherwise, the request
+// body is treated as JSON.
+func isYAMLRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	default:
+		return false
+	}
+}
+
+// getResponseFormat returns the response format requested by the format query argument or, if that's not set, by the
+// Accept header. The formats are "json", "csv", and "ndjson", and "json" is the default. An ErrInvalidQueryArgValue
+// error is returned if the format query argument is not a valid format.
+func getResponseFormat(r *http.Request) (string, error) {
+	formats := map[string]string{"application/json": "json", "text/csv": "csv", "application/x-ndjson": "ndjson"}
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		for _, validFormat := range formats {
+			if format == validFormat {
+				return format, nil
+			}
+		}
+
+		return "", fmt.Errorf("%w: format must be one of json, csv, ndjson but got: %s", ErrInvalidQueryArgValue, format)
+	}
+
+	// Use the first supported media type in the Accept header. Quality values are not considered.
+	for _, header := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(header, ",") {
+			mediaType, _, _ := strings.Cut(mediaRange, ";")
+
+			if format, ok := formats[strings.ToLower(strings.TrimSpace(mediaType))]; ok {
+				return format, nil
+			}
+		}
+	}
+
+	return "json", nil
+}
+
+// withoutFormatQueryArg returns a shallow copy of the request without the format query argument, since it is not a
+// filter and would otherwise be rejected by parseQueryArgs.
+func withoutFormatQueryArg(r *http.Request) *http.Request {
+	queryArgs := r.URL.Query()
+	if !queryArgs.Has("format") {
+		return r
+	}
+
+	queryArgs.Del("format")
+
+	newReq := r.Clone(r.Context())
+	newReq.URL.RawQuery = queryArgs.Encode()
+
+	return newReq
+}
+
+// splitQueryValue will parse a string and split on unescaped commas. Empty values are discarded.
+func splitQueryValue(value string) []string {
+	values := []string{}
+
+	var currentVal string
+	var previousChar rune
+
+	for _, char := range value {
+		if char == ',' {
+			if previousChar == '\\' {
+				// This comma was escaped, so remove the escape character and keep the comma. Runes are used in case
+				// unicode characters are present in currentVal.
+				runeCurrentVal := []rune(currentVal)
+				currentVal = string(runeCurrentVal[:len(runeCurrentVal)-1]) + ","
+			} else {
+				// The comma was not escaped so we encountered a new value.
+				if currentVal != "" {
+					values = append(values, currentVal)
+				}
+
+				currentVal = ""
+			}
+		} else {
+			// A non-special character was encountered so just append the character.
+			currentVal += string(char)
+		}
+
+		previousChar = char
+	}
+
+	if currentVal != "" {
+		values = append(values, currentVal)
+	}
+
+	return values
+}
+
+// parseQueryArgs will parse the HTTP request's query arguments and convert them to a usable format for constructing
+// the SQL query. All defaults are set and any invalid query arguments result in an error being returned.
+func parseQueryArgs(ctx context.Context, queryArgs url.Values, db *sql.DB,
+	userConfig *rest.Config, format string,
+) (*queryOptions, error) {
+	parsed := &queryOptions{
+		Direction:    "desc",
+		Page:         1,
+		PerPage:      20,
+		Sort:         []string{"compliance_events.timestamp"},
+		ArrayFilters: map[string][]string{},
+		Filters:      map[string][]string{},
+		LabelFilters: map[string][]string{},
+		NullFilters:  []string{},
+	}
+
+	// Case return CSV file or an export, default PerPage is 0. Unlimited
+	if format == "csv" || format == "export" {
+		parsed.PerPage = 0
+	}
+
+	// NDJSON is streamed, so much larger pages are allowed.
+	maxPerPage := uint64(100)
+	if format == "ndjson" {
+		maxPerPage = maxNDJSONPerPage
+	}
+
+	// sortDirections are the directions of the sort columns when any of them has a "-" prefix for descending order.
+	var sortDirections []string
+
+	for arg := range queryArgs {
+		// The label filters have the label key in the query argument name, such as label.run-id=1234.
+		if labelKey, isLabel := strings.CutPrefix(arg, "label."); isLabel {
+			labelValues := splitQueryValue(queryArgs.Get(arg))
+			if labelKey == "" || len(labelValues) == 0 {
+				return nil, fmt.Errorf("%w: %s must have a label key and value", ErrInvalidQueryArgValue, arg)
+			}
+
+			parsed.LabelFilters[labelKey] = labelValues
+
+			continue
+		}
+
+		valid := false
+
+		for _, validQueryArg := range validQueryArgs {
+			if arg == validQueryArg {
+				valid = true
+
+				break
+			}
+		}
+
+		if !valid {
+			return nil, ErrInvalidQueryArg
+		}
+
+		sqlName, hasSQLName := queryOptionsToSQL[arg]
+
+		value := queryArgs.Get(arg)
+		// An empty cursor starts cursor based pagination from the first page.
+		if value == "" && arg != "include_spec" && arg != "cursor" {
+			// Only support null filters if it's a SQL column
+			if !hasSQLName {
+				return nil, fmt.Errorf("%w: %s must have a value", ErrInvalidQueryArgValue, arg)
+			}
+
+			parsed.NullFilters = append(parsed.NullFilters, sqlName)
+
+			continue
+		}
+
+		switch arg {
+		case "cursor":
+			parsed.CursorPaging = true
+
+			if value != "" {
+				var err error
+
+				parsed.Cursor, err = parseEventCursor(value)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case "direction":
+			if value == "desc" {
+				parsed.Direction = "DESC"
+			} else if value == "asc" {
+				parsed.Direction = "ASC"
+			} else {
+				return nil, fmt.Errorf("%w: direction must be one of: asc, desc", ErrInvalidQueryArg)
+			}
+		case "fields":
+			var err error
+
+			parsed.Fields, err = parseFieldsQueryArg(value)
+			if err != nil {
+				return nil, err
+			}
+		case "include_deleted":
+			var err error
+
+			parsed.IncludeDeleted, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: include_deleted must be true or false", ErrInvalidQueryArgValue)
+			}
+		case "include_spec":
+			if value != "" {
+				return nil, fmt.Errorf("%w: include_spec is a flag and does not accept a value", ErrInvalidQueryArg)
+			}
+
+			parsed.IncludeSpec = true
+		case "latest_only":
+			var err error
+
+			parsed.LatestOnly, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: latest_only must be true or false", ErrInvalidQueryArgValue)
+			}
+		case "page":
+			var err error
+
+			parsed.Page, err = strconv.ParseUint(value, 10, 64)
+			if err != nil || parsed.Page == 0 {
+				return nil, fmt.Errorf("%w: page must be a positive integer", ErrInvalidQueryArg)
+			}
+		case "per_page":
+			var err error
+
+			parsed.PerPage, err = strconv.ParseUint(value, 10, 64)
+			if err != nil || parsed.PerPage == 0 || parsed.PerPage > maxPerPage {
+				return nil, fmt.Errorf(
+					"%w: per_page must be a value between 1 and %d", ErrInvalidQueryArg, maxPerPage,
+				)
+			}
+		case "sort":
+			sortArgs := splitQueryValue(value)
+
+			sortSQL := []string{}
+
+			directions := []string{}
+			prefixed := false
+
+			for _, sortArg := range sortArgs {
+				direction := "ASC"
+
+				if name, found := strings.CutPrefix(sortArg, "-"); found {
+					sortArg = name
+					direction = "DESC"
+					prefixed = true
+				}
+
+				sortOption, ok := queryOptionsToSQL[sortArg]
+				if !ok {
+					return nil, ErrInvalidSortOption
+				}
+
+				sortSQL = append(sortSQL, sortOption)
+				directions = append(directions, direction)
+			}
+
+			parsed.Sort = sortSQL
+
+			if prefixed {
+				sortDirections = directions
+			}
+		case "event.compliance":
+			compliances := splitQueryValue(value)
+			invalidCompliances := []string{}
+
+			for _, compliance := range compliances {
+				if !slices.Contains(validComplianceStates, compliance) {
+					invalidCompliances = append(invalidCompliances, compliance)
+				}
+			}
+
+			if len(invalidCompliances) > 0 {
+				return nil, fmt.Errorf(
+					"%w: event.compliance must be one of %s but got: %s",
+					ErrInvalidQueryArgValue,
+					strings.Join(validComplianceStates, ", "),
+					strings.Join(invalidCompliances, ", "),
+				)
+			}
+
+			parsed.Filters[sqlName] = compliances
+		case "parent_policy.categories", "parent_policy.controls", "parent_policy.standards":
+			parsed.ArrayFilters[sqlName] = splitQueryValue(value)
+		case "event.message_includes":
+			// Escape the SQL LIKE operators because we aren't exposing that functionality.
+			escapedVal := strings.ReplaceAll(value, "%", `\%`)
+			escapedVal = strings.ReplaceAll(escapedVal, "_", `\_`)
+			// Add wildcards at the beginning and end of the search keyword for substring matching.
+			parsed.MessageIncludes = "%" + escapedVal + "%"
+		case "event.message_like":
+			parsed.MessageLike = value
+		case "event.timestamp_before":
+			var err error
+
+			parsed.TimestampBefore, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"%w: event.timestamp_before must be in the format of RFC 3339", ErrInvalidQueryArgValue,
+				)
+			}
+		case "event.timestamp_after":
+			var err error
+
+			parsed.TimestampAfter, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"%w: event.timestamp_after must be in the format of RFC 3339", ErrInvalidQueryArgValue,
+				)
+			}
+		default:
+			// Standard string filtering
+			parsed.Filters[sqlName] = splitQueryValue(value)
+		}
+	}
+
+	// Soft deleted compliance events are excluded unless explicitly requested.
+	if !parsed.IncludeDeleted {
+		parsed.NullFilters = append(parsed.NullFilters, "compliance_events.deleted_at")
+	}
+
+	// With the "-" prefix, each sort column has its own direction and unprefixed columns are sorted in ascending order.
+	// The last column's direction goes in Direction since it's appended to the ORDER BY clause.
+	if sortDirections != nil {
+		if queryArgs.Has("direction") {
+			return nil, fmt.Errorf(
+				"%w: direction cannot be used with a sort field prefixed with -", ErrInvalidQueryArg,
+			)
+		}
+
+		last := len(parsed.Sort) - 1
+
+		for i := 0; i < last; i++ {
+			parsed.Sort[i] += " " + sortDirections[i]
+		}
+
+		parsed.Direction = sortDirections[last]
+	}
+
+	if parsed.CursorPaging {
+		if format != "json" {
+			return nil, fmt.Errorf("%w: cursor is only supported for JSON responses", ErrInvalidQueryArg)
+		}
+
+		if queryArgs.Has("page") {
+			return nil, fmt.Errorf("%w: cursor and page cannot be used together", ErrInvalidQueryArg)
+		}
+
+		if !slices.Equal(parsed.Sort, []string{"compliance_events.timestamp"}) {
+			return nil, fmt.Errorf("%w: cursor can only be used when sorting by event.timestamp", ErrInvalidQueryArg)
+		}
+	}
+
+	if parsed.Fields != nil {
+		if format != "json" {
+			return nil, fmt.Errorf("%w: fields is only supported for JSON responses", ErrInvalidQueryArg)
+		}
+
+		if parsed.IncludeSpec {
+			return nil, fmt.Errorf(
+				"%w: fields and include_spec cannot be used together, add policy.spec to fields instead",
+				ErrInvalidQueryArg,
+			)
+		}
+	}
+
+	if !parsed.TimestampAfter.IsZero() && !parsed.TimestampBefore.IsZero() &&
+		parsed.TimestampAfter.After(parsed.TimestampBefore) {
+		return nil, fmt.Errorf(
+			"%w: event.timestamp_after must be earlier than event.timestamp_before", ErrInvalidQueryArgValue,
+		)
+	}
+
+	parsed, err := setAuthorizedClusters(ctx, db, parsed, userConfig)
+	if err != nil {
+		// ErrNoAccess needs queryOptions
+		return parsed, err
+	}
+
+	return parsed, nil
+}
+
+// setAuthorizedClusters verifies that if a cluster filter is provided,
+// the user has access to this filter. If no cluster filter is provided,
+// it sets the cluster filter to all managed clusters the user has access to.
+// If the user has no access, then ErrNoAccess is returned.
+func setAuthorizedClusters(ctx context.Context, db *sql.DB, parsed *queryOptions,
+	userConfig *rest.Config,
+) (*queryOptions, error) {
+	reqLog := ctrl.LoggerFrom(ctx)
+
+	unAuthorizedClusters := []string{}
+
+	// Get all managedCluster rules
+	allRules, err := getManagedClusterRules(userConfig, nil)
+	if err != nil {
+		return parsed, err
+	}
+
+	if slices.Contains(allRules["*"], "get") || slices.Contains(allRules["*"], "*") {
+		return parsed, nil
+	}
+
+	clusterIDs := parsed.Filters["clusters.cluster_id"]
+	// Temporarily reset clusters.cluster_id and repopulate with all known cluster IDs
+	parsed.Filters["clusters.cluster_id"] = []string{}
+
+	// Convert id to name
+	for _, id := range clusterIDs {
+		clusterName, err := getClusterNameFromID(ctx, db, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				// Filter out invalid cluster IDs from the query
+				continue
+			}
+
+			reqLog.Error(err, "Failed to get cluster name from cluster ID", getPqErrKeyVals(err, "ID", id)...)
+
+			return parsed, err
+		}
+
+		if !getAccessByClusterName(allRules, clusterName) {
+			unAuthorizedClusters = append(unAuthorizedClusters, id)
+		} else {
+			parsed.Filters["clusters.cluster_id"] = append(parsed.Filters["clusters.cluster_id"], id)
+		}
+	}
+
+	parsedClusterNames := parsed.Filters["clusters.name"]
+	for _, clusterName := range parsedClusterNames {
+		if !getAccessByClusterName(allRules, clusterName) {
+			unAuthorizedClusters = append(unAuthorizedClusters, clusterName)
+		}
+	}
+
+	// There is no cluster.cluster_id or cluster.name query argument.
+	// In other words, the user requests all they have access to.
+	if len(clusterIDs) == 0 && len(parsedClusterNames) == 0 {
+		for mcName := range allRules {
+			// Add the cluster to the filter if the user has get authentication. Note that if the user has get access
+			// on all managed clusters, that gets handled at the beginning of the function.
+			if getAccessByClusterName(allRules, mcName) {
+				parsed.Filters["clusters.name"] = append(parsed.Filters["clusters.name"], mcName)
+			}
+		}
+	}
+
+	if len(unAuthorizedClusters) > 0 {
+		return parsed, fmt.Errorf("%w: the following cluster filters are not authorized: %s",
+			ErrForbidden, strings.Join(unAuthorizedClusters, ", "))
+	}
+
+	if len(parsed.Filters["clusters.name"]) == 0 && len(parsed.Filters["clusters.cluster_id"]) == 0 {
+		return parsed, ErrNoAccess
+	}
+
+	return parsed, nil
+}
+
+// generateGetComplianceEventsQuery will return a SELECT query with results ready to be parsed by
+// scanIntoComplianceEvent. The caller is responsible for adding filters to the query.
+func generateGetComplianceEventsQuery(includeSpec bool) string {
+	return generateComplianceEventsSelect(generateSelectedArgs(includeSpec))
+}
+
+// generateComplianceEventsSelect returns the SELECT query of the input columns from the compliance events joined with
+// their cluster, parent policy, and policy.
+func generateComplianceEventsSelect(selectArgs []string) string {
+	return fmt.Sprintf(`SELECT %s
+FROM
+  compliance_events
+  LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id
+  LEFT JOIN parent_policies ON compliance_events.parent_policy_id = parent_policies.id
+  LEFT JOIN policies ON compliance_events.policy_id = policies.id`,
+		strings.Join(selectArgs, ", "),
+	)
+}
+
+func generateSelectedArgs(includeSpec bool) []string {
+	selectArgs := []string{
+		"compliance_events.id",
+		"compliance_events.compliance",
+		"compliance_events.message",
+		"compliance_events.metadata",
+		"compliance_events.labels",
+		"compliance_events.reported_by",
+		"compliance_events.timestamp",
+		"clusters.cluster_id",
+		"clusters.name",
+		"parent_policies.id",
+		"parent_policies.name",
+		"parent_policies.namespace",
+		"parent_policies.categories",
+		"parent_policies.controls",
+		"parent_policies.standards",
+		"policies.id",
+		"policies.api_group",
+		"policies.kind",
+		"policies.name",
+		"policies.namespace",
+		"policies.severity",
+	}
+
+	if includeSpec {
+		selectArgs = append(selectArgs, "policies.spec")
+	}
+
+	return selectArgs
+}
+
+// generate Headers for CSV. "." replace by "_"
+// Example: parent_policies.namespace -> parent_policies_namespace
+func getCsvHeader(includeSpec bool) []string {
+	localSelectArgs := generateSelectedArgs(includeSpec)
+
+	for i, arg := range localSelectArgs {
+		localSelectArgs[i] = strings.ReplaceAll(arg, ".", "_")
+	}
+
+	return localSelectArgs
+}
+
+type Scannable interface {
+	Scan(dest ...any) error
+}
+
+// scanIntoComplianceEvent will scan the row result from the SELECT query generated by generateGetComplianceEventsQuery
+// into a ComplianceEvent object.
+func scanIntoComplianceEvent(rows Scannable, includeSpec bool) (*ComplianceEvent, error) {
+	ce := ComplianceEvent{
+		Cluster:      Cluster{},
+		Event:        EventDetails{},
+		ParentPolicy: nil,
+		Policy:       Policy{},
+	}
+
+	ppID := sql.NullInt32{}
+	ppName := sql.NullString{}
+	ppNamespace := sql.NullString{}
+	ppCategories := pq.StringArray{}
+	ppControls := pq.StringArray{}
+	ppStandards := pq.StringArray{}
+
+	scanArgs := []any{
+		&ce.EventID,
+		&ce.Event.Compliance,
+		&ce.Event.Message,
+		&ce.Event.Metadata,
+		&ce.Event.Labels,
+		&ce.Event.ReportedBy,
+		&ce.Event.Timestamp,
+		&ce.Cluster.ClusterID,
+		&ce.Cluster.Name,
+		&ppID,
+		&ppName,
+		&ppNamespace,
+		&ppCategories,
+		&ppControls,
+		&ppStandards,
+		&ce.Policy.KeyID,
+		&ce.Policy.APIGroup,
+		&ce.Policy.Kind,
+		&ce.Policy.Name,
+		&ce.Policy.Namespace,
+		&ce.Policy.Severity,
+	}
+
+	if includeSpec {
+		scanArgs = append(scanArgs, &ce.Policy.Spec)
+	}
+
+	err := rows.Scan(scanArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The parent policy is optional but when it's set, the name is guaranteed to be set.
+	if ppName.String != "" {
+		ce.ParentPolicy = &ParentPolicy{
+			KeyID:      ppID.Int32,
+			Name:       ppName.String,
+			Namespace:  ppNamespace.String,
+			Categories: ppCategories,
+			Controls:   ppControls,
+			Standards:  ppStandards,
+		}
+	}
+
+	return &ce, nil
+}
+
+// getSingleComplianceEvent handles the GET API endpoint for a single compliance event by ID.
+func getSingleComplianceEvent(db *sql.DB, w http.ResponseWriter,
+	r *http.Request, config *rest.Config,
+) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	eventIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/compliance-events/")
+
+	eventID, err := strconv.ParseUint(eventIDStr, 10, 64)
+	if err != nil {
+		writeErrMsgJSON(w, "The provided compliance event ID is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	query := fmt.Sprintf(
+		"%s\nWHERE compliance_events.id = $1 AND compliance_events.deleted_at IS NULL;",
+		generateGetComplianceEventsQuery(true),
+	)
+
+	row := db.QueryRowContext(r.Context(), query, eventID)
+	if row.Err() != nil {
+		reqLog.Error(row.Err(), "Failed to query for the compliance event", "eventID", eventID)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	complianceEvent, err := scanIntoComplianceEvent(row, true)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeComplianceEventNotFound(db, w, r, eventID)
+
+			return
+		}
+
+		reqLog.Error(err, "Failed to unmarshal the database results", getPqErrKeyVals(err)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if !authorizeComplianceEvent(w, r, config, complianceEvent.Cluster.Name) {
+		return
+	}
+
+	jsonResp, err := json.Marshal(complianceEvent)
+	if err != nil {
+		reqLog.Error(err, "Failed marshal the compliance event", "eventID", eventID)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	etag := getETag(jsonResp)
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Values("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	if _, err = w.Write(jsonResp); err != nil {
+		reqLog.Error(err, "Error writing success response")
+	}
+}
+
+// headComplianceEvent handles the HEAD API endpoint for a single compliance event by ID. It responds like
+// getSingleComplianceEvent without the body or ETag, and it only queries the cluster name needed for authorization, so
+// the compliance event and its often large policy spec aren't fetched and serialized just to check that it exists.
+func headComplianceEvent(db *sql.DB, w http.ResponseWriter, r *http.Request, config *rest.Config) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	eventIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/compliance-events/")
+
+	eventID, err := strconv.ParseUint(eventIDStr, 10, 64)
+	if err != nil {
+		writeErrMsgJSON(w, "The provided compliance event ID is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	var clusterName string
+
+	err = db.QueryRowContext(
+		r.Context(),
+		`SELECT clusters.name
+FROM
+  compliance_events
+  LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id
+WHERE compliance_events.id = $1 AND compliance_events.deleted_at IS NULL;`,
+		eventID,
+	).Scan(&clusterName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeComplianceEventNotFound(db, w, r, eventID)
+
+			return
+		}
+
+		reqLog.Error(err, "Failed to query for the compliance event", getPqErrKeyVals(err)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if !authorizeComplianceEvent(w, r, config, clusterName) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorizeComplianceEvent returns true if the user can get the managed cluster of a compliance event. Otherwise, it
+// writes the error response and returns false.
+func authorizeComplianceEvent(w http.ResponseWriter, r *http.Request, config *rest.Config, clusterName string) bool {
+	// Check auth for managedCluster GET verb
+	isAllowed, err := canGetManagedCluster(config, clusterName)
+	if err != nil {
+		ctrl.LoggerFrom(r.Context()).Error(
+			err, `Failed to get the "get" authorization for the cluster`, "cluster", clusterName,
+		)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return false
+	}
+
+	if !isAllowed {
+		writeErrMsgJSON(w, "Forbidden", http.StatusForbidden)
+
+		return false
+	}
+
+	return true
+}
+
+// writeComplianceEventNotFound writes a 410 response if the compliance event was soft deleted and a 404 response
+// otherwise.
+func writeComplianceEventNotFound(db *sql.DB, w http.ResponseWriter, r *http.Request, eventID uint64) {
+	var deleted bool
+
+	err := db.QueryRowContext(
+		r.Context(), "SELECT deleted_at IS NOT NULL FROM compliance_events WHERE id = $1", eventID,
+	).Scan(&deleted)
+	if err == nil && deleted {
+		writeErrMsgJSON(w, "The requested compliance event was deleted", http.StatusGone)
+
+		return
+	}
+
+	writeErrMsgJSON(w, "The requested compliance event was not found", http.StatusNotFound)
+}
+
+// getComplianceEventSpec handles the GET API endpoint for the policy spec of a single compliance event by ID. This lets
+// clients list compliance events without the often large policy specs and only get them on demand.
+func getComplianceEventSpec(db *sql.DB, w http.ResponseWriter, r *http.Request, config *rest.Config) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	eventIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/compliance-events/")
+	eventIDStr = strings.TrimSuffix(eventIDStr, "/spec")
+
+	eventID, err := strconv.ParseUint(eventIDStr, 10, 64)
+	if err != nil {
+		writeErrMsgJSON(w, "The provided compliance event ID is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	var clusterName string
+	var spec []byte
+
+	err = db.QueryRowContext(
+		r.Context(),
+		`SELECT clusters.name, policies.spec
+FROM
+  compliance_events
+  LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id
+  LEFT JOIN policies ON compliance_events.policy_id = policies.id
+WHERE compliance_events.id = $1 AND compliance_events.deleted_at IS NULL;`,
+		eventID,
+	).Scan(&clusterName, &spec)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeComplianceEventNotFound(db, w, r, eventID)
+
+			return
+		}
+
+		reqLog.Error(err, "Failed to query for the policy spec of the compliance event", getPqErrKeyVals(err)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if !authorizeComplianceEvent(w, r, config, clusterName) {
+		return
+	}
+
+	// Policy specs are immutable, so clients can cache the response.
+	etag := getETag(spec)
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Values("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	if _, err = w.Write(spec); err != nil {
+		reqLog.Error(err, "Error writing success response")
+	}
+}
+
+// getETag returns a weak ETag derived from the hash of the response body. Since the JSON encoding of a compliance event
+// is deterministic, the ETag is stable across server restarts and only changes when the compliance event changes, such
+// as when its message is updated. It's weak since the same ETag is used when the response is compressed.
+func getETag(body []byte) string {
+	hash := sha256.Sum256(body)
+
+	return `W/"` + hex.EncodeToString(hash[:]) + `"`
+}
+
+// etagMatches returns true if any of the entity tags in the If-None-Match header values match etag using the weak
+// comparison, which ignores the W/ prefix.
+func etagMatches(ifNoneMatch []string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, header := range ifNoneMatch {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// patchComplianceEvent handles the PATCH API endpoint for a single compliance event by ID. Only the message of the
+// compliance event can be updated since the other fields define the identity of the compliance event. The request body
+// has the same structure as a compliance event, for example: {"event": {"message": "the corrected message"}}.
+func (s *ComplianceAPIServer) patchComplianceEvent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	eventIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/compliance-events/")
+
+	eventID, err := strconv.ParseUint(eventIDStr, 10, 64)
+	if err != nil {
+		writeErrMsgJSON(w, "The provided compliance event ID is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	body, ok := readRequestBody(w, r, s.options.MaxRequestBodyBytes)
+	if !ok {
+		return
+	}
+
+	reqPatch := map[string]map[string]json.RawMessage{}
+
+	if err := json.Unmarshal(body, &reqPatch); err != nil {
+		writeErrMsgJSON(w, "Incorrectly formatted request body, must be valid JSON", http.StatusBadRequest)
+
+		return
+	}
+
+	var message *string
+
+	for field, values := range reqPatch {
+		for subfield, value := range values {
+			if field != "event" || subfield != "message" {
+				writeErrMsgJSON(
+					w,
+					fmt.Sprintf("The %s.%s field cannot be updated, only event.message can be updated", field, subfield),
+					http.StatusBadRequest,
+				)
+
+				return
+			}
+
+			if err := json.Unmarshal(value, &message); err != nil || message == nil || *message == "" {
+				writeErrMsgJSON(w, "The event.message field must be a non-empty string", http.StatusBadRequest)
+
+				return
+			}
+		}
+	}
+
+	if message == nil {
+		writeErrMsgJSON(w, "The event.message field must be provided", http.StatusBadRequest)
+
+		return
+	}
+
+	if !s.authorizeEventModification(db, w, r, eventID) {
+		return
+	}
+
+	_, err = db.ExecContext(
+		r.Context(), "UPDATE compliance_events SET message = $1 WHERE id = $2", *message, eventID,
+	)
+	if err != nil {
+		if code, reason := getDBErrStatus(err); code != http.StatusInternalServerError {
+			writeErrMsgJSON(w, "The compliance event "+reason, code)
+
+			return
+		}
+
+		reqLog.Error(err, "Failed to update the compliance event", getPqErrKeyVals(err, "eventID", eventID)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	reqLog.Info("Updated the compliance event message", "eventID", eventID)
+
+	query := fmt.Sprintf("%s\nWHERE compliance_events.id = $1;", generateGetComplianceEventsQuery(true))
+
+	complianceEvent, err := scanIntoComplianceEvent(db.QueryRowContext(r.Context(), query, eventID), true)
+	if err != nil {
+		reqLog.Error(err, "Failed to get the updated compliance event", getPqErrKeyVals(err, "eventID", eventID)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	jsonResp, err := json.Marshal(complianceEvent)
+	if err != nil {
+		reqLog.Error(err, "Failed marshal the compliance event", "eventID", eventID)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("ETag", getETag(jsonResp))
+
+	if _, err = w.Write(jsonResp); err != nil {
+		reqLog.Error(err, "Error writing success response")
+	}
+}
+
+// authorizeEventModification verifies that the compliance event exists, is not soft deleted, and that the user is
+// authorized to record compliance events for its managed cluster. If false is returned, an error response has already
+// been written.
+func (s *ComplianceAPIServer) authorizeEventModification(
+	db *sql.DB, w http.ResponseWriter, r *http.Request, eventID uint64,
+) bool {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	var clusterName string
+	var deleted bool
+
+	err := db.QueryRowContext(
+		r.Context(),
+		"SELECT clusters.name, compliance_events.deleted_at IS NOT NULL FROM compliance_events "+
+			"JOIN clusters ON compliance_events.cluster_id = clusters.id WHERE compliance_events.id = $1",
+		eventID,
+	).Scan(&clusterName, &deleted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeErrMsgJSON(w, "The requested compliance event was not found", http.StatusNotFound)
+
+			return false
+		}
+
+		reqLog.Error(err, "Failed to query for the compliance event", getPqErrKeyVals(err, "eventID", eventID)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return false
+	}
+
+	allowed, err := canRecordComplianceEvent(s.cfg, clusterName, r)
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			writeErrMsgJSON(w, "Unauthorized", http.StatusUnauthorized)
+
+			return false
+		}
+
+		reqLog.Error(err, "error determining if the user is authorized for modifying compliance events")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return false
+	}
+
+	if !allowed {
+		// Logging is handled by canRecordComplianceEvent
+		writeErrMsgJSON(w, "Forbidden", http.StatusForbidden)
+
+		return false
+	}
+
+	if deleted {
+		writeErrMsgJSON(w, "The requested compliance event was deleted", http.StatusGone)
+
+		return false
+	}
+
+	return true
+}
+
+// deleteComplianceEvent handles the DELETE API endpoint for a single compliance event by ID. The compliance event is
+// soft deleted by setting its deleted_at column so that it's excluded from the API responses while the row remains.
+func (s *ComplianceAPIServer) deleteComplianceEvent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	eventIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/compliance-events/")
+
+	eventID, err := strconv.ParseUint(eventIDStr, 10, 64)
+	if err != nil {
+		writeErrMsgJSON(w, "The provided compliance event ID is invalid", http.StatusBadRequest)
+
+		return
+	}
+
+	if !s.authorizeEventModification(db, w, r, eventID) {
+		return
+	}
+
+	result, err := db.ExecContext(
+		r.Context(),
+		"UPDATE compliance_events SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL",
+		eventID,
+	)
+	if err != nil {
+		reqLog.Error(err, "Failed to delete the compliance event", getPqErrKeyVals(err, "eventID", eventID)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	// A concurrent request may have deleted the compliance event after it was checked.
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		writeErrMsgJSON(w, "The requested compliance event was deleted", http.StatusGone)
+
+		return
+	}
+
+	reqLog.Info("Soft deleted the compliance event", "eventID", eventID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readRequestBody reads the request body, which may not be larger than maxBytes. The limit applies to the decoded
+// body, so it can't be bypassed with a chunked Transfer-Encoding and no Content-Length header. If the body can't be
+// read, an error response is written and false is returned.
+func readRequestBody(w http.ResponseWriter, r *http.Request, maxBytes int64) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeErrMsgJSON(
+				w,
+				fmt.Sprintf("The request body must not be larger than %d bytes", maxBytesErr.Limit),
+				http.StatusRequestEntityTooLarge,
+			)
+
+			return nil, false
+		}
+
+		ctrl.LoggerFrom(r.Context()).Error(err, "error reading request body")
+		writeErrMsgJSON(w, "Could not read request body", http.StatusBadRequest)
+
+		return nil, false
+	}
+
+	return body, true
+}
+
+// decodeRequestBody unmarshals the JSON request body into v. When strict is true, an object key that doesn't match a
+// field of v is an error rather than being ignored so that a typo in a field name isn't silently dropped. If the body
+// can't be unmarshaled, a 400 response is written and false is returned.
+func decodeRequestBody(w http.ResponseWriter, body []byte, v any, strict bool) bool {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	err := decoder.Decode(v)
+	if err == nil {
+		// Match json.Unmarshal by rejecting anything after the JSON value.
+		if _, trailingErr := decoder.Token(); trailingErr != io.EOF {
+			err = errors.New("invalid character after top-level value")
+		}
+	}
+
+	if err == nil {
+		return true
+	}
+
+	// The json package doesn't have a typed error for unknown fields, so the field name is parsed from the message.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		writeErrMsgJSON(w, "The request body has an unknown field: "+field, http.StatusBadRequest)
+	} else {
+		writeErrMsgJSON(w, "Incorrectly formatted request body, must be valid JSON", http.StatusBadRequest)
+	}
+
+	return false
+}
+
+// getPqErrKeyVals is a helper to add additional database error details to a log message. additionalKeyVals is provided
+// as a convenience so that the keys don't need to be explicitly set to interface{} types when using the
+// `getPqErrKeyVals(err, "key1", "val1")...“ syntax.
+func getPqErrKeyVals(err error, additionalKeyVals ...interface{}) []interface{} {
+	var pqErr *pq.Error
+
+	if errors.As(err, &pqErr) {
+		return append(
+			[]interface{}{"dbMessage", pqErr.Message, "dbDetail", pqErr.Detail, "dbCode", pqErr.Code},
+			additionalKeyVals...,
+		)
+	}
+
+	// Other drivers only expose the error code in a driver independent way.
+	if code := getSQLState(err); code != "" {
+		return append([]interface{}{"dbCode", code}, additionalKeyVals...)
+	}
+
+	return additionalKeyVals
+}
+
+func getClusterNameFromID(ctx context.Context, db *sql.DB, clusterID string) (name string, err error) {
+	err = db.QueryRowContext(ctx,
+		`SELECT name FROM clusters WHERE cluster_id = $1`, clusterID,
+	).Scan(&name)
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// getWhereClause will convert the input queryOptions to a WHERE statement and return the filter values for a prepared
+// statement.
+func getWhereClause(options *queryOptions) (string, []any) {
+	filterSQL := []string{}
+	filterValues := []any{}
+
+	for sqlColumn, values := range options.Filters {
+		if len(values) == 0 {
+			continue
+		}
+
+		for i, value := range values {
+			filterValues = append(filterValues, value)
+			// For example: compliance_events.name=$1
+			filter := fmt.Sprintf("%s=$%d", sqlColumn, len(filterValues))
+			if i == 0 {
+				filterSQL = append(filterSQL, "("+filter)
+			} else {
+				filterSQL[len(filterSQL)-1] += " OR " + filter
+			}
+		}
+
+		filterSQL[len(filterSQL)-1] += ")"
+	}
+
+	for sqlColumn, values := range options.ArrayFilters {
+		if len(values) == 0 {
+			continue
+		}
+
+		for i, value := range values {
+			filterValues = append(filterValues, value)
+
+			// For example: $1=ANY(parent_policies.categories)
+			filter := fmt.Sprintf("$%d=ANY(%s)", len(filterValues), sqlColumn)
+			if i == 0 {
+				filterSQL = append(filterSQL, "("+filter)
+			} else {
+				filterSQL[len(filterSQL)-1] += " OR " + filter
+			}
+		}
+
+		filterSQL[len(filterSQL)-1] += ")"
+	}
+
+	for labelKey, values := range options.LabelFilters {
+		for i, value := range values {
+			// Marshaling a map of strings can't fail.
+			label, _ := json.Marshal(map[string]string{labelKey: value})
+			filterValues = append(filterValues, string(label))
+
+			// For example: compliance_events.labels @> $1::jsonb, which can use the GIN index on the labels column
+			filter := fmt.Sprintf("compliance_events.labels @> $%d::jsonb", len(filterValues))
+			if i == 0 {
+				filterSQL = append(filterSQL, "("+filter)
+			} else {
+				filterSQL[len(filterSQL)-1] += " OR " + filter
+			}
+		}
+
+		filterSQL[len(filterSQL)-1] += ")"
+	}
+
+	for _, sqlColumn := range options.NullFilters {
+		filterSQL = append(filterSQL, fmt.Sprintf("%s IS NULL", sqlColumn))
+	}
+
+	if options.MessageIncludes != "" {
+		filterValues = append(filterValues, options.MessageIncludes)
+
+		// This is case-insensitive since it's meant for searching for a resource name or error string while triaging.
+		filterSQL = append(filterSQL, fmt.Sprintf("compliance_events.message ILIKE $%d", len(filterValues)))
+	}
+
+	if options.MessageLike != "" {
+		filterValues = append(filterValues, options.MessageLike)
+
+		filterSQL = append(filterSQL, fmt.Sprintf("compliance_events.message LIKE $%d", len(filterValues)))
+	}
+
+	if !options.TimestampAfter.IsZero() {
+		filterValues = append(filterValues, options.TimestampAfter)
+
+		filterSQL = append(filterSQL, fmt.Sprintf("compliance_events.timestamp > $%d", len(filterValues)))
+	}
+
+	if !options.TimestampBefore.IsZero() {
+		filterValues = append(filterValues, options.TimestampBefore)
+
+		filterSQL = append(filterSQL, fmt.Sprintf("compliance_events.timestamp < $%d", len(filterValues)))
+	}
+
+	var whereClause string
+
+	if len(filterSQL) > 0 {
+		// For example:
+		// WHERE (policy.name=$1) AND ($2=ANY(parent_policies.categories) OR $3=ANY(parent_policies.categories))
+		whereClause = "\nWHERE " + strings.Join(filterSQL, " AND ")
+	}
+
+	// The filters select the compliance events that the latest compliance event of each policy on each cluster is
+	// chosen from, so the outer query only needs to match on the IDs. The ID is the tie breaker for equal timestamps.
+	if options.LatestOnly {
+		whereClause = `
+WHERE compliance_events.id IN (
+  SELECT DISTINCT ON (compliance_events.cluster_id, compliance_events.policy_id) compliance_events.id
+  FROM compliance_events
+  LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id
+  LEFT JOIN parent_policies ON compliance_events.parent_policy_id = parent_policies.id
+  LEFT JOIN policies ON compliance_events.policy_id = policies.id` + whereClause + `
+  ORDER BY compliance_events.cluster_id, compliance_events.policy_id, compliance_events.timestamp DESC,
+    compliance_events.id DESC
+)`
+	}
+
+	return whereClause, filterValues
+}
+
+// logQuery logs the SQL query and its values at the debug level so that slow or unexpected results can be traced back
+// to the query that produced them.
+func logQuery(ctx context.Context, query string, values []any) {
+	ctrl.LoggerFrom(ctx).V(1).Info("Querying the database", "query", query, "values", values)
+}
+
+// getComplianceEventsStats handles the stats API endpoint, which counts the compliance events matching the same
+// filters as the list API endpoint, grouped by compliance state. The pagination and sort query arguments are ignored.
+func getComplianceEventsStats(db *sql.DB, w http.ResponseWriter, r *http.Request, userConfig *rest.Config) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	response := StatsResponse{Counts: make(map[string]uint64, len(validComplianceStates))}
+
+	for _, compliance := range validComplianceStates {
+		response.Counts[compliance] = 0
+	}
+
+	queryArgs, err := parseQueryArgs(r.Context(), r.URL.Query(), db, userConfig, "json")
+	if err != nil && !errors.Is(err, ErrNoAccess) {
+		if errors.Is(err, ErrForbidden) {
+			writeErrMsgJSON(w, err.Error(), http.StatusForbidden)
+
+			return
+		}
+
+		if errors.Is(err, ErrInvalidQueryArg) || errors.Is(err, ErrInvalidQueryArgValue) ||
+			errors.Is(err, ErrInvalidSortOption) {
+			writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		writeErrMsgJSON(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	// When the user has no access to any managed cluster, the counts are all 0.
+	if err == nil {
+		whereClause, filterValues := getWhereClause(queryArgs)
+
+		statsQuery := `SELECT compliance_events.compliance, COUNT(*) FROM compliance_events
+LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id
+LEFT JOIN parent_policies ON compliance_events.parent_policy_id = parent_policies.id
+LEFT JOIN policies ON compliance_events.policy_id = policies.id` + whereClause + `
+GROUP BY compliance_events.compliance` // #nosec G202
 
-			parsed.TimestampBefore, err = time.Parse(time.RFC3339, value)
-			if err != nil {
-				return nil, fmt.Errorf(
-					"%w: event.timestamp_before must be in the format of RFC 3339", ErrInvalidQueryArgValue,
-				)
-			}
-		case "event.timestamp_after":
-			var err error
+		logQuery(r.Context(), statsQuery, filterValues)
 
-			parsed.TimestampAfter, err = time.Parse(time.RFC3339, value)
-			if err != nil {
-				return nil, fmt.Errorf(
-					"%w: event.timestamp_after must be in the format of RFC 3339", ErrInvalidQueryArgValue,
-				)
+		rows, err := db.QueryContext(r.Context(), statsQuery, filterValues...)
+		if err == nil {
+			err = rows.Err()
+		}
+
+		if err != nil {
+			reqLog.Error(err, "Failed to query for the compliance event stats", getPqErrKeyVals(err)...)
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var compliance string
+			var count uint64
+
+			if err := rows.Scan(&compliance, &count); err != nil {
+				reqLog.Error(err, "Failed to unmarshal the compliance event stats")
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+				return
 			}
-		default:
-			// Standard string filtering
-			parsed.Filters[sqlName] = splitQueryValue(value)
+
+			response.Counts[compliance] = count
+			response.Total += count
 		}
 	}
 
-	parsed, err := setAuthorizedClusters(ctx, db, parsed, userConfig)
+	jsonResp, err := json.Marshal(response)
 	if err != nil {
-		// ErrNoAccess needs queryOptions
-		return parsed, err
+		reqLog.Error(err, "Failed to marshal the response")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
 	}
 
-	return parsed, nil
+	if _, err = w.Write(jsonResp); err != nil {
+		reqLog.Error(err, "Error writing success response")
+	}
 }
 
-// setAuthorizedClusters verifies that if a cluster filter is provided,
-// the user has access to this filter. If no cluster filter is provided,
-// it sets the cluster filter to all managed clusters the user has access to.
-// If the user has no access, then ErrNoAccess is returned.
-func setAuthorizedClusters(ctx context.Context, db *sql.DB, parsed *queryOptions,
-	userConfig *rest.Config,
-) (*queryOptions, error) {
-	unAuthorizedClusters := []string{}
+// getComplianceEvents handles the list API endpoint for compliance events.
+func getComplianceEvents(db *sql.DB, w http.ResponseWriter,
+	r *http.Request, userConfig *rest.Config,
+) {
+	reqLog := ctrl.LoggerFrom(r.Context())
 
-	// Get all managedCluster rules
-	allRules, err := getManagedClusterRules(userConfig, nil)
+	queryArgs, err := parseQueryArgs(r.Context(), r.URL.Query(), db, userConfig, "json")
 	if err != nil {
-		return parsed, err
-	}
+		if errors.Is(err, ErrForbidden) {
+			writeErrMsgJSON(w, err.Error(), http.StatusForbidden)
 
-	if slices.Contains(allRules["*"], "get") || slices.Contains(allRules["*"], "*") {
-		return parsed, nil
-	}
+			return
+		}
 
-	clusterIDs := parsed.Filters["clusters.cluster_id"]
-	// Temporarily reset clusters.cluster_id and repopulate with all known cluster IDs
-	parsed.Filters["clusters.cluster_id"] = []string{}
+		if errors.Is(err, ErrNoAccess) {
+			response := ListResponse{
+				Data: []ComplianceEvent{},
+				Metadata: metadata{
+					Page:    queryArgs.Page,
+					Pages:   0,
+					PerPage: queryArgs.PerPage,
+					Total:   0,
+				},
+			}
 
-	// Convert id to name
-	for _, id := range clusterIDs {
-		clusterName, err := getClusterNameFromID(ctx, db, id)
-		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				// Filter out invalid cluster IDs from the query
-				continue
+			jsonResp, err := json.Marshal(response)
+			if err != nil {
+				reqLog.Error(err, "Failed to marshal an empty response")
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+				return
 			}
 
-			log.Error(err, "Failed to get cluster name from cluster ID", getPqErrKeyVals(err, "ID", id)...)
+			if _, err = w.Write(jsonResp); err != nil {
+				reqLog.Error(err, "Error writing empty response")
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+			}
 
-			return parsed, err
+			return
 		}
 
-		if !getAccessByClusterName(allRules, clusterName) {
-			unAuthorizedClusters = append(unAuthorizedClusters, id)
-		} else {
-			parsed.Filters["clusters.cluster_id"] = append(parsed.Filters["clusters.cluster_id"], id)
-		}
-	}
+		if errors.Is(err, ErrInvalidQueryArg) || errors.Is(err, ErrInvalidQueryArgValue) ||
+			errors.Is(err, ErrInvalidSortOption) {
+			writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
 
-	parsedClusterNames := parsed.Filters["clusters.name"]
-	for _, clusterName := range parsedClusterNames {
-		if !getAccessByClusterName(allRules, clusterName) {
-			unAuthorizedClusters = append(unAuthorizedClusters, clusterName)
+			return
 		}
+
+		writeErrMsgJSON(w, err.Error(), http.StatusInternalServerError)
+
+		return
 	}
 
-	// There is no cluster.cluster_id or cluster.name query argument.
-	// In other words, the user requests all they have access to.
-	if len(clusterIDs) == 0 && len(parsedClusterNames) == 0 {
-		for mcName := range allRules {
-			// Add the cluster to the filter if the user has get authentication. Note that if the user has get access
-			// on all managed clusters, that gets handled at the beginning of the function.
-			if getAccessByClusterName(allRules, mcName) {
-				parsed.Filters["clusters.name"] = append(parsed.Filters["clusters.name"], mcName)
-			}
-		}
+	// Note that the where clause could be an empty string if not filters were passed in the query arguments.
+	whereClause, filterValues := getWhereClause(queryArgs)
+
+	query := getComplianceEventsQuery(whereClause, queryArgs)
+	pageFilterValues := filterValues
+
+	// The cursor is only applied to the page query so that the total is still the count of all matching compliance
+	// events.
+	if queryArgs.Cursor != nil {
+		var pageWhereClause string
+
+		pageWhereClause, pageFilterValues = addCursorFilter(
+			whereClause, slices.Clone(filterValues), queryArgs.Cursor, queryArgs.Direction,
+		)
+		query = getComplianceEventsQuery(pageWhereClause, queryArgs)
 	}
 
-	if len(unAuthorizedClusters) > 0 {
-		return parsed, fmt.Errorf("%w: the following cluster filters are not authorized: %s",
-			ErrForbidden, strings.Join(unAuthorizedClusters, ", "))
+	logQuery(r.Context(), query, pageFilterValues)
+
+	rows, err := db.QueryContext(r.Context(), query, pageFilterValues...)
+	if err == nil {
+		err = rows.Err()
 	}
 
-	if len(parsed.Filters["clusters.name"]) == 0 && len(parsed.Filters["clusters.cluster_id"]) == 0 {
-		return parsed, ErrNoAccess
+	if err != nil {
+		reqLog.Error(err, "Failed to query for compliance events")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
 	}
 
-	return parsed, nil
-}
+	defer rows.Close()
 
-// generateGetComplianceEventsQuery will return a SELECT query with results ready to be parsed by
-// scanIntoComplianceEvent. The caller is responsible for adding filters to the query.
-func generateGetComplianceEventsQuery(includeSpec bool) string {
-	return fmt.Sprintf(`SELECT %s
-FROM
-  compliance_events
-  LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id
-  LEFT JOIN parent_policies ON compliance_events.parent_policy_id = parent_policies.id
-  LEFT JOIN policies ON compliance_events.policy_id = policies.id`,
-		strings.Join(generateSelectedArgs(includeSpec), ", "),
-	)
-}
+	complianceEvents := make([]ComplianceEvent, 0, queryArgs.PerPage)
+	// With the fields query argument, complianceEvents only has the ID and timestamp of each projected compliance event.
+	var projectedEvents []map[string]any
 
-func generateSelectedArgs(includeSpec bool) []string {
-	selectArgs := []string{
-		"compliance_events.id",
-		"compliance_events.compliance",
-		"compliance_events.message",
-		"compliance_events.metadata",
-		"compliance_events.reported_by",
-		"compliance_events.timestamp",
-		"clusters.cluster_id",
-		"clusters.name",
-		"parent_policies.id",
-		"parent_policies.name",
-		"parent_policies.namespace",
-		"parent_policies.categories",
-		"parent_policies.controls",
-		"parent_policies.standards",
-		"policies.id",
-		"policies.api_group",
-		"policies.kind",
-		"policies.name",
-		"policies.namespace",
-		"policies.severity",
+	for rows.Next() {
+		var ce *ComplianceEvent
+
+		if queryArgs.Fields != nil {
+			var projected map[string]any
+
+			ce, projected, err = scanIntoProjectedEvent(rows, queryArgs.Fields)
+			projectedEvents = append(projectedEvents, projected)
+		} else {
+			ce, err = scanIntoComplianceEvent(rows, queryArgs.IncludeSpec)
+		}
+
+		if err != nil {
+			reqLog.Error(err, "Failed to unmarshal the database results")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+
+		complianceEvents = append(complianceEvents, *ce)
 	}
 
-	if includeSpec {
-		selectArgs = append(selectArgs, "policies.spec")
+	var nextCursor string
+
+	// One extra compliance event is queried with cursor based pagination to determine if there is a next page.
+	if queryArgs.CursorPaging && uint64(len(complianceEvents)) > queryArgs.PerPage {
+		complianceEvents = complianceEvents[:queryArgs.PerPage]
+		last := complianceEvents[len(complianceEvents)-1]
+		nextCursor = eventCursor{Timestamp: last.Event.Timestamp, ID: last.EventID}.String()
 	}
 
-	return selectArgs
-}
+	countQuery := `SELECT COUNT(*) FROM compliance_events
+LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id
+LEFT JOIN parent_policies ON compliance_events.parent_policy_id = parent_policies.id
+LEFT JOIN policies ON compliance_events.policy_id = policies.id` + whereClause // #nosec G202
 
-// generate Headers for CSV. "." replace by "_"
-// Example: parent_policies.namespace -> parent_policies_namespace
-func getCsvHeader(includeSpec bool) []string {
-	localSelectArgs := generateSelectedArgs(includeSpec)
+	logQuery(r.Context(), countQuery, filterValues)
 
-	for i, arg := range localSelectArgs {
-		localSelectArgs[i] = strings.ReplaceAll(arg, ".", "_")
-	}
+	row := db.QueryRowContext(r.Context(), countQuery, filterValues...)
 
-	return localSelectArgs
-}
+	var total uint64
 
-type Scannable interface {
-	Scan(dest ...any) error
-}
+	if err := row.Scan(&total); err != nil {
+		reqLog.Error(err, "Failed to get the count of compliance events", getPqErrKeyVals(err)...)
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
-// scanIntoComplianceEvent will scan the row result from the SELECT query generated by generateGetComplianceEventsQuery
-// into a ComplianceEvent object.
-func scanIntoComplianceEvent(rows Scannable, includeSpec bool) (*ComplianceEvent, error) {
-	ce := ComplianceEvent{
-		Cluster:      Cluster{},
-		Event:        EventDetails{},
-		ParentPolicy: nil,
-		Policy:       Policy{},
+		return
 	}
 
-	ppID := sql.NullInt32{}
-	ppName := sql.NullString{}
-	ppNamespace := sql.NullString{}
-	ppCategories := pq.StringArray{}
-	ppControls := pq.StringArray{}
-	ppStandards := pq.StringArray{}
+	pages := math.Ceil(float64(total) / float64(queryArgs.PerPage))
 
-	scanArgs := []any{
-		&ce.EventID,
-		&ce.Event.Compliance,
-		&ce.Event.Message,
-		&ce.Event.Metadata,
-		&ce.Event.ReportedBy,
-		&ce.Event.Timestamp,
-		&ce.Cluster.ClusterID,
-		&ce.Cluster.Name,
-		&ppID,
-		&ppName,
-		&ppNamespace,
-		&ppCategories,
-		&ppControls,
-		&ppStandards,
-		&ce.Policy.KeyID,
-		&ce.Policy.APIGroup,
-		&ce.Policy.Kind,
-		&ce.Policy.Name,
-		&ce.Policy.Namespace,
-		&ce.Policy.Severity,
+	responseMetadata := metadata{
+		Page:       queryArgs.Page,
+		Pages:      uint64(pages),
+		PerPage:    queryArgs.PerPage,
+		Total:      total,
+		NextCursor: nextCursor,
 	}
 
-	if includeSpec {
-		scanArgs = append(scanArgs, &ce.Policy.Spec)
+	var response any = ListResponse{Data: complianceEvents, Metadata: responseMetadata}
+
+	if queryArgs.Fields != nil {
+		// This excludes the extra compliance event queried with cursor based pagination.
+		projectedEvents = projectedEvents[:len(complianceEvents)]
+
+		if projectedEvents == nil {
+			projectedEvents = []map[string]any{}
+		}
+
+		response = ProjectedListResponse{Data: projectedEvents, Metadata: responseMetadata}
 	}
 
-	err := rows.Scan(scanArgs...)
+	jsonResp, err := json.Marshal(response)
 	if err != nil {
-		return nil, err
-	}
+		reqLog.Error(err, "Failed to marshal the response")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
-	// The parent policy is optional but when it's set, the name is guaranteed to be set.
-	if ppName.String != "" {
-		ce.ParentPolicy = &ParentPolicy{
-			KeyID:      ppID.Int32,
-			Name:       ppName.String,
-			Namespace:  ppNamespace.String,
-			Categories: ppCategories,
-			Controls:   ppControls,
-			Standards:  ppStandards,
-		}
+		return
 	}
 
-	return &ce, nil
+	if _, err = w.Write(jsonResp); err != nil {
+		reqLog.Error(err, "Error writing success response")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
 }
 
-// getSingleComplianceEvent handles the GET API endpoint for a single compliance event by ID.
-func getSingleComplianceEvent(db *sql.DB, w http.ResponseWriter,
-	r *http.Request, config *rest.Config,
+// postComplianceEvent assumes you have a read lock already attained.
+func (s *ComplianceAPIServer) postComplianceEvent(
+	serverContext *ComplianceServerCtx, w http.ResponseWriter, r *http.Request,
 ) {
-	eventIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/compliance-events/")
+	reqLog := ctrl.LoggerFrom(r.Context())
 
-	eventID, err := strconv.ParseUint(eventIDStr, 10, 64)
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		writeErrMsgJSON(w, "The provided compliance event ID is invalid", http.StatusBadRequest)
+		writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
 
 		return
 	}
 
-	query := fmt.Sprintf("%s\nWHERE compliance_events.id = $1;", generateGetComplianceEventsQuery(true))
-
-	row := db.QueryRowContext(r.Context(), query, eventID)
-	if row.Err() != nil {
-		log.Error(row.Err(), "Failed to query for the compliance event", "eventID", eventID)
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+	// The database can only be unset here if the event queue let the request through, which a dry run can't use.
+	if dryRun && writeDBUnavailable(serverContext, w) {
+		return
+	}
 
+	body, ok := readRequestBody(w, r, s.options.MaxRequestBodyBytes)
+	if !ok {
 		return
 	}
 
-	complianceEvent, err := scanIntoComplianceEvent(row, true)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			writeErrMsgJSON(w, "The requested compliance event was not found", http.StatusNotFound)
+	// YAML is converted to JSON so that the rest of the request handling, including how the policy spec is stored, is
+	// the same regardless of the content type.
+	if isYAMLRequest(r) {
+		body, err = yaml.YAMLToJSON(body)
+		if err != nil {
+			writeErrMsgJSON(w, "Incorrectly formatted request body, must be valid YAML", http.StatusBadRequest)
 
 			return
 		}
+	}
 
-		log.Error(err, "Failed to unmarshal the database results", getPqErrKeyVals(err)...)
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+	if s.schemaValidator != nil {
+		if err := s.schemaValidator.validateComplianceEvents(body); err != nil {
+			if errors.Is(err, errSchemaRequestNotJSON) {
+				writeErrMsgJSON(w, "Incorrectly formatted request body, must be valid JSON", http.StatusBadRequest)
+			} else {
+				writeValidationErrJSON(w, err.Error(), getFieldErrors(err))
+			}
+
+			return
+		}
+	}
+
+	// A JSON array in the request body means multiple compliance events are being recorded at once.
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		if writeDBUnavailable(serverContext, w) {
+			return
+		}
+
+		s.postComplianceEvents(serverContext, w, r, body, dryRun)
 
 		return
 	}
 
-	// Check auth for managedCluster GET verb
-	isAllowed, err := canGetManagedCluster(config, complianceEvent.Cluster.Name)
-	if err != nil {
-		log.Error(err, `Failed to get the "get" authorization for the cluster`,
-			"cluster", complianceEvent.Cluster.Name)
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+	reqEvent := &ComplianceEvent{}
 
+	if !decodeRequestBody(w, body, reqEvent, s.options.StrictJSON) {
 		return
 	}
 
-	if !isAllowed {
-		writeErrMsgJSON(w, "Forbidden", http.StatusForbidden)
+	// The database IDs in the shorthand approach can't be validated without the database.
+	if reqEvent.usesDatabaseIDs() && writeDBUnavailable(serverContext, w) {
+		return
+	}
+
+	if err := reqEvent.Validate(r.Context(), serverContext, s.options.MaxPolicySpecBytes); err != nil {
+		writeValidationErrJSON(w, err.Error(), getFieldErrors(err))
 
 		return
 	}
 
-	jsonResp, err := json.Marshal(complianceEvent)
+	allowed, err := canRecordComplianceEvent(s.cfg, reqEvent.Cluster.Name, r)
 	if err != nil {
-		log.Error(err, "Failed marshal the compliance event", "eventID", eventID)
+		if errors.Is(err, ErrUnauthorized) {
+			writeErrMsgJSON(w, "Unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		reqLog.Error(err, "error determining if the user is authorized for recording compliance events")
 		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
 		return
 	}
 
-	if _, err = w.Write(jsonResp); err != nil {
-		log.Error(err, "Error writing success response")
+	if !allowed {
+		// Logging is handled by canRecordComplianceEvent
+		writeErrMsgJSON(w, "Forbidden", http.StatusForbidden)
+
+		return
 	}
-}
 
-// getPqErrKeyVals is a helper to add additional database error details to a log message. additionalKeyVals is provided
-// as a convenience so that the keys don't need to be explicitly set to interface{} types when using the
-// `getPqErrKeyVals(err, "key1", "val1")...“ syntax.
-func getPqErrKeyVals(err error, additionalKeyVals ...interface{}) []interface{} {
-	var pqErr *pq.Error
+	var reservation *idempotencyReservation
 
-	if errors.As(err, &pqErr) {
-		return append(
-			[]interface{}{"dbMessage", pqErr.Message, "dbDetail", pqErr.Detail, "dbCode", pqErr.Code},
-			additionalKeyVals...,
-		)
-	}
+	// A dry run never replays or reserves an Idempotency-Key header since nothing is persisted.
+	if !dryRun {
+		var ok bool
 
-	return additionalKeyVals
-}
+		reservation, ok = reserveIdempotencyKey(w, r, body)
+		if !ok {
+			return
+		}
 
-func getClusterNameFromID(ctx context.Context, db *sql.DB, clusterID string) (name string, err error) {
-	err = db.QueryRowContext(ctx,
-		`SELECT name FROM clusters WHERE cluster_id = $1`, clusterID,
-	).Scan(&name)
-	if err != nil {
-		return "", err
+		// This is a no-op once the compliance event is recorded, so a failed request can be retried with the same key.
+		defer reservation.release()
 	}
 
-	return name, nil
-}
+	if !dryRun && s.eventQueue != nil {
+		if s.enqueueComplianceEvent(w, r, reqEvent, reservation) {
+			return
+		}
 
-// getWhereClause will convert the input queryOptions to a WHERE statement and return the filter values for a prepared
-// statement.
-func getWhereClause(options *queryOptions) (string, []any) {
-	filterSQL := []string{}
-	filterValues := []any{}
+		if !s.options.EventQueueSyncFallback {
+			w.Header().Set("Retry-After", "1")
+			writeErrMsgJSON(w, "The compliance event queue is full", http.StatusServiceUnavailable)
 
-	for sqlColumn, values := range options.Filters {
-		if len(values) == 0 {
-			continue
+			return
 		}
 
-		for i, value := range values {
-			filterValues = append(filterValues, value)
-			// For example: compliance_events.name=$1
-			filter := fmt.Sprintf("%s=$%d", sqlColumn, len(filterValues))
-			if i == 0 {
-				filterSQL = append(filterSQL, "("+filter)
-			} else {
-				filterSQL[len(filterSQL)-1] += " OR " + filter
-			}
+		if writeDBUnavailable(serverContext, w) {
+			return
 		}
+	}
 
-		filterSQL[len(filterSQL)-1] += ")"
+	var deduplicated bool
+
+	if !dryRun && s.insertBatcher != nil {
+		deduplicated, err = s.insertBatcher.insert(r.Context(), reqEvent)
+	} else {
+		deduplicated, err = s.insertComplianceEvent(r.Context(), serverContext, reqEvent, dryRun)
 	}
 
-	for sqlColumn, values := range options.ArrayFilters {
-		if len(values) == 0 {
-			continue
+	if err != nil {
+		if clientDisconnected(r) {
+			reqLog.V(2).Info("The client disconnected before the compliance event was recorded")
+
+			return
 		}
 
-		for i, value := range values {
-			filterValues = append(filterValues, value)
+		code, reason := getDBErrStatus(err)
 
-			// For example: $1=ANY(parent_policies.categories)
-			filter := fmt.Sprintf("$%d=ANY(%s)", len(filterValues), sqlColumn)
-			if i == 0 {
-				filterSQL = append(filterSQL, "("+filter)
-			} else {
-				filterSQL[len(filterSQL)-1] += " OR " + filter
-			}
+		// A duplicate is expected, but other errors are logged and a foreign key violation clears the caches.
+		if code != http.StatusConflict {
+			handleInsertErr(r.Context(), serverContext, err)
 		}
 
-		filterSQL[len(filterSQL)-1] += ")"
+		if code == http.StatusInternalServerError {
+			writeErrMsgJSON(w, "Internal Error", code)
+		} else {
+			writeErrMsgJSON(w, "The compliance event "+reason, code)
+		}
+
+		return
 	}
 
-	for _, sqlColumn := range options.NullFilters {
-		filterSQL = append(filterSQL, fmt.Sprintf("%s IS NULL", sqlColumn))
+	code := http.StatusCreated
+
+	switch {
+	case dryRun:
+		code = http.StatusOK
+	case deduplicated:
+		code = http.StatusOK
+	default:
+		eventsCreatedMetric.Inc()
+		s.auditLog.recordCreated(w, r, reqEvent)
+		s.eventStream.publish(reqEvent)
+		s.webhook.notify(reqEvent)
 	}
 
-	if options.MessageIncludes != "" {
-		filterValues = append(filterValues, options.MessageIncludes)
+	// The database IDs from a dry run were rolled back, so they must not be cached.
+	if !dryRun {
+		cacheForeignKeys(serverContext, reqEvent)
+	}
 
-		filterSQL = append(filterSQL, fmt.Sprintf("compliance_events.message LIKE $%d", len(filterValues)))
+	reqEvent.EventID = reqEvent.Event.KeyID
+
+	// remove the spec so it's not returned in the JSON.
+	reqEvent.Policy.Spec = nil
+
+	minimal := prefersMinimalReturn(r)
+
+	var resp []byte
+
+	if !minimal {
+		resp, err = json.Marshal(reqEvent)
+		if err != nil {
+			reqLog.Error(err, "error marshaling reqEvent for the response")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
 	}
 
-	if options.MessageLike != "" {
-		filterValues = append(filterValues, options.MessageLike)
+	if dryRun {
+		setDryRunHeaders(w, r)
+	} else {
+		reservation.complete(1, []int32{reqEvent.EventID})
 
-		filterSQL = append(filterSQL, fmt.Sprintf("compliance_events.message LIKE $%d", len(filterValues)))
+		w.Header().Set(
+			"Location", fmt.Sprintf("%s/api/v1/compliance-events/%d", s.options.BasePath, reqEvent.Event.KeyID),
+		)
 	}
 
-	if !options.TimestampAfter.IsZero() {
-		filterValues = append(filterValues, options.TimestampAfter)
+	if minimal {
+		writeMinimalReturn(w, code)
 
-		filterSQL = append(filterSQL, fmt.Sprintf("compliance_events.timestamp > $%d", len(filterValues)))
+		return
 	}
 
-	if !options.TimestampBefore.IsZero() {
-		filterValues = append(filterValues, options.TimestampBefore)
+	w.WriteHeader(code)
 
-		filterSQL = append(filterSQL, fmt.Sprintf("compliance_events.timestamp < $%d", len(filterValues)))
+	if _, err = w.Write(resp); err != nil {
+		reqLog.Error(err, "error writing success response")
 	}
+}
 
-	var whereClause string
+// insertComplianceEvent records the compliance event and its foreign key rows. True is returned if an identical
+// compliance event was recently recorded, in which case the compliance event's ID and timestamp are set to the existing
+// one's instead of inserting it. In a dry run, the transaction is rolled back. It assumes you have a read lock already
+// attained.
+func (s *ComplianceAPIServer) insertComplianceEvent(
+	ctx context.Context, serverContext *ComplianceServerCtx, reqEvent *ComplianceEvent, dryRun bool,
+) (bool, error) {
+	var deduplicated bool
+
+	// The foreign key rows and the compliance event are created in a single transaction so that an error does not
+	// leave behind rows that aren't referenced by a compliance event. The whole transaction is retried on transient
+	// database errors since the transaction can't be used after a connection error. It's also retried once on a
+	// foreign key violation since a cached database ID may refer to a row that was deleted.
+	err := retryStaleForeignKeys(ctx, serverContext, []*ComplianceEvent{reqEvent}, func() error {
+		return s.retryTransientDBErrors(ctx, func() error {
+			return inTransaction(ctx, serverContext.DB, func(tx *sql.Tx) error {
+				db := serverContext.preparedTx(tx)
+
+				if err := setForeignKeys(ctx, serverContext, db, reqEvent); err != nil {
+					return err
+				}
 
-	if len(filterSQL) > 0 {
-		// For example:
-		// WHERE (policy.name=$1) AND ($2=ANY(parent_policies.categories) OR $3=ANY(parent_policies.categories))
-		whereClause = "\nWHERE " + strings.Join(filterSQL, " AND ")
+				found, err := findRecentComplianceEvent(ctx, db, &reqEvent.Event, s.options.DedupWindow)
+				if err != nil {
+					return err
+				}
+
+				deduplicated = found
+				if !found {
+					// Skip the insert if the client disconnected while the foreign keys were being resolved since
+					// the response can't be sent.
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+
+					if err := reqEvent.Create(ctx, db); err != nil {
+						return err
+					}
+				}
+
+				if dryRun {
+					return errDryRunRollback
+				}
+
+				return nil
+			})
+		})
+	})
+	if dryRun && errors.Is(err, errDryRunRollback) {
+		err = nil
 	}
 
-	return whereClause, filterValues
+	return deduplicated, err
 }
 
-// getComplianceEvents handles the list API endpoint for compliance events.
-func getComplianceEvents(db *sql.DB, w http.ResponseWriter,
-	r *http.Request, userConfig *rest.Config,
+// postComplianceEvents handles a request body of a JSON array of compliance events. Every compliance event is validated
+// and authorized before anything is inserted, and the compliance events are inserted in a single transaction so that a
+// partial insert never happens. It assumes you have a read lock already attained.
+func (s *ComplianceAPIServer) postComplianceEvents(
+	serverContext *ComplianceServerCtx, w http.ResponseWriter, r *http.Request, body []byte, dryRun bool,
 ) {
-	queryArgs, err := parseQueryArgs(r.Context(), r.URL.Query(), db, userConfig, false)
-	if err != nil {
-		if errors.Is(err, ErrForbidden) {
-			writeErrMsgJSON(w, err.Error(), http.StatusForbidden)
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	reqEvents := []*ComplianceEvent{}
+
+	if !decodeRequestBody(w, body, &reqEvents, s.options.StrictJSON) {
+		return
+	}
+
+	if len(reqEvents) == 0 {
+		writeErrMsgJSON(w, "At least one compliance event must be provided", http.StatusBadRequest)
+
+		return
+	}
+
+	for i, reqEvent := range reqEvents {
+		if reqEvent == nil {
+			writeErrMsgJSON(w, fmt.Sprintf("The compliance event at index %d is null", i), http.StatusBadRequest)
 
 			return
 		}
 
-		if errors.Is(err, ErrNoAccess) {
-			response := ListResponse{
-				Data: []ComplianceEvent{},
-				Metadata: metadata{
-					Page:    queryArgs.Page,
-					Pages:   0,
-					PerPage: queryArgs.PerPage,
-					Total:   0,
-				},
-			}
-
-			jsonResp, err := json.Marshal(response)
-			if err != nil {
-				log.Error(err, "Failed to marshal an empty response")
-				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+		if err := reqEvent.Validate(r.Context(), serverContext, s.options.MaxPolicySpecBytes); err != nil {
+			fieldErrs := getFieldErrors(err)
 
-				return
+			for j := range fieldErrs {
+				fieldErrs[j].Field = fmt.Sprintf("[%d].%s", i, fieldErrs[j].Field)
 			}
 
-			if _, err = w.Write(jsonResp); err != nil {
-				log.Error(err, "Error writing empty response")
-				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
-			}
+			writeValidationErrJSON(
+				w, fmt.Sprintf("The compliance event at index %d is invalid: %s", i, err.Error()), fieldErrs,
+			)
 
 			return
 		}
+	}
 
-		if errors.Is(err, ErrInvalidQueryArg) || errors.Is(err, ErrInvalidQueryArgValue) ||
-			errors.Is(err, ErrInvalidSortOption) {
-			writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+	// The authorization only needs to be checked once per cluster
+	authorizedClusters := map[string]bool{}
 
-			return
+	for _, reqEvent := range reqEvents {
+		if authorizedClusters[reqEvent.Cluster.Name] {
+			continue
 		}
 
-		writeErrMsgJSON(w, err.Error(), http.StatusInternalServerError)
+		allowed, err := canRecordComplianceEvent(s.cfg, reqEvent.Cluster.Name, r)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				writeErrMsgJSON(w, "Unauthorized", http.StatusUnauthorized)
 
-		return
-	}
+				return
+			}
 
-	// Note that the where clause could be an empty string if not filters were passed in the query arguments.
-	whereClause, filterValues := getWhereClause(queryArgs)
+			reqLog.Error(err, "error determining if the user is authorized for recording compliance events")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
-	query := getComplianceEventsQuery(whereClause, queryArgs)
+			return
+		}
 
-	rows, err := db.QueryContext(r.Context(), query, filterValues...)
-	if err == nil {
-		err = rows.Err()
-	}
+		if !allowed {
+			// Logging is handled by canRecordComplianceEvent
+			writeErrMsgJSON(w, "Forbidden", http.StatusForbidden)
 
-	if err != nil {
-		log.Error(err, "Failed to query for compliance events")
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
 
-		return
+		authorizedClusters[reqEvent.Cluster.Name] = true
 	}
 
-	defer rows.Close()
-
-	complianceEvents := make([]ComplianceEvent, 0, queryArgs.PerPage)
+	var reservation *idempotencyReservation
 
-	for rows.Next() {
-		ce, err := scanIntoComplianceEvent(rows, queryArgs.IncludeSpec)
-		if err != nil {
-			log.Error(err, "Failed to unmarshal the database results")
-			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+	// See postComplianceEvent for how the Idempotency-Key header is handled.
+	if !dryRun {
+		var ok bool
 
+		reservation, ok = reserveIdempotencyKey(w, r, body)
+		if !ok {
 			return
 		}
 
-		complianceEvents = append(complianceEvents, *ce)
+		defer reservation.release()
 	}
 
-	countQuery := `SELECT COUNT(*) FROM compliance_events
-LEFT JOIN clusters ON compliance_events.cluster_id = clusters.id
-LEFT JOIN parent_policies ON compliance_events.parent_policy_id = parent_policies.id
-LEFT JOIN policies ON compliance_events.policy_id = policies.id` + whereClause // #nosec G202
+	var failedIndex int
 
-	row := db.QueryRowContext(r.Context(), countQuery, filterValues...)
+	// createdEvents are the compliance events that were inserted rather than deduplicated.
+	var createdEvents []*ComplianceEvent
 
-	var total uint64
+	// See postComplianceEvent for why the whole transaction is retried.
+	err := retryStaleForeignKeys(r.Context(), serverContext, reqEvents, func() error {
+		return s.retryTransientDBErrors(r.Context(), func() error {
+			return inTransaction(r.Context(), serverContext.DB, func(tx *sql.Tx) error {
+				db := serverContext.preparedTx(tx)
+				createdEvents = nil
 
-	if err := row.Scan(&total); err != nil {
-		log.Error(err, "Failed to get the count of compliance events", getPqErrKeyVals(err)...)
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+				for i, reqEvent := range reqEvents {
+					failedIndex = i
 
-		return
-	}
+					if err := setForeignKeys(r.Context(), serverContext, db, reqEvent); err != nil {
+						return err
+					}
 
-	pages := math.Ceil(float64(total) / float64(queryArgs.PerPage))
+					found, err := findRecentComplianceEvent(r.Context(), db, &reqEvent.Event, s.options.DedupWindow)
+					if err != nil {
+						return err
+					}
 
-	response := ListResponse{
-		Data: complianceEvents,
-		Metadata: metadata{
-			Page:    queryArgs.Page,
-			Pages:   uint64(pages),
-			PerPage: queryArgs.PerPage,
-			Total:   total,
-		},
-	}
+					if found {
+						continue
+					}
 
-	jsonResp, err := json.Marshal(response)
-	if err != nil {
-		log.Error(err, "Failed to marshal the response")
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+					// See postComplianceEvent for why the client is checked before inserting.
+					if err := r.Context().Err(); err != nil {
+						return err
+					}
 
-		return
-	}
+					if err := reqEvent.Create(r.Context(), db); err != nil {
+						return err
+					}
 
-	if _, err = w.Write(jsonResp); err != nil {
-		log.Error(err, "Error writing success response")
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+					createdEvents = append(createdEvents, reqEvent)
+				}
 
-		return
+				if dryRun {
+					return errDryRunRollback
+				}
+
+				return nil
+			})
+		})
+	})
+	if dryRun && errors.Is(err, errDryRunRollback) {
+		err = nil
 	}
-}
 
-// postComplianceEvent assumes you have a read lock already attained.
-func postComplianceEvent(serverContext *ComplianceServerCtx, cfg *rest.Config, w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Error(err, "error reading request body")
-		writeErrMsgJSON(w, "Could not read request body", http.StatusBadRequest)
+		if clientDisconnected(r) {
+			reqLog.V(2).Info("The client disconnected before the compliance events were recorded")
 
-		return
-	}
+			return
+		}
 
-	reqEvent := &ComplianceEvent{}
+		code, reason := getDBErrStatus(err)
 
-	if err := json.Unmarshal(body, reqEvent); err != nil {
-		writeErrMsgJSON(w, "Incorrectly formatted request body, must be valid JSON", http.StatusBadRequest)
+		// A duplicate is expected, but other errors are logged and a foreign key violation clears the caches.
+		if code != http.StatusConflict {
+			handleInsertErr(r.Context(), serverContext, err)
+		}
+
+		if code == http.StatusInternalServerError {
+			writeErrMsgJSON(w, "Internal Error", code)
+		} else {
+			writeErrMsgJSON(w, fmt.Sprintf("The compliance event at index %d %s", failedIndex, reason), code)
+		}
 
 		return
 	}
 
-	if err := reqEvent.Validate(r.Context(), serverContext); err != nil {
-		writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+	if !dryRun {
+		eventsCreatedMetric.Add(float64(len(createdEvents)))
+		s.auditLog.recordCreated(w, r, createdEvents...)
+		s.eventStream.publish(createdEvents...)
+		s.webhook.notify(createdEvents...)
+	}
 
-		return
+	for _, reqEvent := range reqEvents {
+		// The database IDs from a dry run were rolled back, so they must not be cached.
+		if !dryRun {
+			cacheForeignKeys(serverContext, reqEvent)
+		}
+
+		reqEvent.EventID = reqEvent.Event.KeyID
+
+		// remove the spec so it's not returned in the JSON.
+		reqEvent.Policy.Spec = nil
 	}
 
-	allowed, err := canRecordComplianceEvent(cfg, reqEvent.Cluster.Name, r)
-	if err != nil {
-		if errors.Is(err, ErrUnauthorized) {
-			writeErrMsgJSON(w, "Unauthorized", http.StatusUnauthorized)
+	minimal := prefersMinimalReturn(r)
+
+	var resp []byte
+
+	if !minimal {
+		resp, err = json.Marshal(reqEvents)
+		if err != nil {
+			reqLog.Error(err, "error marshaling reqEvents for the response")
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
 			return
 		}
+	}
 
-		log.Error(err, "error determining if the user is authorized for recording compliance events")
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+	code := http.StatusCreated
 
-		return
+	if dryRun {
+		setDryRunHeaders(w, r)
+
+		code = http.StatusOK
+	} else {
+		ids := make([]int32, 0, len(reqEvents))
+
+		for _, reqEvent := range reqEvents {
+			ids = append(ids, reqEvent.EventID)
+		}
+
+		reservation.complete(len(reqEvents), ids)
 	}
 
-	if !allowed {
-		// Logging is handled by canRecordComplianceEvent
-		writeErrMsgJSON(w, "Forbidden", http.StatusForbidden)
+	if minimal {
+		writeMinimalReturn(w, code)
 
 		return
 	}
 
-	clusterFK, err := GetClusterForeignKey(r.Context(), serverContext.DB, reqEvent.Cluster)
+	w.WriteHeader(code)
+
+	if _, err = w.Write(resp); err != nil {
+		reqLog.Error(err, "error writing success response")
+	}
+}
+
+// setForeignKeys sets the cluster, parent policy, and policy foreign keys on the input compliance event's Event field.
+// Any missing rows are created with the input transaction and errors are logged. Call cacheForeignKeys after the
+// transaction is committed.
+func setForeignKeys(
+	ctx context.Context, serverContext *ComplianceServerCtx, db dbQuerier, reqEvent *ComplianceEvent,
+) error {
+	reqLog := ctrl.LoggerFrom(ctx)
+
+	clusterFK, err := getClusterForeignKey(ctx, db, reqEvent.Cluster)
 	if err != nil {
-		log.Error(err, "error getting cluster foreign key", getPqErrKeyVals(err)...)
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+		reqLog.Error(err, "error getting cluster foreign key", getPqErrKeyVals(err)...)
 
-		return
+		return err
 	}
 
 	reqEvent.Event.ClusterID = clusterFK
 
 	if reqEvent.ParentPolicy != nil {
-		pfk, err := getParentPolicyForeignKey(r.Context(), serverContext, *reqEvent.ParentPolicy)
+		pfk, err := getParentPolicyForeignKey(ctx, serverContext, db, *reqEvent.ParentPolicy)
 		if err != nil {
-			log.Error(err, "error getting parent policy foreign key", getPqErrKeyVals(err)...)
-			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+			reqLog.Error(err, "error getting parent policy foreign key", getPqErrKeyVals(err)...)
 
-			return
+			return err
 		}
 
 		reqEvent.Event.ParentPolicyID = &pfk
 	}
 
-	policyFK, err := getPolicyForeignKey(r.Context(), serverContext, reqEvent.Policy)
+	policyFK, err := getPolicyForeignKey(ctx, serverContext, db, reqEvent.Policy)
 	if err != nil {
-		log.Error(err, "error getting policy foreign key", getPqErrKeyVals(err)...)
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+		reqLog.Error(err, "error getting policy foreign key", getPqErrKeyVals(err)...)
 
-		return
+		return err
 	}
 
 	reqEvent.Event.PolicyID = policyFK
 
-	err = reqEvent.Create(r.Context(), serverContext.DB)
+	return nil
+}
+
+// findRecentComplianceEvent looks for a compliance event with the same cluster, policy, parent policy, compliance, and
+// message as the input event within window of its timestamp. Soft deleted compliance events are ignored since they
+// aren't returned by the API. If one is found, the input event's ID and timestamp are set to the existing compliance
+// event's and true is returned. A window of 0 disables this and always returns false.
+// The foreign keys on the input event must already be set.
+func findRecentComplianceEvent(
+	ctx context.Context, db dbQuerier, event *EventDetails, window time.Duration,
+) (bool, error) {
+	if window <= 0 {
+		return false, nil
+	}
+
+	row := db.QueryRowContext(
+		ctx,
+		`SELECT id, timestamp FROM compliance_events `+
+			`WHERE cluster_id=$1 AND policy_id=$2 AND parent_policy_id IS NOT DISTINCT FROM $3 AND compliance=$4 `+
+			`AND message=$5 AND timestamp BETWEEN $6 AND $7 AND deleted_at IS NULL `+
+			`ORDER BY timestamp DESC LIMIT 1`,
+		event.ClusterID,
+		event.PolicyID,
+		event.ParentPolicyID,
+		event.Compliance,
+		event.Message,
+		event.Timestamp.Add(-window),
+		event.Timestamp.Add(window),
+	)
+
+	var id int32
+	var timestamp time.Time
+
+	err := row.Scan(&id, &timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
 	if err != nil {
-		if errors.Is(err, errDuplicateComplianceEvent) {
-			writeErrMsgJSON(w, "The compliance event already exists", http.StatusConflict)
+		return false, err
+	}
 
-			return
-		}
+	event.KeyID = id
+	event.Timestamp = timestamp
 
-		var pqErr *pq.Error
+	return true, nil
+}
 
-		if errors.As(err, &pqErr) && pqErr.Code == postgresForeignKeyViolationCode {
-			// This can only happen if the cache is out of date due to data loss in the database because if the
-			// database ID is provided, it is validated against the database.
-			log.Info(
-				"Encountered a foreign key violation. Assuming the database lost data, so the cache is "+
-					"being cleared",
-				"message", pqErr.Message,
-				"detail", pqErr.Detail,
-			)
+// cacheForeignKeys stores the foreign keys set by setForeignKeys in the caches. This must only be called after the
+// transaction used by setForeignKeys is committed so that the caches never refer to rows that were rolled back.
+func cacheForeignKeys(serverContext *ComplianceServerCtx, reqEvent *ComplianceEvent) {
+	clusterKeyCache.Store(reqEvent.Cluster.ClusterID, reqEvent.Event.ClusterID)
 
-			// Temporarily upgrade the lock to a write lock
-			serverContext.Lock.RUnlock()
-			serverContext.Lock.Lock()
-			serverContext.ParentPolicyToID = sync.Map{}
-			serverContext.PolicyToID = sync.Map{}
-			clusterKeyCache = sync.Map{}
-			serverContext.Lock.Unlock()
-			serverContext.Lock.RLock()
-		} else {
-			log.Error(err, "error inserting compliance event", getPqErrKeyVals(err)...)
-		}
+	if reqEvent.ParentPolicy != nil && reqEvent.ParentPolicy.KeyID == 0 {
+		serverContext.ParentPolicyToID.Store(reqEvent.ParentPolicy.Key(), *reqEvent.Event.ParentPolicyID)
+	}
 
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+	if reqEvent.Policy.KeyID == 0 {
+		serverContext.PolicyToID.Store(reqEvent.Policy.Key(), reqEvent.Event.PolicyID)
+	}
+}
 
-		return
+// uncacheForeignKeys removes the cached database IDs that setForeignKeys may have used for the input compliance event.
+// IDs provided in the request are not cached, so they are left as is.
+func uncacheForeignKeys(serverContext *ComplianceServerCtx, reqEvent *ComplianceEvent) {
+	clusterKeyCache.Delete(reqEvent.Cluster.ClusterID)
+
+	if reqEvent.ParentPolicy != nil && reqEvent.ParentPolicy.KeyID == 0 {
+		serverContext.ParentPolicyToID.Delete(reqEvent.ParentPolicy.Key())
 	}
 
-	// remove the spec so it's not returned in the JSON.
-	reqEvent.Policy.Spec = nil
+	if reqEvent.Policy.KeyID == 0 {
+		serverContext.PolicyToID.Delete(reqEvent.Policy.Key())
+	}
+}
 
-	resp, err := json.Marshal(reqEvent)
-	if err != nil {
-		log.Error(err, "error marshaling reqEvent for the response")
-		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+// clientDisconnected returns true if the client of the request went away, which cancels the request's context. This is
+// distinct from the context's deadline being exceeded due to the database query timeout.
+func clientDisconnected(r *http.Request) bool {
+	return errors.Is(r.Context().Err(), context.Canceled)
+}
 
-		return
+// getDBErrStatus returns the HTTP status code for an error from writing a compliance event to the database and, if the
+// client is at fault, the reason to append to a message such as "The compliance event". Constraint violations are the
+// client's fault, but the reason doesn't include the database error details. Any other error returns a 500 status code
+// and an empty reason.
+func getDBErrStatus(err error) (int, string) {
+	if errors.Is(err, errDuplicateComplianceEvent) {
+		return http.StatusConflict, "already exists"
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	switch getSQLState(err) {
+	case postgresUniqueViolationCode:
+		return http.StatusConflict, "already exists"
+	case postgresForeignKeyViolationCode:
+		return http.StatusUnprocessableEntity, "refers to a cluster, parent policy, or policy that no longer exists"
+	case postgresCheckViolationCode:
+		return http.StatusBadRequest, "has a value that is not allowed"
+	}
 
-	if _, err = w.Write(resp); err != nil {
-		log.Error(err, "error writing success response")
+	return http.StatusInternalServerError, ""
+}
+
+// handleInsertErr logs an unexpected error from inserting a compliance event. If the error is a foreign key violation,
+// the foreign key caches are cleared. This temporarily upgrades the read lock, so the caller must hold a read lock.
+func handleInsertErr(ctx context.Context, serverContext *ComplianceServerCtx, err error) {
+	reqLog := ctrl.LoggerFrom(ctx)
+
+	if isForeignKeyViolation(err) {
+		// This can only happen if the cache is out of date due to data loss in the database because if the
+		// database ID is provided, it is validated against the database.
+		reqLog.Info(
+			"Encountered a foreign key violation. Assuming the database lost data, so the cache is "+
+				"being cleared",
+			getPqErrKeyVals(err)...,
+		)
+
+		// Temporarily upgrade the lock to a write lock
+		serverContext.Lock.RUnlock()
+		serverContext.Lock.Lock()
+		serverContext.ParentPolicyToID.Clear()
+		serverContext.PolicyToID.Clear()
+		clusterKeyCache.Clear()
+		serverContext.Lock.Unlock()
+		serverContext.Lock.RLock()
+	} else {
+		reqLog.Error(err, "error inserting compliance event", getPqErrKeyVals(err)...)
 	}
 }
 
 func getComplianceEventsQuery(whereClause string, queryArgs *queryOptions) string {
+	selectQuery := generateGetComplianceEventsQuery(queryArgs.IncludeSpec)
+	if queryArgs.Fields != nil {
+		selectQuery = generateComplianceEventsSelect(generateProjectedSelectArgs(queryArgs.Fields))
+	}
+
 	// Getting CSV without the page argument
 	// Query should fetch all rows (unlimited)
 	if queryArgs.PerPage == 0 {
 		return fmt.Sprintf(`%s%s
 		ORDER BY %s %s;`,
-			generateGetComplianceEventsQuery(queryArgs.IncludeSpec),
+			selectQuery,
 			whereClause,
 			strings.Join(queryArgs.Sort, ", "),
 			queryArgs.Direction,
 		)
 	}
+
+	// Cursor based pagination uses the ID as a tie breaker so that the order is stable across pages. One extra row is
+	// queried to determine if there is a next page.
+	if queryArgs.CursorPaging {
+		return fmt.Sprintf(`%s%s
+	ORDER BY compliance_events.timestamp %s, compliance_events.id %s
+	LIMIT %d;`,
+			selectQuery,
+			whereClause,
+			queryArgs.Direction,
+			queryArgs.Direction,
+			queryArgs.PerPage+1,
+		)
+	}
+
 	// Example query
 	//   SELECT compliance_events.id, compliance_events.compliance, ...
 	//     FROM compliance_events
@@ -1152,7 +3522,7 @@ func getComplianceEventsQuery(whereClause string, queryArgs *queryOptions) strin
 	ORDER BY %s %s
 	LIMIT %d
 	OFFSET %d ROWS;`,
-		generateGetComplianceEventsQuery(queryArgs.IncludeSpec),
+		selectQuery,
 		whereClause,
 		strings.Join(queryArgs.Sort, ", "),
 		queryArgs.Direction,
@@ -1169,12 +3539,96 @@ func setCSVResponseHeaders(w http.ResponseWriter) {
 	w.Header().Set("Transfer-Encoding", "chunked")
 }
 
+// getComplianceEventsNDJSON writes the compliance events as newline delimited JSON, one compliance event per line.
+// The compliance events are written as they are read from the database so the results aren't buffered in memory.
+func getComplianceEventsNDJSON(db *sql.DB, w http.ResponseWriter, r *http.Request, userConfig *rest.Config) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	queryArgs, err := parseQueryArgs(r.Context(), r.URL.Query(), db, userConfig, "ndjson")
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNoAccess):
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		case errors.Is(err, ErrForbidden):
+			writeErrMsgJSON(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrInvalidQueryArg) || errors.Is(err, ErrInvalidQueryArgValue) ||
+			errors.Is(err, ErrInvalidSortOption):
+			writeErrMsgJSON(w, err.Error(), http.StatusBadRequest)
+		default:
+			writeErrMsgJSON(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	// Note that the where clause could be an empty string if no filters were passed in the query arguments.
+	whereClause, filterValues := getWhereClause(queryArgs)
+
+	query := getComplianceEventsQuery(whereClause, queryArgs)
+
+	logQuery(r.Context(), query, filterValues)
+
+	rows, err := db.QueryContext(r.Context(), query, filterValues...)
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if err != nil {
+		reqLog.Error(err, "Failed to query for compliance events")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	encoder := json.NewEncoder(w)
+	responseController := http.NewResponseController(w)
+	written := 0
+
+	for rows.Next() {
+		ce, err := scanIntoComplianceEvent(rows, queryArgs.IncludeSpec)
+		if err != nil {
+			// The status code was already sent if anything was written, so the response is just cut short.
+			reqLog.Error(err, "Failed to unmarshal the database results")
+
+			if written == 0 {
+				writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		if err := encoder.Encode(ce); err != nil {
+			reqLog.Error(err, "Failed to write the compliance event")
+
+			return
+		}
+
+		written++
+
+		if written%ndjsonFlushInterval == 0 {
+			if err := responseController.Flush(); err != nil {
+				reqLog.V(2).Info("Failed to flush the response", "error", err.Error())
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		reqLog.Error(err, "Failed to read the compliance events from the database")
+	}
+}
+
 func getComplianceEventsCSV(db *sql.DB, w http.ResponseWriter, r *http.Request,
 	userConfig *rest.Config,
 ) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
 	var writer *csv.Writer
 
-	queryArgs, queryArgsErr := parseQueryArgs(r.Context(), r.URL.Query(), db, userConfig, true)
+	queryArgs, queryArgsErr := parseQueryArgs(r.Context(), r.URL.Query(), db, userConfig, "csv")
 	if queryArgs != nil {
 		headers := getCsvHeader(queryArgs.IncludeSpec)
 
@@ -1182,7 +3636,7 @@ func getComplianceEventsCSV(db *sql.DB, w http.ResponseWriter, r *http.Request,
 
 		err := writer.Write(headers)
 		if err != nil {
-			log.Error(err, "Failed to write csv header")
+			reqLog.Error(err, "Failed to write csv header")
 			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
 			return
@@ -1215,13 +3669,15 @@ func getComplianceEventsCSV(db *sql.DB, w http.ResponseWriter, r *http.Request,
 
 	query := getComplianceEventsQuery(whereClause, queryArgs)
 
+	logQuery(r.Context(), query, filterValues)
+
 	rows, err := db.QueryContext(r.Context(), query, filterValues...)
 	if err == nil {
 		err = rows.Err()
 	}
 
 	if err != nil {
-		log.Error(err, "Failed to query for compliance events")
+		reqLog.Error(err, "Failed to query for compliance events")
 		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
 		return
@@ -1232,7 +3688,7 @@ func getComplianceEventsCSV(db *sql.DB, w http.ResponseWriter, r *http.Request,
 	for rows.Next() {
 		ce, err := scanIntoComplianceEvent(rows, queryArgs.IncludeSpec)
 		if err != nil {
-			log.Error(err, "Failed to unmarshal the database results")
+			reqLog.Error(err, "Failed to unmarshal the database results")
 			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
 			return
@@ -1242,7 +3698,7 @@ func getComplianceEventsCSV(db *sql.DB, w http.ResponseWriter, r *http.Request,
 
 		err = writer.Write(stringValues)
 		if err != nil {
-			log.Error(err, "Failed to write csv list")
+			reqLog.Error(err, "Failed to write csv list")
 			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
 
 			return
@@ -1285,6 +3741,7 @@ func convertToCsvLine(ce *ComplianceEvent, includeSpec bool) []string {
 		convertToString(ce.Event.Compliance),
 		convertToString(ce.Event.Message),
 		convertToString(ce.Event.Metadata),
+		convertToString(ce.Event.Labels),
 		convertToString(*ce.Event.ReportedBy),
 		convertToString(ce.Event.Timestamp),
 		convertToString(ce.Cluster.ClusterID),
@@ -1334,6 +3791,17 @@ func convertToString(v interface{}) string {
 		return strings.Join(vv, ", ")
 	case bool:
 		return strconv.FormatBool(vv)
+	case Labels:
+		if len(vv) == 0 {
+			return ""
+		}
+
+		jsonByte, err := json.Marshal(vv)
+		if err != nil {
+			return ""
+		}
+
+		return string(jsonByte)
 	case JSONMap:
 		if vv == nil {
 			return ""
@@ -1353,89 +3821,190 @@ func convertToString(v interface{}) string {
 
 // GetClusterForeignKey will return the database ID based on the cluster.ClusterID.
 func GetClusterForeignKey(ctx context.Context, db *sql.DB, cluster Cluster) (int32, error) {
+	key, err := getClusterForeignKey(ctx, db, cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	clusterKeyCache.Store(cluster.ClusterID, key)
+
+	return key, nil
+}
+
+// getClusterForeignKey will return the database ID based on the cluster.ClusterID. The cache is not updated since the
+// input db may be a transaction that is not yet committed.
+func getClusterForeignKey(ctx context.Context, db dbQuerier, cluster Cluster) (int32, error) {
 	// Check cache
 	key, ok := clusterKeyCache.Load(cluster.ClusterID)
 	if ok {
+		cacheHitsMetric.WithLabelValues("cluster").Inc()
+
 		return key.(int32), nil
 	}
 
+	cacheMissesMetric.WithLabelValues("cluster").Inc()
+
 	err := cluster.GetOrCreate(ctx, db)
 	if err != nil {
 		return 0, err
 	}
 
-	clusterKeyCache.Store(cluster.ClusterID, cluster.KeyID)
-
 	return cluster.KeyID, nil
 }
 
+// getParentPolicyForeignKey will return the database ID of the parent policy. The cache is not updated since the input
+// db may be a transaction that is not yet committed.
 func getParentPolicyForeignKey(
-	ctx context.Context, complianceServerCtx *ComplianceServerCtx, parent ParentPolicy,
+	ctx context.Context, complianceServerCtx *ComplianceServerCtx, db dbQuerier, parent ParentPolicy,
 ) (int32, error) {
 	if parent.KeyID != 0 {
 		return parent.KeyID, nil
 	}
 
 	// Check cache
-	parKey := parent.Key()
-
-	key, ok := complianceServerCtx.ParentPolicyToID.Load(parKey)
+	key, ok := complianceServerCtx.ParentPolicyToID.Load(parent.Key())
 	if ok {
+		cacheHitsMetric.WithLabelValues("parent_policy").Inc()
+
 		return key.(int32), nil
 	}
 
-	err := parent.GetOrCreate(ctx, complianceServerCtx.DB)
+	cacheMissesMetric.WithLabelValues("parent_policy").Inc()
+
+	err := parent.GetOrCreate(ctx, db)
 	if err != nil {
 		return 0, err
 	}
 
-	complianceServerCtx.ParentPolicyToID.Store(parKey, parent.KeyID)
-
 	return parent.KeyID, nil
 }
 
-func getPolicyForeignKey(ctx context.Context, complianceServerCtx *ComplianceServerCtx, pol Policy) (int32, error) {
+// getPolicyForeignKey will return the database ID of the policy. The cache is not updated since the input db may be a
+// transaction that is not yet committed.
+func getPolicyForeignKey(
+	ctx context.Context, complianceServerCtx *ComplianceServerCtx, db dbQuerier, pol Policy,
+) (int32, error) {
 	if pol.KeyID != 0 {
 		return pol.KeyID, nil
 	}
 
 	// Check cache
-	polKey := pol.Key()
-
-	key, ok := complianceServerCtx.PolicyToID.Load(polKey)
+	key, ok := complianceServerCtx.PolicyToID.Load(pol.Key())
 	if ok {
+		cacheHitsMetric.WithLabelValues("policy").Inc()
+
 		return key.(int32), nil
 	}
 
-	err := pol.GetOrCreate(ctx, complianceServerCtx.DB)
+	cacheMissesMetric.WithLabelValues("policy").Inc()
+
+	err := pol.GetOrCreate(ctx, db)
 	if err != nil {
 		return 0, err
 	}
 
-	complianceServerCtx.PolicyToID.Store(polKey, pol.KeyID)
-
 	return pol.KeyID, nil
 }
 
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+// writeHealthStatusJSON writes a response like `{"status": <>}` with the given code.
+func writeHealthStatusJSON(w http.ResponseWriter, status string, code int) {
+	resp, err := json.Marshal(healthStatus{Status: status})
+	if err != nil {
+		log.Error(err, "error marshaling the health status", "status", status)
+	}
+
+	w.WriteHeader(code)
+
+	if _, err := w.Write(resp); err != nil {
+		log.Error(err, "error writing the health status")
+	}
+}
+
 type errorMessage struct {
-	Message string `json:"message"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+type validationErrorMessage struct {
+	Message   string       `json:"message"`
+	Errors    []FieldError `json:"errors"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// writeValidationErrJSON writes a 400 response like
+// `{"message": <>, "errors": [{"field": "cluster.name", "message": "is required"}], "request_id": <>}` so that clients
+// can see every invalid field at once. If the only problem is that a provided database ID doesn't exist, such as
+// policy.id, the status code is 422 instead. If there are no field errors, writeErrMsgJSON is used instead.
+func writeValidationErrJSON(w http.ResponseWriter, message string, fieldErrs []FieldError) {
+	if len(fieldErrs) == 0 {
+		writeErrMsgJSON(w, message, http.StatusBadRequest)
+
+		return
+	}
+
+	code := http.StatusUnprocessableEntity
+
+	for _, fieldErr := range fieldErrs {
+		if !errors.Is(fieldErr.err, errReferenceNotFound) {
+			code = http.StatusBadRequest
+
+			break
+		}
+	}
+
+	requestID := w.Header().Get(requestIDHeader)
+	msg := validationErrorMessage{Message: message, Errors: fieldErrs, RequestID: requestID}
+
+	resp, err := json.Marshal(msg)
+	if err != nil {
+		log.Error(err, "error marshaling validation error message", "message", message, "requestID", requestID)
+	}
+
+	w.WriteHeader(code)
+
+	if _, err := w.Write(resp); err != nil {
+		log.Error(err, "error writing validation error message", "requestID", requestID)
+	}
+}
+
+// writeDBUnavailable writes a 500 response and returns true if the database isn't set. This is only possible on a
+// POST request that the event queue let through. The caller must hold a read lock.
+func writeDBUnavailable(serverContext *ComplianceServerCtx, w http.ResponseWriter) bool {
+	if serverContext.DB != nil {
+		return false
+	}
+
+	writeErrMsgJSON(w, "The database is unavailable", http.StatusInternalServerError)
+
+	return true
+}
+
+// writeMethodNotAllowed writes a 405 response with the Allow header set to the methods supported by the route.
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeErrMsgJSON(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
-// writeErrMsgJSON wraps the given message in JSON like `{"message": <>}` and
+// writeErrMsgJSON wraps the given message in JSON like `{"message": <>, "request_id": <>}` and
 // writes the response, setting the header to the given code. Since this message
 // will be read by the user, take care not to leak any sensitive details that
 // might be in the error message.
 func writeErrMsgJSON(w http.ResponseWriter, message string, code int) {
-	msg := errorMessage{Message: message}
+	requestID := w.Header().Get(requestIDHeader)
+	msg := errorMessage{Message: message, RequestID: requestID}
 
 	resp, err := json.Marshal(msg)
 	if err != nil {
-		log.Error(err, "error marshaling error message", "message", message)
+		log.Error(err, "error marshaling error message", "message", message, "requestID", requestID)
 	}
 
 	w.WriteHeader(code)
 
 	if _, err := w.Write(resp); err != nil {
-		log.Error(err, "error writing error message")
+		log.Error(err, "error writing error message", "requestID", requestID)
 	}
 }
@@ -1,10 +1,25 @@
+// Copyright Contributors to the Open Cluster Management project
+
 package complianceeventsapi
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/lib/pq"
 	. "github.com/onsi/gomega"
 )
 
@@ -72,12 +87,13 @@ func TestConvertToCsvLine(t *testing.T) {
 	values := convertToCsvLine(&ce, true)
 
 	g := NewWithT(t)
-	g.Expect(values).Should(HaveLen(21))
+	g.Expect(values).Should(HaveLen(22))
 	// Should follow this order
 	// 	"compliance_events_id",
 	// "compliance_events_compliance",
 	// "compliance_events_message",
 	// "compliance_events_metadata",
+	// "compliance_events_labels",
 	// "compliance_events_reported_by",
 	// "compliance_events_timestamp",
 	// "clusters_cluster_id",
@@ -97,14 +113,14 @@ func TestConvertToCsvLine(t *testing.T) {
 	// "policies_spec",
 	g.Expect(values).Should(Equal([]string{
 		"1", "cp1", "event1 message",
-		"", "cat1", "2021-08-15 14:30:45.0000001 +0000 UTC",
+		"", "", "cat1", "2021-08-15 14:30:45.0000001 +0000 UTC",
 		"1111", "cluster1", "", "", "", "", "", "", "", "v1", "", "", "", "",
 		"{\n  \"name\": \"hi\",\n  \"namespace\": \"cat-1\"\n}",
 	}))
 
 	// Test includeSpec = false
 	values = convertToCsvLine(&ce, false)
-	g.Expect(values).Should(HaveLen(20), "Test Some fields set")
+	g.Expect(values).Should(HaveLen(21), "Test Some fields set")
 
 	parentPolicy := &ParentPolicy{
 		KeyID:      11,
@@ -150,7 +166,7 @@ func TestConvertToCsvLine(t *testing.T) {
 	g.Expect(values).Should(Equal([]string{
 		"1", "cp1", "event1 message",
 		"{\n  \"flower\": [\n    \"rose\",\n    \"sunflower\"\n  ],\n  \"number\": 1,\n  \"pet\": \"cat1\"\n}",
-		"cat1", "2021-08-15 14:30:45.0000001 +0000 UTC", "22", "cluster1",
+		"", "cat1", "2021-08-15 14:30:45.0000001 +0000 UTC", "22", "cluster1",
 		"11", "parent-my-name", "ns-pp", "cate-1, cate-2",
 		"control-1, control-2", "stand-1, stand-2", "",
 		"v1", "configuration", "policy-name", "", "",
@@ -162,11 +178,11 @@ func TestGetCsvHeader(t *testing.T) {
 	g := NewWithT(t)
 
 	result := getCsvHeader(true)
-	g.Expect(result).Should(HaveLen(21))
+	g.Expect(result).Should(HaveLen(22))
 	g.Expect(result).Should(Equal([]string{
 		"compliance_events_id",
 		"compliance_events_compliance",
-		"compliance_events_message", "compliance_events_metadata",
+		"compliance_events_message", "compliance_events_metadata", "compliance_events_labels",
 		"compliance_events_reported_by", "compliance_events_timestamp", "clusters_cluster_id",
 		"clusters_name", "parent_policies_id", "parent_policies_name",
 		"parent_policies_namespace", "parent_policies_categories", "parent_policies_controls",
@@ -175,5 +191,729 @@ func TestGetCsvHeader(t *testing.T) {
 	}))
 
 	result = getCsvHeader(false)
-	g.Expect(result).Should(HaveLen(20))
+	g.Expect(result).Should(HaveLen(21))
+}
+
+func TestIsDryRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		target    string
+		prefer    []string
+		expected  bool
+		expectErr bool
+	}{
+		{"no dry run", "/api/v1/compliance-events", nil, false, false},
+		{"dry_run=true", "/api/v1/compliance-events?dry_run=true", nil, true, false},
+		{"dry_run=false", "/api/v1/compliance-events?dry_run=false", nil, false, false},
+		{"invalid dry_run", "/api/v1/compliance-events?dry_run=maybe", nil, false, true},
+		{"Prefer dry-run", "/api/v1/compliance-events", []string{"dry-run"}, true, false},
+		{"Prefer list", "/api/v1/compliance-events", []string{"respond-async, Dry-Run"}, true, false},
+		{"Prefer with a value", "/api/v1/compliance-events", []string{"wait=10; dry-run"}, false, false},
+		{"Prefer other", "/api/v1/compliance-events", []string{"return=minimal"}, false, false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			req := httptest.NewRequest("POST", test.target, nil)
+			for _, prefer := range test.prefer {
+				req.Header.Add("Prefer", prefer)
+			}
+
+			dryRun, err := isDryRun(req)
+			if test.expectErr {
+				g.Expect(err).To(MatchError(ErrInvalidQueryArgValue))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			g.Expect(dryRun).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestPrefersMinimalReturn(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		prefer   []string
+		expected bool
+	}{
+		{"no Prefer header", nil, false},
+		{"return=minimal", []string{"return=minimal"}, true},
+		{"quoted and mixed case", []string{`Return="Minimal"`}, true},
+		{"list", []string{"dry-run, return=minimal"}, true},
+		{"separate headers", []string{"dry-run", "return=minimal"}, true},
+		{"return=representation", []string{"return=representation"}, false},
+		{"parameter", []string{"dry-run; return=minimal"}, false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			req := httptest.NewRequest("POST", "/api/v1/compliance-events", nil)
+			for _, prefer := range test.prefer {
+				req.Header.Add("Prefer", prefer)
+			}
+
+			g.Expect(prefersMinimalReturn(req)).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	t.Parallel()
+
+	etag := getETag([]byte(`{"id":1}`))
+
+	tests := []struct {
+		name        string
+		ifNoneMatch []string
+		expected    bool
+	}{
+		{"no header", nil, false},
+		{"same", []string{etag}, true},
+		{"strong form", []string{strings.TrimPrefix(etag, "W/")}, true},
+		{"in a list", []string{`"other", ` + etag}, true},
+		{"in a separate header", []string{`"other"`, etag}, true},
+		{"wildcard", []string{"*"}, true},
+		{"different", []string{getETag([]byte(`{"id":2}`))}, false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+			g.Expect(etagMatches(test.ifNoneMatch, etag)).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestClientDisconnected(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	req := httptest.NewRequest("POST", "/api/v1/compliance-events", nil)
+	g.Expect(clientDisconnected(req)).To(BeFalse())
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g.Expect(clientDisconnected(req.WithContext(canceledCtx))).To(BeTrue())
+
+	timedOutCtx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	g.Expect(clientDisconnected(req.WithContext(timedOutCtx))).To(BeFalse())
+}
+
+func TestGetDBErrStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"duplicate compliance event", fmt.Errorf("wrapped: %w", errDuplicateComplianceEvent), http.StatusConflict},
+		{"unique violation", &pq.Error{Code: postgresUniqueViolationCode}, http.StatusConflict},
+		{"foreign key violation", &pq.Error{Code: postgresForeignKeyViolationCode}, http.StatusUnprocessableEntity},
+		{"check violation", &pq.Error{Code: postgresCheckViolationCode}, http.StatusBadRequest},
+		{"other database error", &pq.Error{Code: "42P01"}, http.StatusInternalServerError},
+		{"connection error", sql.ErrConnDone, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			code, reason := getDBErrStatus(test.err)
+			g.Expect(code).To(Equal(test.expected))
+
+			if test.expected == http.StatusInternalServerError {
+				g.Expect(reason).To(BeEmpty())
+			} else {
+				g.Expect(reason).ToNot(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestReadRequestBodyChunked(t *testing.T) {
+	t.Parallel()
+
+	const maxBytes = 10
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ensure the limit is tested without a Content-Length to rely on.
+		if r.ContentLength != -1 || !slices.Contains(r.TransferEncoding, "chunked") {
+			w.WriteHeader(http.StatusExpectationFailed)
+
+			return
+		}
+
+		if _, ok := readRequestBody(w, r, maxBytes); ok {
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	// The parallel subtests run after this function returns, so the server is closed once they finish.
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name     string
+		size     int
+		expected int
+	}{
+		{"under the limit", maxBytes - 1, http.StatusOK},
+		{"at the limit", maxBytes, http.StatusOK},
+		{"over the limit", maxBytes + 1, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			// Hiding the type of the reader means the request has no Content-Length and is sent in chunks.
+			body := io.MultiReader(strings.NewReader(strings.Repeat("a", test.size)))
+
+			req, err := http.NewRequest(http.MethodPost, server.URL, body)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			req.TransferEncoding = []string{"chunked"}
+
+			resp, err := server.Client().Do(req)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			defer resp.Body.Close()
+
+			g.Expect(resp.StatusCode).To(Equal(test.expected))
+		})
+	}
+}
+
+func TestDecodeRequestBody(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		body        string
+		strict      bool
+		expectedOK  bool
+		expectedMsg string
+	}{
+		{"known fields", `{"event": {"compliance": "Compliant"}}`, true, true, ""},
+		{"unknown field ignored", `{"event": {"complianace": "Compliant"}}`, false, true, ""},
+		{
+			"unknown field rejected",
+			`{"event": {"complianace": "Compliant"}}`,
+			true,
+			false,
+			`The request body has an unknown field: \"complianace\"`,
+		},
+		{"invalid JSON", `{"event": `, true, false, "Incorrectly formatted request body, must be valid JSON"},
+		{
+			"trailing data",
+			`{"event": {"compliance": "Compliant"}} {}`,
+			false,
+			false,
+			"Incorrectly formatted request body, must be valid JSON",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			w := httptest.NewRecorder()
+			reqEvent := &ComplianceEvent{}
+
+			ok := decodeRequestBody(w, []byte(test.body), reqEvent, test.strict)
+			g.Expect(ok).To(Equal(test.expectedOK))
+
+			if !test.expectedOK {
+				g.Expect(w.Code).To(Equal(http.StatusBadRequest))
+				g.Expect(w.Body.String()).To(ContainSubstring(test.expectedMsg))
+			}
+		})
+	}
+}
+
+func TestGetWhereClauseLatestOnly(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	options := &queryOptions{
+		Filters:     map[string][]string{"policies.name": {"policy1"}},
+		NullFilters: []string{"compliance_events.deleted_at"},
+		LatestOnly:  true,
+	}
+
+	whereClause, filterValues := getWhereClause(options)
+
+	g.Expect(filterValues).To(Equal([]any{"policy1"}))
+	g.Expect(whereClause).To(HavePrefix("\nWHERE compliance_events.id IN (\n"))
+	g.Expect(whereClause).To(ContainSubstring(
+		"SELECT DISTINCT ON (compliance_events.cluster_id, compliance_events.policy_id) compliance_events.id",
+	))
+	// The filters are applied before choosing the latest compliance event.
+	g.Expect(whereClause).To(ContainSubstring(
+		"\nWHERE (policies.name=$1) AND compliance_events.deleted_at IS NULL\n  ORDER BY compliance_events.cluster_id",
+	))
+	g.Expect(whereClause).To(HaveSuffix("compliance_events.id DESC\n)"))
+
+	// The cursor filter is applied to the outer query.
+	cursorClause, _ := addCursorFilter(whereClause, filterValues, &eventCursor{ID: 3}, "desc")
+	g.Expect(cursorClause).To(HaveSuffix("DESC\n) AND (compliance_events.timestamp, compliance_events.id) < ($2, $3)"))
+}
+
+func TestNewComplianceAPIServerTimeouts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		options  ComplianceAPIServerOptions
+		expected ComplianceAPIServerOptions
+	}{
+		{
+			"defaults",
+			ComplianceAPIServerOptions{},
+			ComplianceAPIServerOptions{
+				ReadTimeout:       DefaultReadTimeout,
+				ReadHeaderTimeout: DefaultReadHeaderTimeout,
+				WriteTimeout:      DefaultWriteTimeout,
+				IdleTimeout:       DefaultIdleTimeout,
+			},
+		},
+		{
+			"custom",
+			ComplianceAPIServerOptions{
+				ReadTimeout:       time.Minute,
+				ReadHeaderTimeout: 2 * time.Second,
+				WriteTimeout:      5 * time.Minute,
+				IdleTimeout:       time.Hour,
+			},
+			ComplianceAPIServerOptions{
+				ReadTimeout:       time.Minute,
+				ReadHeaderTimeout: 2 * time.Second,
+				WriteTimeout:      5 * time.Minute,
+				IdleTimeout:       time.Hour,
+			},
+		},
+		{
+			"negative",
+			ComplianceAPIServerOptions{
+				ReadTimeout:       -time.Second,
+				ReadHeaderTimeout: -time.Second,
+				WriteTimeout:      -time.Second,
+				IdleTimeout:       -time.Second,
+			},
+			ComplianceAPIServerOptions{
+				ReadTimeout:       DefaultReadTimeout,
+				ReadHeaderTimeout: DefaultReadHeaderTimeout,
+				WriteTimeout:      DefaultWriteTimeout,
+				IdleTimeout:       DefaultIdleTimeout,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			options := NewComplianceAPIServer("", nil, nil, test.options).options
+			g.Expect(options.ReadTimeout).To(Equal(test.expected.ReadTimeout))
+			g.Expect(options.ReadHeaderTimeout).To(Equal(test.expected.ReadHeaderTimeout))
+			g.Expect(options.WriteTimeout).To(Equal(test.expected.WriteTimeout))
+			g.Expect(options.IdleTimeout).To(Equal(test.expected.IdleTimeout))
+		})
+	}
+}
+
+func TestRemoveSocketFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		create      func(t *testing.T, path string)
+		expectedErr bool
+		expectExist bool
+	}{
+		{"missing", func(*testing.T, string) {}, false, false},
+		{
+			"stale socket",
+			func(t *testing.T, path string) {
+				t.Helper()
+
+				listener, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// The socket file is kept when the listener is closed, like after an unclean shutdown.
+				listener.(*net.UnixListener).SetUnlinkOnClose(false)
+				listener.Close()
+			},
+			false,
+			false,
+		},
+		{
+			"regular file",
+			func(t *testing.T, path string) {
+				t.Helper()
+
+				if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			true,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			// The directory name is kept short since Unix socket paths are limited to about 100 characters.
+			dir, err := os.MkdirTemp("", "sock")
+			g.Expect(err).ToNot(HaveOccurred())
+
+			t.Cleanup(func() { os.RemoveAll(dir) })
+
+			path := filepath.Join(dir, "api.sock")
+			test.create(t, path)
+
+			err = removeSocketFile(path)
+			if test.expectedErr {
+				g.Expect(err).To(MatchError(ContainSubstring("is not a socket")))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			_, err = os.Lstat(path)
+			g.Expect(err == nil).To(Equal(test.expectExist))
+		})
+	}
+}
+
+func TestStartUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	dir, err := os.MkdirTemp("", "sock")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "api.sock")
+
+	// A stale socket file from a previous process is replaced.
+	staleListener, err := net.Listen("unix", path)
+	g.Expect(err).ToNot(HaveOccurred())
+	staleListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	staleListener.Close()
+
+	server := NewComplianceAPIServer(path, nil, nil, ComplianceAPIServerOptions{ListenNetwork: "unix"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	startErr := make(chan error, 1)
+
+	go func() {
+		startErr <- server.Start(ctx, &ComplianceServerCtx{})
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	g.Eventually(func(g Gomega) {
+		resp, err := client.Get("http://compliance-api/livez")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		defer resp.Body.Close()
+
+		g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	}, "5s", "10ms").Should(Succeed())
+
+	cancel()
+
+	g.Eventually(startErr, "10s").Should(Receive(BeNil()))
+
+	// The socket file is removed on shutdown.
+	_, err = os.Lstat(path)
+	g.Expect(err).To(MatchError(os.ErrNotExist))
+}
+
+func TestShutdownDrain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		finishFirst  bool
+		expectedCode int
+	}{
+		{"drained", 5 * time.Second, true, http.StatusOK},
+		{"timed out", 50 * time.Millisecond, false, 0},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			started := make(chan struct{})
+			finish := make(chan struct{})
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			g.Expect(err).ToNot(HaveOccurred())
+
+			server := NewComplianceAPIServer(
+				listener.Addr().String(), nil, nil, ComplianceAPIServerOptions{ShutdownTimeout: test.timeout},
+			)
+			server.server = &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+
+					select {
+					case <-finish:
+					case <-r.Context().Done():
+						return
+					}
+
+					w.WriteHeader(http.StatusOK)
+				}),
+				ReadHeaderTimeout: time.Second,
+			}
+
+			go func() {
+				_ = server.server.Serve(listener)
+			}()
+
+			respCode := make(chan int, 1)
+
+			go func() {
+				resp, err := http.Get("http://" + listener.Addr().String())
+				if err != nil {
+					respCode <- 0
+
+					return
+				}
+
+				resp.Body.Close()
+				respCode <- resp.StatusCode
+			}()
+
+			g.Eventually(started, "5s").Should(BeClosed())
+
+			shutdownDone := make(chan struct{})
+
+			go func() {
+				defer close(shutdownDone)
+
+				server.shutdown()
+			}()
+
+			// New connections are refused while the in-flight request is drained.
+			g.Eventually(func() error {
+				conn, err := net.Dial("tcp", listener.Addr().String())
+				if err == nil {
+					conn.Close()
+				}
+
+				return err
+			}, "5s", "10ms").Should(HaveOccurred())
+
+			if test.finishFirst {
+				close(finish)
+			}
+
+			g.Eventually(shutdownDone, "5s").Should(BeClosed())
+			g.Eventually(respCode, "5s").Should(Receive(Equal(test.expectedCode)))
+
+			if !test.finishFirst {
+				close(finish)
+			}
+		})
+	}
+}
+
+// dedupRow is a compliance event in the compliance_events table of dedupDriver.
+type dedupRow struct {
+	id        int64
+	timestamp time.Time
+	deleted   bool
+}
+
+// dedupDriver is a database/sql driver with a compliance_events table whose rows all match the filters of the
+// deduplication query other than deleted_at, which is applied if the query has it. It returns the most recent row.
+type dedupDriver struct {
+	rows    []dedupRow
+	queries int
+}
+
+func (d *dedupDriver) Open(string) (driver.Conn, error) {
+	return &dedupConn{driver: d}, nil
+}
+
+type dedupConn struct {
+	driver *dedupDriver
+}
+
+func (c *dedupConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if !strings.HasPrefix(query, "SELECT id, timestamp FROM compliance_events") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+
+	c.driver.queries++
+
+	excludeDeleted := strings.Contains(query, "deleted_at IS NULL")
+
+	var latest *dedupRow
+
+	for i, row := range c.driver.rows {
+		if excludeDeleted && row.deleted {
+			continue
+		}
+
+		if latest == nil || row.timestamp.After(latest.timestamp) {
+			latest = &c.driver.rows[i]
+		}
+	}
+
+	rows := &warmupRows{columns: []string{"id", "timestamp"}, done: latest == nil}
+	if latest != nil {
+		rows.values = []driver.Value{latest.id, latest.timestamp}
+	}
+
+	return rows, nil
+}
+
+func (c *dedupConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *dedupConn) Close() error {
+	return nil
+}
+
+func (c *dedupConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type dedupConnector struct {
+	driver *dedupDriver
+}
+
+func (c dedupConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c dedupConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func TestFindRecentComplianceEvent(t *testing.T) {
+	t.Parallel()
+
+	timestamp := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		window          time.Duration
+		rows            []dedupRow
+		expectedFound   bool
+		expectedID      int32
+		expectedQueries int
+	}{
+		{"disabled", 0, []dedupRow{{id: 1, timestamp: timestamp}}, false, 0, 0},
+		{"no match", time.Minute, nil, false, 0, 1},
+		{"match", time.Minute, []dedupRow{{id: 1, timestamp: timestamp.Add(-time.Second)}}, true, 1, 1},
+		{
+			"soft deleted match",
+			time.Minute,
+			[]dedupRow{{id: 1, timestamp: timestamp.Add(-time.Second), deleted: true}},
+			false,
+			0,
+			1,
+		},
+		{
+			"newer soft deleted match",
+			time.Minute,
+			[]dedupRow{
+				{id: 1, timestamp: timestamp.Add(-2 * time.Second)},
+				{id: 2, timestamp: timestamp.Add(-time.Second), deleted: true},
+			},
+			true,
+			1,
+			1,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			dedupDrv := &dedupDriver{rows: test.rows}
+			db := sql.OpenDB(dedupConnector{driver: dedupDrv})
+
+			t.Cleanup(func() { db.Close() })
+
+			event := &EventDetails{ClusterID: 1, PolicyID: 2, Compliance: "Compliant", Timestamp: timestamp}
+
+			found, err := findRecentComplianceEvent(context.Background(), db, event, test.window)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(found).To(Equal(test.expectedFound))
+			g.Expect(event.KeyID).To(Equal(test.expectedID))
+			g.Expect(dedupDrv.queries).To(Equal(test.expectedQueries))
+		})
+	}
 }
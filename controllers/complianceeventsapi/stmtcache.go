@@ -0,0 +1,153 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+const (
+	// maxCachedStmts is the most prepared statements that a stmtCache holds. The cached queries only vary by which of
+	// the optional columns are NULL, so this is only reached if an unexpected query is cached. Other queries aren't
+	// prepared.
+	maxCachedStmts = 100
+	// stmtPrepareTimeout is how long preparing a statement in the background can wait for a database connection.
+	stmtPrepareTimeout = 30 * time.Second
+)
+
+// stmtCache holds the prepared statements of the queries that recording a compliance event runs on every request, so
+// that Postgres doesn't parse and plan them each time. A statement is prepared on the connection pool, and
+// database/sql prepares it again on each new connection of the pool, so the statements still work after a connection
+// is reset. The cache must be closed when the connection pool is replaced.
+type stmtCache struct {
+	db     *sql.DB
+	lock   sync.RWMutex
+	closed bool
+	stmts  map[string]*sql.Stmt
+	// preparing are the queries being prepared in the background.
+	preparing map[string]bool
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: map[string]*sql.Stmt{}, preparing: map[string]bool{}}
+}
+
+// get returns the prepared statement of the query, or nil if it's not prepared yet. A query that isn't cached is
+// prepared in the background rather than before it's run since preparing it on the connection pool needs another
+// connection, which would never be available if every connection is held by a transaction waiting for one.
+func (c *stmtCache) get(query string) *sql.Stmt {
+	c.lock.RLock()
+	stmt, ok := c.stmts[query]
+	c.lock.RUnlock()
+
+	if ok {
+		return stmt
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt
+	}
+
+	if c.closed || c.preparing[query] || len(c.stmts)+len(c.preparing) >= maxCachedStmts {
+		return nil
+	}
+
+	c.preparing[query] = true
+
+	go c.prepare(query)
+
+	return nil
+}
+
+// prepare prepares the query on the connection pool and caches it. If it fails, it's tried again the next time the
+// query is run.
+func (c *stmtCache) prepare(query string) {
+	ctx, cancel := context.WithTimeout(context.Background(), stmtPrepareTimeout)
+	defer cancel()
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.preparing, query)
+
+	if err != nil {
+		log.V(2).Info("Failed to prepare a statement", "query", query, "error", err.Error())
+
+		return
+	}
+
+	if c.closed {
+		_ = stmt.Close()
+
+		return
+	}
+
+	c.stmts[query] = stmt
+}
+
+// close closes the prepared statements. Transactions still using them can finish since the statements are only closed
+// on a connection once it's no longer in use.
+func (c *stmtCache) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closed = true
+
+	for query, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil {
+			log.Error(err, "Failed to close a prepared statement", "query", query)
+		}
+	}
+
+	c.stmts = map[string]*sql.Stmt{}
+}
+
+// stmtTx is a dbQuerier that runs the queries of a transaction with the prepared statements of a stmtCache. A query
+// that isn't prepared yet runs without a prepared statement.
+type stmtTx struct {
+	tx    *sql.Tx
+	cache *stmtCache
+}
+
+// stmt returns the cached prepared statement of the query bound to the transaction, or nil if it isn't cached. The
+// statement is prepared on the connection of the transaction if it wasn't yet.
+func (t stmtTx) stmt(ctx context.Context, query string) *sql.Stmt {
+	stmt := t.cache.get(query)
+	if stmt == nil {
+		return nil
+	}
+
+	return t.tx.StmtContext(ctx, stmt)
+}
+
+func (t stmtTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := t.stmt(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+
+	return t.tx.ExecContext(ctx, query, args...)
+}
+
+func (t stmtTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt := t.stmt(ctx, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+
+	return t.tx.QueryContext(ctx, query, args...)
+}
+
+func (t stmtTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := t.stmt(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+
+	return t.tx.QueryRowContext(ctx, query, args...)
+}
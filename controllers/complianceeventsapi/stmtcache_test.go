@@ -0,0 +1,238 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// countingDriver is a database/sql driver that counts the prepared statements and how many times they're run. Every
+// query returns a single row with an id column of 1.
+type countingDriver struct {
+	lock     sync.Mutex
+	prepared int
+	executed int
+}
+
+func (d *countingDriver) Open(string) (driver.Conn, error) {
+	return &countingConn{driver: d}, nil
+}
+
+func (d *countingDriver) counts() (int, int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.prepared, d.executed
+}
+
+func (d *countingDriver) executeStmt() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.executed++
+}
+
+type countingConn struct {
+	driver *countingDriver
+}
+
+func (c *countingConn) Prepare(string) (driver.Stmt, error) {
+	c.driver.lock.Lock()
+	defer c.driver.lock.Unlock()
+
+	c.driver.prepared++
+
+	return countingStmt{driver: c.driver}, nil
+}
+
+// QueryContext runs the query without a prepared statement, like lib/pq does.
+func (c *countingConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &countingRows{}, nil
+}
+
+// ExecContext runs the query without a prepared statement, like lib/pq does.
+func (c *countingConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (c *countingConn) Close() error {
+	return nil
+}
+
+func (c *countingConn) Begin() (driver.Tx, error) {
+	return countingTx{}, nil
+}
+
+type countingTx struct{}
+
+func (countingTx) Commit() error {
+	return nil
+}
+
+func (countingTx) Rollback() error {
+	return nil
+}
+
+type countingStmt struct {
+	driver *countingDriver
+}
+
+func (countingStmt) Close() error {
+	return nil
+}
+
+func (countingStmt) NumInput() int {
+	return -1
+}
+
+func (s countingStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.driver.executeStmt()
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s countingStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.driver.executeStmt()
+
+	return &countingRows{}, nil
+}
+
+type countingRows struct {
+	done bool
+}
+
+func (*countingRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (*countingRows) Close() error {
+	return nil
+}
+
+func (r *countingRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+
+	r.done = true
+	dest[0] = int64(1)
+
+	return nil
+}
+
+// newCountingDB returns a connection pool with a single connection that uses a new countingDriver.
+func newCountingDB(t *testing.T) (*sql.DB, *countingDriver) {
+	t.Helper()
+
+	countingDrv := &countingDriver{}
+
+	db := sql.OpenDB(countingConnector{driver: countingDrv})
+	db.SetMaxOpenConns(1)
+
+	t.Cleanup(func() { db.Close() })
+
+	return db, countingDrv
+}
+
+type countingConnector struct {
+	driver *countingDriver
+}
+
+func (c countingConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c countingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func TestStmtCacheReusesStatements(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	db, countingDrv := newCountingDB(t)
+	cache := newStmtCache(db)
+
+	defer cache.close()
+
+	for i := 0; i < 3; i++ {
+		// The queries are prepared in the background after the first transaction releases the only connection.
+		if i == 1 {
+			g.Eventually(func() int {
+				cache.lock.RLock()
+				defer cache.lock.RUnlock()
+
+				return len(cache.stmts)
+			}, "5s", "10ms").Should(Equal(2))
+		}
+
+		err := inTransaction(ctx, db, func(tx *sql.Tx) error {
+			querier := stmtTx{tx: tx, cache: cache}
+
+			var id int32
+
+			row := querier.QueryRowContext(ctx, "SELECT id FROM clusters WHERE cluster_id=$1", "1")
+			if err := row.Scan(&id); err != nil {
+				return err
+			}
+
+			g.Expect(id).To(Equal(int32(1)))
+
+			_, err := querier.ExecContext(ctx, "DELETE FROM clusters WHERE cluster_id=$1", "2")
+
+			return err
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	// Each query is only prepared once on the connection, and the later transactions reuse the statements.
+	prepared, executed := countingDrv.counts()
+	g.Expect(prepared).To(Equal(2))
+	g.Expect(executed).To(Equal(4))
+}
+
+func TestPreparedTx(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	db, _ := newCountingDB(t)
+	serverContext := &ComplianceServerCtx{DB: db}
+
+	tx, err := db.BeginTx(ctx, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	defer func() { _ = tx.Rollback() }()
+
+	querier := serverContext.preparedTx(tx)
+	g.Expect(querier).To(BeAssignableToTypeOf(stmtTx{}))
+
+	cache := serverContext.stmtCache
+	g.Expect(cache.db).To(BeIdenticalTo(db))
+
+	// The cache is kept for the same connection pool.
+	serverContext.preparedTx(tx)
+	g.Expect(serverContext.stmtCache).To(BeIdenticalTo(cache))
+
+	// The cache is replaced with the connection pool.
+	otherDB, _ := newCountingDB(t)
+	serverContext.DB = otherDB
+
+	serverContext.preparedTx(tx)
+	g.Expect(serverContext.stmtCache).ToNot(BeIdenticalTo(cache))
+	g.Expect(serverContext.stmtCache.db).To(BeIdenticalTo(otherDB))
+
+	// Prepared statements can be disabled.
+	serverContext.preparedStmtsDisabled = true
+	g.Expect(serverContext.preparedTx(tx)).To(BeIdenticalTo(tx))
+}
@@ -0,0 +1,435 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// DefaultEventStreamBufferSize is the default number of compliance events buffered for each client of the
+	// compliance events stream.
+	DefaultEventStreamBufferSize = 100
+	// DefaultEventStreamMaxClients is the default maximum number of concurrent clients of the compliance events stream.
+	DefaultEventStreamMaxClients = 100
+	// DefaultEventStreamMaxDuration is the default duration after which a compliance events stream is closed so that
+	// the client reconnects and its access is checked again.
+	DefaultEventStreamMaxDuration = 30 * time.Minute
+	// eventStreamKeepaliveInterval is how often a comment is sent on an idle compliance events stream so that proxies
+	// don't close the connection.
+	eventStreamKeepaliveInterval = 15 * time.Second
+	// maxEventStreamReplay is the maximum number of compliance events replayed when a client reconnects with the
+	// Last-Event-ID header. Clients that missed more get a replayTruncatedEvent and should use the compliance events
+	// list API endpoint.
+	maxEventStreamReplay = 1000
+	// replayTruncatedEvent is the Server-Sent Event type sent before the stream is closed when more than
+	// maxEventStreamReplay compliance events were recorded after the Last-Event-ID header.
+	replayTruncatedEvent = "replay-truncated"
+)
+
+// errEventStreamFull is returned when the compliance events stream already has the maximum number of clients.
+var errEventStreamFull = errors.New("the compliance events stream has the maximum number of clients")
+
+// streamedEvent is a recorded compliance event marshaled once for every client of the compliance events stream.
+type streamedEvent struct {
+	id          int32
+	clusterName string
+	data        []byte
+}
+
+// newStreamedEvent marshals the compliance event with the input ID and without the policy spec, which is too large to
+// stream and is available from the policy spec API endpoint.
+func newStreamedEvent(id int32, event *ComplianceEvent) (*streamedEvent, error) {
+	streamed := *event
+	streamed.EventID = id
+	streamed.Policy.Spec = nil
+
+	data, err := json.Marshal(streamed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamedEvent{id: id, clusterName: event.Cluster.Name, data: data}, nil
+}
+
+// eventSubscriber is a client of the compliance events stream.
+type eventSubscriber struct {
+	events chan *streamedEvent
+	// done is closed when the subscriber is dropped for falling behind or the stream is closed.
+	done chan struct{}
+	// canAccess returns true if the client is authorized to see the compliance events of the managed cluster.
+	canAccess func(clusterName string) bool
+}
+
+// eventBroadcaster publishes the compliance events recorded by the API to the clients of the compliance events stream.
+// Each client has a bounded buffer and is dropped when it's full so that a slow client can't slow down recording
+// compliance events.
+type eventBroadcaster struct {
+	lock        sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+	bufferSize  int
+	// maxSubscribers is the maximum number of subscribers at once since the streams aren't counted by the concurrency
+	// limit of the server.
+	maxSubscribers int
+	closed         bool
+}
+
+func newEventBroadcaster(bufferSize int, maxSubscribers int) *eventBroadcaster {
+	return &eventBroadcaster{
+		subscribers: map[*eventSubscriber]struct{}{}, bufferSize: bufferSize, maxSubscribers: maxSubscribers,
+	}
+}
+
+// subscribe returns a subscriber that receives the published compliance events that canAccess returns true for. If the
+// broadcaster is closed, the subscriber is already done. errEventStreamFull is returned if there are already
+// maxSubscribers subscribers.
+func (b *eventBroadcaster) subscribe(canAccess func(clusterName string) bool) (*eventSubscriber, error) {
+	sub := &eventSubscriber{
+		events:    make(chan *streamedEvent, b.bufferSize),
+		done:      make(chan struct{}),
+		canAccess: canAccess,
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		close(sub.done)
+
+		return sub, nil
+	}
+
+	if len(b.subscribers) >= b.maxSubscribers {
+		return nil, errEventStreamFull
+	}
+
+	b.subscribers[sub] = struct{}{}
+	eventStreamClientsMetric.Inc()
+
+	return sub, nil
+}
+
+// unsubscribe stops sending compliance events to the subscriber. It's a no-op if the subscriber was already dropped.
+func (b *eventBroadcaster) unsubscribe(sub *eventSubscriber) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.done)
+		eventStreamClientsMetric.Dec()
+	}
+}
+
+// publish sends the recorded compliance events to the subscribers without blocking. A subscriber with a full buffer is
+// dropped. This is a no-op if b is nil or there are no subscribers.
+func (b *eventBroadcaster) publish(events ...*ComplianceEvent) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if len(b.subscribers) == 0 {
+		return
+	}
+
+	for _, event := range events {
+		streamed, err := newStreamedEvent(event.Event.KeyID, event)
+		if err != nil {
+			log.Error(err, "Failed to marshal the compliance event for the compliance events stream")
+
+			continue
+		}
+
+		for sub := range b.subscribers {
+			if !sub.canAccess(streamed.clusterName) {
+				continue
+			}
+
+			select {
+			case sub.events <- streamed:
+			default:
+				delete(b.subscribers, sub)
+				close(sub.done)
+				eventStreamClientsMetric.Dec()
+				eventStreamDroppedMetric.Inc()
+			}
+		}
+	}
+}
+
+// close drops every subscriber and stops accepting new ones so that the streaming requests finish when the server is
+// shutting down.
+func (b *eventBroadcaster) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.closed = true
+
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.done)
+		eventStreamClientsMetric.Dec()
+	}
+}
+
+// streamComplianceEvents handles the GET API endpoint that streams the newly recorded compliance events as Server-Sent
+// Events. The client's access is only checked when the stream starts, so it only gets the compliance events of the
+// managed clusters it had access to then. To pick up access changes, the stream is closed after EventStreamMaxDuration.
+// If the client reconnects with the Last-Event-ID header, the compliance events recorded since then are replayed first.
+// If there are more than maxEventStreamReplay of them, a replayTruncatedEvent is sent and the stream ends instead of
+// streaming new compliance events. A client that falls behind is disconnected and is expected to reconnect.
+func (s *ComplianceAPIServer) streamComplianceEvents(
+	serverContext *ComplianceServerCtx, w http.ResponseWriter, r *http.Request, userConfig *rest.Config,
+) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+
+	var lastEventID int32
+
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || parsed < 0 {
+			writeErrMsgJSON(w, "The Last-Event-ID header must be a compliance event ID", http.StatusBadRequest)
+
+			return
+		}
+
+		lastEventID = int32(parsed)
+	}
+
+	allRules, err := getManagedClusterRules(userConfig, nil)
+	if err != nil {
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	canAccess := func(clusterName string) bool {
+		return getAccessByClusterName(allRules, clusterName)
+	}
+
+	// Subscribe before the replay so that compliance events recorded during it aren't missed.
+	sub, err := s.eventStream.subscribe(canAccess)
+	if err != nil {
+		w.Header().Set("Retry-After", "1")
+		writeErrMsgJSON(w, "The compliance events stream has too many clients", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	defer s.eventStream.unsubscribe(sub)
+
+	var replayed []*streamedEvent
+
+	// truncatedAt is the ID of the last compliance event considered for the replay if there were too many to replay.
+	var truncatedAt int32
+
+	if lastEventID != 0 {
+		replayed, truncatedAt, err = s.replayComplianceEvents(r.Context(), serverContext, lastEventID, canAccess)
+		if err != nil {
+			reqLog.Error(err, "Failed to query for the compliance events to replay", getPqErrKeyVals(err)...)
+			writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+			return
+		}
+	}
+
+	s.writeEventStream(w, r, sub, replayed, truncatedAt)
+}
+
+// writeEventStream writes the replayed compliance events and then the compliance events published to the subscriber
+// until the request is done, the subscriber is dropped, or EventStreamMaxDuration passes. If truncatedAt isn't 0, a
+// replayTruncatedEvent is written after the replayed compliance events and the stream ends.
+func (s *ComplianceAPIServer) writeEventStream(
+	w http.ResponseWriter, r *http.Request, sub *eventSubscriber, replayed []*streamedEvent, truncatedAt int32,
+) {
+	reqLog := ctrl.LoggerFrom(r.Context())
+	responseController := http.NewResponseController(w)
+
+	// The stream is long lived, so it can't be limited by the write timeout of the server.
+	if err := responseController.SetWriteDeadline(time.Time{}); err != nil {
+		reqLog.V(2).Info("Failed to clear the write deadline of the compliance events stream", "error", err.Error())
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// The replayed compliance events are skipped if they were also published. IDs are tracked individually rather than
+	// as a high-water mark since concurrent transactions can commit compliance events out of ID order.
+	replayedIDs := make(map[int32]struct{}, len(replayed))
+
+	for _, event := range replayed {
+		if err := writeServerSentEvent(w, event); err != nil {
+			reqLog.V(2).Info("Failed to write to the compliance events stream", "error", err.Error())
+
+			return
+		}
+
+		replayedIDs[event.id] = struct{}{}
+	}
+
+	if truncatedAt != 0 {
+		// The client reconnects from truncatedAt to continue the replay or should use the list API endpoint instead.
+		if err := writeReplayTruncatedEvent(w, truncatedAt); err != nil {
+			reqLog.V(2).Info("Failed to write to the compliance events stream", "error", err.Error())
+		}
+
+		_ = responseController.Flush()
+
+		return
+	}
+
+	if err := responseController.Flush(); err != nil {
+		reqLog.V(2).Info("Failed to flush the compliance events stream", "error", err.Error())
+
+		return
+	}
+
+	keepalive := time.NewTicker(eventStreamKeepaliveInterval)
+	defer keepalive.Stop()
+
+	maxDuration := time.NewTimer(s.options.EventStreamMaxDuration)
+	defer maxDuration.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.done:
+			// The client fell behind or the server is shutting down. The client reconnects with Last-Event-ID.
+			return
+		case <-maxDuration.C:
+			// The client reconnects with Last-Event-ID, which checks its access again.
+			return
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event := <-sub.events:
+			if _, ok := replayedIDs[event.id]; ok {
+				continue
+			}
+
+			if err := writeServerSentEvent(w, event); err != nil {
+				reqLog.V(2).Info("Failed to write to the compliance events stream", "error", err.Error())
+
+				return
+			}
+		}
+
+		if err := responseController.Flush(); err != nil {
+			reqLog.V(2).Info("Failed to flush the compliance events stream", "error", err.Error())
+
+			return
+		}
+	}
+}
+
+// replayComplianceEvents returns the compliance events recorded after the input compliance event ID that canAccess
+// returns true for, out of the next maxEventStreamReplay compliance events. If there are more, the ID of the last
+// compliance event considered is also returned so that the replay can continue from it, and 0 is returned otherwise.
+// The primary database is queried since a read replica may not have the most recent compliance events yet.
+func (s *ComplianceAPIServer) replayComplianceEvents(
+	ctx context.Context,
+	serverContext *ComplianceServerCtx,
+	lastEventID int32,
+	canAccess func(clusterName string) bool,
+) ([]*streamedEvent, int32, error) {
+	// The lock is only held for the query so that a long lived stream doesn't block the database connection from
+	// being replaced.
+	serverContext.Lock.RLock()
+	defer serverContext.Lock.RUnlock()
+
+	if serverContext.DB == nil {
+		return nil, 0, errDBUnavailable
+	}
+
+	if s.options.DBQueryTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, s.options.DBQueryTimeout)
+		defer cancel()
+	}
+
+	// One more than the maximum is queried to know if the replay is truncated.
+	query := fmt.Sprintf(
+		"%s\nWHERE compliance_events.id > $1 AND compliance_events.deleted_at IS NULL\n"+
+			"ORDER BY compliance_events.id ASC\nLIMIT %d;",
+		generateGetComplianceEventsQuery(false), maxEventStreamReplay+1,
+	)
+
+	rows, err := serverContext.DB.QueryContext(ctx, query, lastEventID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	replayed := []*streamedEvent{}
+	scanned := 0
+
+	var lastScannedID int32
+
+	for rows.Next() {
+		ce, err := scanIntoComplianceEvent(rows, false)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		scanned++
+
+		if scanned > maxEventStreamReplay {
+			return replayed, lastScannedID, nil
+		}
+
+		lastScannedID = ce.EventID
+
+		if !canAccess(ce.Cluster.Name) {
+			continue
+		}
+
+		streamed, err := newStreamedEvent(ce.EventID, ce)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		replayed = append(replayed, streamed)
+	}
+
+	return replayed, 0, rows.Err()
+}
+
+// writeServerSentEvent writes the compliance event as a Server-Sent Event with its ID so that the client can resume
+// the stream with the Last-Event-ID header. The JSON is compact, so it fits on a single data line.
+func writeServerSentEvent(w io.Writer, event *streamedEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.id, event.data)
+
+	return err
+}
+
+// writeReplayTruncatedEvent writes a replayTruncatedEvent Server-Sent Event with the ID of the last compliance event
+// considered for the replay, so that a client that reconnects continues the replay from there.
+func writeReplayTruncatedEvent(w io.Writer, lastEventID int32) error {
+	_, err := fmt.Fprintf(
+		w,
+		"event: %s\nid: %d\ndata: {\"message\":\"More than %d compliance events were recorded after the "+
+			"Last-Event-ID header. Reconnect to continue the replay or use the compliance events list API.\"}\n\n",
+		replayTruncatedEvent, lastEventID, maxEventStreamReplay,
+	)
+
+	return err
+}
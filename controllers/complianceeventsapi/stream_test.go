@@ -0,0 +1,200 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func newTestEvent(id int32, clusterName string) *ComplianceEvent {
+	return &ComplianceEvent{
+		Cluster: Cluster{Name: clusterName, ClusterID: clusterName + "-id"},
+		Event:   EventDetails{KeyID: id, Compliance: "Compliant", Message: "test"},
+		Policy:  Policy{Name: "test-policy", Spec: JSONMap{"test": true}},
+	}
+}
+
+func TestEventBroadcasterPublish(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	broadcaster := newEventBroadcaster(2, 10)
+
+	all, err := broadcaster.subscribe(func(string) bool { return true })
+	g.Expect(err).ToNot(HaveOccurred())
+
+	cluster1, err := broadcaster.subscribe(func(clusterName string) bool { return clusterName == "cluster1" })
+	g.Expect(err).ToNot(HaveOccurred())
+
+	broadcaster.publish(newTestEvent(1, "cluster1"), newTestEvent(2, "cluster2"))
+
+	g.Expect(all.events).To(HaveLen(2))
+	g.Expect(cluster1.events).To(HaveLen(1))
+
+	streamed := <-cluster1.events
+	g.Expect(streamed.id).To(Equal(int32(1)))
+	// The policy spec is not streamed
+	g.Expect(streamed.data).ToNot(ContainSubstring("spec"))
+	g.Expect(streamed.data).To(ContainSubstring(`"id":1`))
+
+	// The all subscriber's buffer is full, so it is dropped rather than blocking
+	broadcaster.publish(newTestEvent(3, "cluster1"))
+
+	g.Expect(all.done).To(BeClosed())
+	g.Expect(cluster1.done).ToNot(BeClosed())
+	g.Expect(cluster1.events).To(HaveLen(1))
+
+	// Unsubscribing a dropped subscriber must not panic from closing done again
+	broadcaster.unsubscribe(all)
+	broadcaster.unsubscribe(cluster1)
+
+	g.Expect(cluster1.done).To(BeClosed())
+	g.Expect(broadcaster.subscribers).To(BeEmpty())
+}
+
+func TestEventBroadcasterClose(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	broadcaster := newEventBroadcaster(1, 10)
+	sub, err := broadcaster.subscribe(func(string) bool { return true })
+	g.Expect(err).ToNot(HaveOccurred())
+
+	broadcaster.close()
+
+	g.Expect(sub.done).To(BeClosed())
+
+	// A subscriber after the close is immediately done
+	closedSub, err := broadcaster.subscribe(func(string) bool { return true })
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(closedSub.done).To(BeClosed())
+
+	broadcaster.unsubscribe(sub)
+}
+
+func TestEventBroadcasterMaxSubscribers(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	broadcaster := newEventBroadcaster(1, 1)
+
+	sub, err := broadcaster.subscribe(func(string) bool { return true })
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = broadcaster.subscribe(func(string) bool { return true })
+	g.Expect(err).To(MatchError(errEventStreamFull))
+
+	// The slot is freed when the subscriber leaves
+	broadcaster.unsubscribe(sub)
+
+	sub, err = broadcaster.subscribe(func(string) bool { return true })
+	g.Expect(err).ToNot(HaveOccurred())
+
+	broadcaster.unsubscribe(sub)
+}
+
+func TestEventBroadcasterNil(t *testing.T) {
+	t.Parallel()
+
+	var broadcaster *eventBroadcaster
+
+	broadcaster.publish(newTestEvent(1, "cluster1"))
+}
+
+func TestWriteServerSentEvent(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	buf := bytes.Buffer{}
+	err := writeServerSentEvent(&buf, &streamedEvent{id: 12, data: []byte(`{"id":12}`)})
+
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("id: 12\ndata: {\"id\":12}\n\n"))
+}
+
+func TestWriteEventStream(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		replayed    []int32
+		truncatedAt int32
+		published   []int32
+		expected    string
+	}{
+		{
+			name:      "live",
+			published: []int32{1, 2},
+			expected:  "id: 1\ndata: {}\n\nid: 2\ndata: {}\n\n",
+		},
+		{
+			// Compliance event 10 committed after 11 was replayed, so it's only in the live events and is still sent
+			name:      "out of order commit",
+			replayed:  []int32{9, 11},
+			published: []int32{10, 11, 12},
+			expected:  "id: 9\ndata: {}\n\nid: 11\ndata: {}\n\nid: 10\ndata: {}\n\nid: 12\ndata: {}\n\n",
+		},
+		{
+			name:        "truncated replay",
+			replayed:    []int32{9},
+			truncatedAt: 15,
+			published:   []int32{20},
+			expected: "id: 9\ndata: {}\n\nevent: replay-truncated\nid: 15\ndata: {\"message\":\"More than 1000 " +
+				"compliance events were recorded after the Last-Event-ID header. Reconnect to continue the replay or " +
+				"use the compliance events list API.\"}\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			// The stream ends when the maximum duration passes.
+			server := &ComplianceAPIServer{
+				options: ComplianceAPIServerOptions{EventStreamMaxDuration: 100 * time.Millisecond},
+			}
+
+			sub := &eventSubscriber{events: make(chan *streamedEvent, 10), done: make(chan struct{})}
+
+			for _, id := range test.published {
+				sub.events <- &streamedEvent{id: id, data: []byte("{}")}
+			}
+
+			replayed := []*streamedEvent{}
+
+			for _, id := range test.replayed {
+				replayed = append(replayed, &streamedEvent{id: id, data: []byte("{}")})
+			}
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/compliance-events/stream", nil)
+
+			start := time.Now()
+
+			server.writeEventStream(recorder, req, sub, replayed, test.truncatedAt)
+
+			g.Expect(recorder.Code).To(Equal(http.StatusOK))
+			g.Expect(recorder.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+			g.Expect(recorder.Body.String()).To(Equal(test.expected))
+
+			// A truncated replay ends the stream right away rather than waiting for new compliance events.
+			if test.truncatedAt == 0 {
+				g.Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+			}
+		})
+	}
+}
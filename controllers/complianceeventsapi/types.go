@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -21,8 +22,75 @@ var (
 	errRequiredFieldNotProvided = errors.New("required field not provided")
 	errInvalidInput             = errors.New("invalid input")
 	errDuplicateComplianceEvent = errors.New("the compliance event already exists")
+	// errReferenceNotFound is a more specific errInvalidInput for a provided database ID that doesn't exist.
+	errReferenceNotFound  = fmt.Errorf("%w", errInvalidInput)
+	validComplianceStates = []string{"Compliant", "NonCompliant", "Disabled", "Pending"}
 )
 
+const (
+	// maxLabelKeyLength is the maximum length of the key of a compliance event label.
+	maxLabelKeyLength = 128
+	// maxLabelValueLength is the maximum length of the value of a compliance event label.
+	maxLabelValueLength = 256
+)
+
+// FieldError is a validation error for a single field of a compliance event. It wraps errRequiredFieldNotProvided,
+// errInvalidInput, or errReferenceNotFound.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	err     error
+}
+
+func newRequiredFieldError(field string) *FieldError {
+	return &FieldError{Field: field, Message: "is required", err: errRequiredFieldNotProvided}
+}
+
+func newInvalidFieldError(field string, message string) *FieldError {
+	return &FieldError{Field: field, Message: message, err: errInvalidInput}
+}
+
+func newNotFoundFieldError(field string) *FieldError {
+	return &FieldError{Field: field, Message: "not found", err: errReferenceNotFound}
+}
+
+func (e *FieldError) Error() string {
+	if errors.Is(e.err, errRequiredFieldNotProvided) {
+		return fmt.Sprintf("%v: %s", e.err, e.Field)
+	}
+
+	return fmt.Sprintf("%v: %s %s", e.err, e.Field, e.Message)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.err
+}
+
+// getFieldErrors returns all the FieldError errors in the err tree, such as from an error returned by errors.Join.
+func getFieldErrors(err error) []FieldError {
+	fieldErrs := []FieldError{}
+
+	switch typedErr := err.(type) { //nolint:errorlint
+	case *FieldError:
+		fieldErrs = append(fieldErrs, *typedErr)
+	case interface{ Unwrap() []error }:
+		for _, joinedErr := range typedErr.Unwrap() {
+			fieldErrs = append(fieldErrs, getFieldErrors(joinedErr)...)
+		}
+	case interface{ Unwrap() error }:
+		fieldErrs = append(fieldErrs, getFieldErrors(typedErr.Unwrap())...)
+	}
+
+	return fieldErrs
+}
+
+// dbQuerier is satisfied by both *sql.DB and *sql.Tx so that queries can optionally be run in a transaction.
+type dbQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type dbRow interface {
 	InsertQuery() (string, []any)
 	SelectQuery(returnedColumns ...string) (string, []any)
@@ -33,6 +101,8 @@ type metadata struct {
 	Pages   uint64 `json:"pages"`
 	PerPage uint64 `json:"per_page"` //nolint:tagliatelle
 	Total   uint64 `json:"total"`
+	// NextCursor is only set when using cursor based pagination and there is another page.
+	NextCursor string `json:"next_cursor,omitempty"` //nolint:tagliatelle
 }
 
 type ListResponse struct {
@@ -40,11 +110,35 @@ type ListResponse struct {
 	Metadata metadata          `json:"metadata"`
 }
 
+// ProjectedListResponse is the response of listing compliance events with the fields query argument. Each compliance
+// event only has the requested fields.
+type ProjectedListResponse struct {
+	Data     []map[string]any `json:"data"`
+	Metadata metadata         `json:"metadata"`
+}
+
+// StatsResponse is the response of the compliance events stats endpoint. Counts maps each compliance state to the
+// number of compliance events with it.
+type StatsResponse struct {
+	Counts map[string]uint64 `json:"counts"`
+	Total  uint64            `json:"total"`
+}
+
 type queryOptions struct {
-	ArrayFilters    map[string][]string
-	Direction       string
-	Filters         map[string][]string
-	IncludeSpec     bool
+	ArrayFilters map[string][]string
+	// Cursor is the position to continue from when using cursor based pagination. It's nil on the first page.
+	Cursor       *eventCursor
+	CursorPaging bool
+	Direction    string
+	// Fields are the values of the fields query argument. If set, only these fields are selected and returned.
+	Fields         []string
+	Filters        map[string][]string
+	IncludeDeleted bool
+	IncludeSpec    bool
+	// LabelFilters maps a label key to the values that a compliance event label must have one of.
+	LabelFilters map[string][]string
+	// LatestOnly limits the results to the latest matching compliance event of each policy on each cluster.
+	LatestOnly      bool
 	MessageIncludes string
 	MessageLike     string
 	NullFilters     []string
@@ -65,8 +159,8 @@ type ComplianceEvent struct {
 
 // Validate ensures that a valid POST request for a compliance event is set. This means that if the shorthand approach
 // of providing parent_policy.id and/or policy.id is used, the other fields for ParentPolicy and Policy will not be
-// present.
-func (ce ComplianceEvent) Validate(ctx context.Context, serverContext *ComplianceServerCtx) error {
+// present. If maxSpecBytes is positive, a policy spec with a larger JSON encoding is invalid.
+func (ce ComplianceEvent) Validate(ctx context.Context, serverContext *ComplianceServerCtx, maxSpecBytes int64) error {
 	errs := make([]error, 0)
 
 	if err := ce.Cluster.Validate(); err != nil {
@@ -92,7 +186,7 @@ func (ce ComplianceEvent) Validate(ctx context.Context, serverContext *Complianc
 				// If the user provided extra data, ignore it since it won't be validated that it matches the database
 				ce.ParentPolicy = &ParentPolicy{KeyID: ce.ParentPolicy.KeyID}
 			} else {
-				errs = append(errs, fmt.Errorf("%w: parent_policy.id not found", errInvalidInput))
+				errs = append(errs, newNotFoundFieldError("parent_policy.id"))
 			}
 		} else if err := ce.ParentPolicy.Validate(); err != nil {
 			errs = append(errs, err)
@@ -121,16 +215,23 @@ func (ce ComplianceEvent) Validate(ctx context.Context, serverContext *Complianc
 			// If the user provided extra data, ignore it since it won't be validated that it matches the database
 			ce.Policy = Policy{KeyID: ce.Policy.KeyID}
 		} else {
-			errs = append(errs, fmt.Errorf("%w: policy.id not found", errInvalidInput))
+			errs = append(errs, newNotFoundFieldError("policy.id"))
 		}
 	} else if err := ce.Policy.Validate(); err != nil {
 		errs = append(errs, err)
+	} else if err := ce.Policy.validateSpecSize(maxSpecBytes); err != nil {
+		errs = append(errs, err)
 	}
 
 	return errors.Join(errs...)
 }
 
-func (ce *ComplianceEvent) Create(ctx context.Context, db *sql.DB) error {
+// usesDatabaseIDs returns true if the shorthand approach of providing parent_policy.id or policy.id is used.
+func (ce *ComplianceEvent) usesDatabaseIDs() bool {
+	return ce.Policy.KeyID != 0 || (ce.ParentPolicy != nil && ce.ParentPolicy.KeyID != 0)
+}
+
+func (ce *ComplianceEvent) Create(ctx context.Context, db dbQuerier) error {
 	if ce.Event.ClusterID == 0 {
 		ce.Event.ClusterID = ce.Cluster.KeyID
 	}
@@ -146,10 +247,11 @@ func (ce *ComplianceEvent) Create(ctx context.Context, db *sql.DB) error {
 	insertQuery, insertArgs := ce.Event.InsertQuery()
 
 	row := db.QueryRowContext( //nolint:execinquery
-		ctx, insertQuery+" ON CONFLICT DO NOTHING RETURNING id", insertArgs...,
+		ctx, insertQuery+" ON CONFLICT DO NOTHING RETURNING id, timestamp", insertArgs...,
 	)
 
-	err := row.Scan(&ce.Event.KeyID)
+	// The timestamp is scanned back since the database stores it with less precision than the input.
+	err := row.Scan(&ce.Event.KeyID, &ce.Event.Timestamp)
 	if err != nil {
 		// If this is true, then we know we encountered a conflict. This is simpler than parsing the unique constraint
 		// error.
@@ -173,11 +275,11 @@ func (c Cluster) Validate() error {
 	errs := make([]error, 0)
 
 	if c.Name == "" {
-		errs = append(errs, fmt.Errorf("%w: cluster.name", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("cluster.name"))
 	}
 
 	if c.ClusterID == "" {
-		errs = append(errs, fmt.Errorf("%w: cluster.cluster_id", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("cluster.cluster_id"))
 	}
 
 	return errors.Join(errs...)
@@ -204,7 +306,7 @@ func (c *Cluster) SelectQuery(returnedColumns ...string) (string, []any) {
 	return sql, values
 }
 
-func (c *Cluster) GetOrCreate(ctx context.Context, db *sql.DB) error {
+func (c *Cluster) GetOrCreate(ctx context.Context, db dbQuerier) error {
 	return getOrCreate(ctx, db, c)
 }
 
@@ -246,6 +348,7 @@ type EventDetails struct {
 	Message        string    `db:"message" json:"message"`
 	Timestamp      time.Time `db:"timestamp" json:"timestamp"`
 	Metadata       JSONMap   `db:"metadata" json:"metadata"`
+	Labels         Labels    `db:"labels" json:"labels,omitempty"`
 	ReportedBy     *string   `db:"reported_by" json:"reported_by"` //nolint:tagliatelle
 }
 
@@ -253,27 +356,27 @@ func (e EventDetails) Validate() error {
 	errs := make([]error, 0)
 
 	if e.Compliance == "" {
-		errs = append(errs, fmt.Errorf("%w: event.compliance", errRequiredFieldNotProvided))
-	} else {
-		switch e.Compliance {
-		case "Compliant", "NonCompliant", "Disabled", "Pending":
-		default:
-			errs = append(
-				errs,
-				fmt.Errorf(
-					"%w: event.compliance should be Compliant, NonCompliant, Disabled, or Pending got %v",
-					errInvalidInput, e.Compliance,
-				),
-			)
-		}
+		errs = append(errs, newRequiredFieldError("event.compliance"))
+	} else if !slices.Contains(validComplianceStates, e.Compliance) {
+		errs = append(
+			errs,
+			newInvalidFieldError(
+				"event.compliance",
+				"should be Compliant, NonCompliant, Disabled, or Pending got "+e.Compliance,
+			),
+		)
 	}
 
 	if e.Message == "" {
-		errs = append(errs, fmt.Errorf("%w: event.message", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("event.message"))
 	}
 
 	if e.Timestamp.IsZero() {
-		errs = append(errs, fmt.Errorf("%w: event.timestamp", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("event.timestamp"))
+	}
+
+	if err := e.Labels.Validate(); err != nil {
+		errs = append(errs, err)
 	}
 
 	return errors.Join(errs...)
@@ -281,10 +384,18 @@ func (e EventDetails) Validate() error {
 
 func (e *EventDetails) InsertQuery() (string, []any) {
 	sql := `INSERT INTO compliance_events` +
-		`(cluster_id, compliance, message, metadata, parent_policy_id, policy_id, reported_by, timestamp) ` +
-		`VALUES($1, $2, $3, $4, $5, $6, $7, $8)`
+		`(cluster_id, compliance, labels, message, metadata, parent_policy_id, policy_id, reported_by, timestamp) ` +
+		`VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 	values := []any{
-		e.ClusterID, e.Compliance, e.Message, e.Metadata, e.ParentPolicyID, e.PolicyID, e.ReportedBy, e.Timestamp,
+		e.ClusterID,
+		e.Compliance,
+		e.Labels,
+		e.Message,
+		e.Metadata,
+		e.ParentPolicyID,
+		e.PolicyID,
+		e.ReportedBy,
+		e.Timestamp,
 	}
 
 	return sql, values
@@ -303,11 +414,11 @@ func (p ParentPolicy) Validate() error {
 	errs := []error{}
 
 	if p.Name == "" {
-		errs = append(errs, fmt.Errorf("%w: parent_policy.name", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("parent_policy.name"))
 	}
 
 	if p.Namespace == "" {
-		errs = append(errs, fmt.Errorf("%w: parent_policy.namespace", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("parent_policy.namespace"))
 	}
 
 	return errors.Join(errs...)
@@ -362,7 +473,7 @@ func (p *ParentPolicy) SelectQuery(returnedColumns ...string) (string, []any) {
 	return sql, values
 }
 
-func (p *ParentPolicy) GetOrCreate(ctx context.Context, db *sql.DB) error {
+func (p *ParentPolicy) GetOrCreate(ctx context.Context, db dbQuerier) error {
 	return getOrCreate(ctx, db, p)
 }
 
@@ -455,24 +566,43 @@ func (p *Policy) Validate() error {
 	errs := make([]error, 0)
 
 	if p.APIGroup == "" {
-		errs = append(errs, fmt.Errorf("%w: policy.apiGroup", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("policy.apiGroup"))
 	}
 
 	if p.Kind == "" {
-		errs = append(errs, fmt.Errorf("%w: policy.kind", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("policy.kind"))
 	}
 
 	if p.Name == "" {
-		errs = append(errs, fmt.Errorf("%w: policy.name", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("policy.name"))
 	}
 
 	if p.Spec == nil {
-		errs = append(errs, fmt.Errorf("%w: policy.spec", errRequiredFieldNotProvided))
+		errs = append(errs, newRequiredFieldError("policy.spec"))
 	}
 
 	return errors.Join(errs...)
 }
 
+// validateSpecSize returns an error if the JSON encoding of the spec is larger than maxBytes. A maxBytes of 0 or less
+// disables the check.
+func (p *Policy) validateSpecSize(maxBytes int64) error {
+	if maxBytes <= 0 {
+		return nil
+	}
+
+	spec, err := json.Marshal(p.Spec)
+	if err != nil {
+		return newInvalidFieldError("policy.spec", "is not valid JSON")
+	}
+
+	if int64(len(spec)) > maxBytes {
+		return newInvalidFieldError("policy.spec", fmt.Sprintf("must not be larger than %d bytes", maxBytes))
+	}
+
+	return nil
+}
+
 func (p *Policy) InsertQuery() (string, []any) {
 	sql := `INSERT INTO policies` +
 		`(api_group, kind, name, namespace, severity, spec)` +
@@ -516,7 +646,7 @@ func (p *Policy) SelectQuery(returnedColumns ...string) (string, []any) {
 	return sql, values
 }
 
-func (p *Policy) GetOrCreate(ctx context.Context, db *sql.DB) error {
+func (p *Policy) GetOrCreate(ctx context.Context, db dbQuerier) error {
 	return getOrCreate(ctx, db, p)
 }
 
@@ -563,11 +693,82 @@ func (j *JSONMap) Scan(src interface{}) error {
 	return json.Unmarshal(source, j)
 }
 
+// Labels are string key-value pairs that clients attach to a compliance event, such as a remediation ID, so that
+// compliance events can be filtered by them. They are stored as a JSONB object.
+type Labels map[string]string
+
+// Validate ensures that the keys aren't empty and the keys and values aren't too long.
+func (l Labels) Validate() error {
+	keys := make([]string, 0, len(l))
+
+	for key := range l {
+		keys = append(keys, key)
+	}
+
+	// Sort the keys so that the errors are in a consistent order.
+	slices.Sort(keys)
+
+	errs := make([]error, 0)
+
+	for _, key := range keys {
+		if key == "" {
+			errs = append(errs, newInvalidFieldError("event.labels", "keys must not be empty"))
+
+			continue
+		}
+
+		if len(key) > maxLabelKeyLength {
+			errs = append(errs, newInvalidFieldError(
+				"event.labels",
+				fmt.Sprintf("the key %s must not be longer than %d characters", key, maxLabelKeyLength),
+			))
+		}
+
+		if len(l[key]) > maxLabelValueLength {
+			errs = append(errs, newInvalidFieldError(
+				"event.labels."+key,
+				fmt.Sprintf("must not be longer than %d characters", maxLabelValueLength),
+			))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Value returns a value that the database driver can use, or an error. Empty labels are stored as NULL.
+func (l Labels) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(l)
+}
+
+// Scan allows for reading Labels from the database.
+func (l *Labels) Scan(src interface{}) error {
+	var source []byte
+
+	switch s := src.(type) {
+	case string:
+		source = []byte(s)
+	case []byte:
+		source = s
+	case nil:
+		*l = nil
+
+		return nil
+	default:
+		return errors.New("incompatible type for Labels")
+	}
+
+	return json.Unmarshal(source, l)
+}
+
 // getOrCreate will translate the input object to an INSERT SQL query. When the input object already exists in the
 // database, a SELECT query is performed. The primary key is set on the input object when it is inserted or gotten
 // from the database. The INSERT first then SELECT approach is a clean way to account for race conditions of multiple
 // goroutines creating the same row.
-func getOrCreate(ctx context.Context, db *sql.DB, obj dbRow) error {
+func getOrCreate(ctx context.Context, db dbQuerier, obj dbRow) error {
 	insertQuery, insertArgs := obj.InsertQuery()
 
 	// On inserts, it returns the primary key value (e.g. id). If it already exists, nothing is returned.
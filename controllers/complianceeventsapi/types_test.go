@@ -1,6 +1,7 @@
 package complianceeventsapi
 
 import (
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -50,6 +51,28 @@ func TestEventDetailsValidation(t *testing.T) {
 			EventDetails{Compliance: "Compliant", Message: "hello"},
 			"field not provided: event.timestamp",
 		},
+		"empty label key": {
+			EventDetails{Compliance: "Compliant", Message: "hello", Timestamp: time.Now(), Labels: Labels{"": "a"}},
+			"event.labels keys must not be empty",
+		},
+		"long label key": {
+			EventDetails{
+				Compliance: "Compliant",
+				Message:    "hello",
+				Timestamp:  time.Now(),
+				Labels:     Labels{strings.Repeat("k", maxLabelKeyLength+1): "a"},
+			},
+			"must not be longer than 128 characters",
+		},
+		"long label value": {
+			EventDetails{
+				Compliance: "Compliant",
+				Message:    "hello",
+				Timestamp:  time.Now(),
+				Labels:     Labels{"run-id": strings.Repeat("v", maxLabelValueLength+1)},
+			},
+			"event.labels.run-id must not be longer than 256 characters",
+		},
 	}
 
 	for input, tc := range tests {
@@ -149,3 +172,63 @@ func TestPolicyValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestPolicySpecSizeValidation(t *testing.T) {
+	policy := Policy{Spec: map[string]interface{}{"test": "one"}}
+
+	// The JSON of the spec is {"test":"one"}, which is 14 bytes.
+	tests := map[string]struct {
+		maxBytes  int64
+		expectErr bool
+	}{
+		"disabled":       {0, false},
+		"at the limit":   {14, false},
+		"over the limit": {13, true},
+	}
+
+	for input, tc := range tests {
+		t.Run(input, func(t *testing.T) {
+			err := policy.validateSpecSize(tc.maxBytes)
+			if !tc.expectErr {
+				if err != nil {
+					t.Fatal("expected no error; got", err.Error())
+				}
+
+				return
+			}
+
+			if err == nil || err.Error() != "invalid input: policy.spec must not be larger than 13 bytes" {
+				t.Fatal("expected the spec size error; got", err)
+			}
+		})
+	}
+}
+
+func TestGetFieldErrors(t *testing.T) {
+	err := errors.Join(
+		Cluster{}.Validate(),
+		EventDetails{Compliance: "bad", Message: "hello", Timestamp: time.Now()}.Validate(),
+		errors.New("not a field error"),
+	)
+
+	expected := []FieldError{
+		{Field: "cluster.name", Message: "is required"},
+		{Field: "cluster.cluster_id", Message: "is required"},
+		{Field: "event.compliance", Message: "should be Compliant, NonCompliant, Disabled, or Pending got bad"},
+	}
+
+	fieldErrs := getFieldErrors(err)
+	if len(fieldErrs) != len(expected) {
+		t.Fatalf("expected %d field errors; got %v", len(expected), fieldErrs)
+	}
+
+	for i, fieldErr := range fieldErrs {
+		if fieldErr.Field != expected[i].Field || fieldErr.Message != expected[i].Message {
+			t.Fatal("expected field error", expected[i], "got", fieldErr)
+		}
+	}
+
+	if !errors.Is(err, errRequiredFieldNotProvided) || !errors.Is(err, errInvalidInput) {
+		t.Fatal("expected the field errors to wrap the sentinel errors")
+	}
+}
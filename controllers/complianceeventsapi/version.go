@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	"open-cluster-management.io/governance-policy-propagator/version"
+)
+
+type VersionResponse struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"` //nolint:tagliatelle
+	BuildDate string `json:"build_date"` //nolint:tagliatelle
+	GoVersion string `json:"go_version"` //nolint:tagliatelle
+}
+
+// serveVersion serves the build metadata of the running binary. It doesn't require authentication or a database
+// connection so that it can be used to confirm which build was rolled out.
+func serveVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+
+		return
+	}
+
+	resp, err := json.Marshal(VersionResponse{
+		Version:   version.Version,
+		GitCommit: version.GitCommit,
+		BuildDate: version.BuildDate,
+		GoVersion: runtime.Version(),
+	})
+	if err != nil {
+		log.Error(err, "error marshaling the version")
+		writeErrMsgJSON(w, "Internal Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	if _, err := w.Write(resp); err != nil {
+		log.Error(err, "Error writing the version")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql"
+)
+
+// warmKeyCaches preloads the database ID caches with the clusters, parent policies, and policies of the most recent
+// compliance events, up to the CacheWarmupSize option of each, so that the first compliance events after startup don't
+// need extra database queries. It does nothing if the CacheWarmupSize option is not set.
+func (s *ComplianceAPIServer) warmKeyCaches(ctx context.Context, serverContext *ComplianceServerCtx) {
+	if s.options.CacheWarmupSize <= 0 {
+		return
+	}
+
+	serverContext.Lock.RLock()
+	defer serverContext.Lock.RUnlock()
+
+	if serverContext.DB == nil {
+		log.Info("Skipping warming the database ID caches since the database is unavailable")
+
+		return
+	}
+
+	clusters, err := warmClusterKeyCache(ctx, serverContext.DB, s.options.CacheWarmupSize)
+	if err != nil {
+		log.Error(err, "Failed to warm the cluster ID cache", getPqErrKeyVals(err)...)
+	}
+
+	parentPolicies, err := warmParentPolicyKeyCache(ctx, serverContext, s.options.CacheWarmupSize)
+	if err != nil {
+		log.Error(err, "Failed to warm the parent policy ID cache", getPqErrKeyVals(err)...)
+	}
+
+	policies, err := warmPolicyKeyCache(ctx, serverContext, s.options.CacheWarmupSize)
+	if err != nil {
+		log.Error(err, "Failed to warm the policy ID cache", getPqErrKeyVals(err)...)
+	}
+
+	log.Info(
+		"Warmed the database ID caches", "clusters", clusters, "parentPolicies", parentPolicies, "policies", policies,
+	)
+}
+
+func warmClusterKeyCache(ctx context.Context, db *sql.DB, limit int) (int, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`SELECT clusters.id, clusters.cluster_id FROM clusters `+
+			`JOIN compliance_events ON compliance_events.cluster_id = clusters.id `+
+			`GROUP BY clusters.id ORDER BY MAX(compliance_events.timestamp) DESC LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	count := 0
+
+	for rows.Next() {
+		var id int32
+		var clusterID string
+
+		if err := rows.Scan(&id, &clusterID); err != nil {
+			return count, err
+		}
+
+		clusterKeyCache.Store(clusterID, id)
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+func warmParentPolicyKeyCache(ctx context.Context, serverContext *ComplianceServerCtx, limit int) (int, error) {
+	rows, err := serverContext.DB.QueryContext(
+		ctx,
+		`SELECT parent_policies.id, parent_policies.name, parent_policies.namespace, parent_policies.categories, `+
+			`parent_policies.controls, parent_policies.standards FROM parent_policies `+
+			`JOIN compliance_events ON compliance_events.parent_policy_id = parent_policies.id `+
+			`GROUP BY parent_policies.id ORDER BY MAX(compliance_events.timestamp) DESC LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	count := 0
+
+	for rows.Next() {
+		pp := ParentPolicy{}
+
+		err := rows.Scan(&pp.KeyID, &pp.Name, &pp.Namespace, &pp.Categories, &pp.Controls, &pp.Standards)
+		if err != nil {
+			return count, err
+		}
+
+		serverContext.ParentPolicyToID.Store(pp.Key(), pp.KeyID)
+		count++
+	}
+
+	return count, rows.Err()
+}
+
+func warmPolicyKeyCache(ctx context.Context, serverContext *ComplianceServerCtx, limit int) (int, error) {
+	rows, err := serverContext.DB.QueryContext(
+		ctx,
+		`SELECT policies.id, policies.api_group, policies.kind, policies.name, policies.namespace, `+
+			`policies.severity, policies.spec FROM policies `+
+			`JOIN compliance_events ON compliance_events.policy_id = policies.id `+
+			`GROUP BY policies.id ORDER BY MAX(compliance_events.timestamp) DESC LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	count := 0
+
+	for rows.Next() {
+		policy := Policy{}
+
+		err := rows.Scan(
+			&policy.KeyID, &policy.APIGroup, &policy.Kind, &policy.Name, &policy.Namespace, &policy.Severity,
+			&policy.Spec,
+		)
+		if err != nil {
+			return count, err
+		}
+
+		serverContext.PolicyToID.Store(policy.Key(), policy.KeyID)
+		count++
+	}
+
+	return count, rows.Err()
+}
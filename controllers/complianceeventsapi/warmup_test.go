@@ -0,0 +1,202 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// warmupDriver is a database/sql driver that answers the cache warmup queries with a single cluster, parent policy,
+// and policy. It records the limit of each query.
+type warmupDriver struct {
+	lock   sync.Mutex
+	limits []int64
+}
+
+func (d *warmupDriver) Open(string) (driver.Conn, error) {
+	return &warmupConn{driver: d}, nil
+}
+
+func (d *warmupDriver) queryLimits() []int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return append([]int64{}, d.limits...)
+}
+
+type warmupConn struct {
+	driver *warmupDriver
+}
+
+func (c *warmupConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) == 1 {
+		limit, _ := args[0].Value.(int64)
+
+		c.driver.lock.Lock()
+		c.driver.limits = append(c.driver.limits, limit)
+		c.driver.lock.Unlock()
+	}
+
+	switch {
+	case strings.HasPrefix(query, "SELECT clusters.id"):
+		return &warmupRows{
+			columns: []string{"id", "cluster_id"},
+			values:  []driver.Value{int64(1), "warmup-cluster"},
+		}, nil
+	case strings.HasPrefix(query, "SELECT parent_policies.id"):
+		return &warmupRows{
+			columns: []string{"id", "name", "namespace", "categories", "controls", "standards"},
+			values:  []driver.Value{int64(2), "parent", "policies", []byte("{cat}"), []byte("{}"), nil},
+		}, nil
+	case strings.HasPrefix(query, "SELECT policies.id"):
+		return &warmupRows{
+			columns: []string{"id", "api_group", "kind", "name", "namespace", "severity", "spec"},
+			values: []driver.Value{
+				int64(3), "policy.open-cluster-management.io", "ConfigurationPolicy", "policy", nil, "low",
+				[]byte(`{"remediationAction":"inform"}`),
+			},
+		}, nil
+	default:
+		return nil, errors.New("unexpected query: " + query)
+	}
+}
+
+func (c *warmupConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *warmupConn) Close() error {
+	return nil
+}
+
+func (c *warmupConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+// warmupRows returns a single row of values.
+type warmupRows struct {
+	columns []string
+	values  []driver.Value
+	done    bool
+}
+
+func (r *warmupRows) Columns() []string {
+	return r.columns
+}
+
+func (r *warmupRows) Close() error {
+	return nil
+}
+
+func (r *warmupRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+
+	r.done = true
+	copy(dest, r.values)
+
+	return nil
+}
+
+type warmupConnector struct {
+	driver *warmupDriver
+}
+
+func (c warmupConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c warmupConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func TestWarmKeyCaches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		warmupSize     int
+		expectedLimits []int64
+		expectedCached bool
+	}{
+		{"disabled", 0, []int64{}, false},
+		{"enabled", 50, []int64{50, 50, 50}, true},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			warmupDrv := &warmupDriver{}
+			db := sql.OpenDB(warmupConnector{driver: warmupDrv})
+
+			t.Cleanup(func() { db.Close() })
+
+			serverContext := &ComplianceServerCtx{
+				DB:               db,
+				ParentPolicyToID: NewKeyCache(DefaultKeyCacheCapacity, DefaultKeyCacheTTL),
+				PolicyToID:       NewKeyCache(DefaultKeyCacheCapacity, DefaultKeyCacheTTL),
+			}
+
+			server := &ComplianceAPIServer{options: ComplianceAPIServerOptions{CacheWarmupSize: test.warmupSize}}
+			server.warmKeyCaches(context.Background(), serverContext)
+
+			g.Expect(warmupDrv.queryLimits()).To(Equal(test.expectedLimits))
+
+			if !test.expectedCached {
+				g.Expect(serverContext.ParentPolicyToID.Len()).To(BeZero())
+				g.Expect(serverContext.PolicyToID.Len()).To(BeZero())
+
+				return
+			}
+
+			parentPolicy := ParentPolicy{
+				Name: "parent", Namespace: "policies", Categories: []string{"cat"}, Controls: []string{},
+			}
+
+			severity := "low"
+			policy := Policy{
+				APIGroup: "policy.open-cluster-management.io",
+				Kind:     "ConfigurationPolicy",
+				Name:     "policy",
+				Severity: &severity,
+				Spec:     JSONMap{"remediationAction": "inform"},
+			}
+
+			clusterID, ok := clusterKeyCache.Load("warmup-cluster")
+			g.Expect(ok).To(BeTrue())
+			g.Expect(clusterID).To(Equal(int32(1)))
+
+			parentPolicyID, ok := serverContext.ParentPolicyToID.Load(parentPolicy.Key())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(parentPolicyID).To(Equal(int32(2)))
+
+			policyID, ok := serverContext.PolicyToID.Load(policy.Key())
+			g.Expect(ok).To(BeTrue())
+			g.Expect(policyID).To(Equal(int32(3)))
+		})
+	}
+}
+
+func TestWarmKeyCachesNoDB(t *testing.T) {
+	t.Parallel()
+
+	server := &ComplianceAPIServer{options: ComplianceAPIServerOptions{CacheWarmupSize: 50}}
+
+	// This only logs that the warmup was skipped.
+	server.warmKeyCaches(context.Background(), &ComplianceServerCtx{})
+}
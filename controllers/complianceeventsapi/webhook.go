@@ -0,0 +1,272 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWebhookRetries is the default number of times a failed webhook delivery is retried.
+	DefaultWebhookRetries = 3
+	// DefaultWebhookTimeout is the default maximum duration of a single webhook delivery attempt.
+	DefaultWebhookTimeout = 10 * time.Second
+	// webhookQueueSize is the number of webhook deliveries that can wait to be sent. Deliveries are dropped when it's
+	// full so that a slow webhook endpoint doesn't slow down recording compliance events.
+	webhookQueueSize = 1000
+	// webhookRetryBaseDelay is the delay before the first retry of a webhook delivery. It doubles on each retry.
+	webhookRetryBaseDelay = time.Second
+)
+
+// DefaultWebhookStatuses are the compliance statuses that trigger a webhook delivery by default.
+var DefaultWebhookStatuses = []string{"NonCompliant"}
+
+// WebhookPayload is the JSON body sent to the webhook for a recorded compliance event. It intentionally doesn't include
+// the policy spec or the compliance event metadata, but it includes the labels so that the receiver can correlate it,
+// such as with a remediation run.
+type WebhookPayload struct {
+	EventID               int32     `json:"event_id"`                          //nolint:tagliatelle
+	ClusterName           string    `json:"cluster_name"`                      //nolint:tagliatelle
+	ClusterID             string    `json:"cluster_id"`                        //nolint:tagliatelle
+	PolicyID              int32     `json:"policy_id"`                         //nolint:tagliatelle
+	PolicyAPIGroup        string    `json:"policy_api_group,omitempty"`        //nolint:tagliatelle
+	PolicyKind            string    `json:"policy_kind,omitempty"`             //nolint:tagliatelle
+	PolicyName            string    `json:"policy_name,omitempty"`             //nolint:tagliatelle
+	PolicyNamespace       *string   `json:"policy_namespace,omitempty"`        //nolint:tagliatelle
+	ParentPolicyName      string    `json:"parent_policy_name,omitempty"`      //nolint:tagliatelle
+	ParentPolicyNamespace string    `json:"parent_policy_namespace,omitempty"` //nolint:tagliatelle
+	Compliance            string    `json:"compliance"`
+	Message               string    `json:"message"`
+	Timestamp             time.Time `json:"timestamp"`
+	Labels                Labels    `json:"labels,omitempty"`
+}
+
+// newWebhookPayload returns the webhook payload of a recorded compliance event.
+func newWebhookPayload(event *ComplianceEvent) *WebhookPayload {
+	payload := &WebhookPayload{
+		EventID:         event.Event.KeyID,
+		ClusterName:     event.Cluster.Name,
+		ClusterID:       event.Cluster.ClusterID,
+		PolicyID:        event.Event.PolicyID,
+		PolicyAPIGroup:  event.Policy.APIGroup,
+		PolicyKind:      event.Policy.Kind,
+		PolicyName:      event.Policy.Name,
+		PolicyNamespace: event.Policy.Namespace,
+		Compliance:      event.Event.Compliance,
+		Message:         event.Event.Message,
+		Timestamp:       event.Event.Timestamp,
+		Labels:          event.Event.Labels,
+	}
+
+	if event.ParentPolicy != nil {
+		payload.ParentPolicyName = event.ParentPolicy.Name
+		payload.ParentPolicyNamespace = event.ParentPolicy.Namespace
+	}
+
+	return payload
+}
+
+// validateWebhookURL returns an error if the webhook URL isn't an absolute HTTP or HTTPS URL.
+func validateWebhookURL(webhookURL string) error {
+	parsed, err := url.ParseRequestURI(webhookURL)
+	if err != nil {
+		return fmt.Errorf("the webhook URL is invalid: %w", err)
+	}
+
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("the webhook URL must be an http or https URL: %s", webhookURL)
+	}
+
+	return nil
+}
+
+// webhookNotifier sends a WebhookPayload to the webhook URL for every recorded compliance event with one of the
+// configured compliance statuses. Deliveries are sent in the background so that a slow webhook endpoint doesn't slow
+// down recording compliance events. A nil *webhookNotifier discards the compliance events so that callers don't need
+// to check if the webhook is enabled.
+type webhookNotifier struct {
+	url      string
+	statuses []string
+	retries  int
+	// retryBaseDelay is the delay before the first retry of a delivery. It doubles on each retry.
+	retryBaseDelay time.Duration
+	client         *http.Client
+	// lock protects closed so that a payload is never sent on the closed payloads channel.
+	lock     sync.RWMutex
+	closed   bool
+	payloads chan *WebhookPayload
+	done     chan struct{}
+	// cancel stops the worker from retrying when the remaining deliveries aren't sent in time.
+	cancel context.CancelFunc
+}
+
+// startWebhookNotifier starts the worker that delivers the compliance events sent to the returned notifier to the
+// WebhookURL option. The worker runs until the notifier is stopped.
+func (s *ComplianceAPIServer) startWebhookNotifier() *webhookNotifier {
+	// The worker isn't stopped by the server's context since the notifier is stopped after it's closed.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	notifier := &webhookNotifier{
+		url:            s.options.WebhookURL,
+		statuses:       s.options.WebhookStatuses,
+		retries:        s.options.WebhookRetries,
+		retryBaseDelay: webhookRetryBaseDelay,
+		client:         &http.Client{Timeout: s.options.WebhookTimeout},
+		payloads:       make(chan *WebhookPayload, webhookQueueSize),
+		done:           make(chan struct{}),
+		cancel:         cancel,
+	}
+
+	log.Info("Starting the compliance event webhook", "statuses", notifier.statuses)
+
+	go func() {
+		defer close(notifier.done)
+
+		for payload := range notifier.payloads {
+			notifier.deliver(ctx, payload)
+		}
+	}()
+
+	return notifier
+}
+
+// notify queues a webhook delivery for each of the input compliance events, which must have been committed to the
+// database, that has one of the configured compliance statuses. This doesn't block, so deliveries are dropped if the
+// queue is full.
+func (n *webhookNotifier) notify(events ...*ComplianceEvent) {
+	if n == nil {
+		return
+	}
+
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	if n.closed {
+		return
+	}
+
+	for _, event := range events {
+		if !slices.Contains(n.statuses, event.Event.Compliance) {
+			continue
+		}
+
+		select {
+		case n.payloads <- newWebhookPayload(event):
+		default:
+			webhookDeliveriesMetric.WithLabelValues("dropped").Inc()
+			log.Info(
+				"The compliance event webhook queue is full. Dropping the delivery.", "eventID", event.Event.KeyID,
+			)
+		}
+	}
+}
+
+// deliver sends the payload to the webhook URL. Network errors, 429 responses, and 5xx responses are retried with an
+// exponential backoff until the retries are exhausted or ctx is closed. Other responses aren't retried since
+// retrying won't change the result.
+func (n *webhookNotifier) deliver(ctx context.Context, payload *WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error(err, "Failed to marshal the compliance event webhook payload", "eventID", payload.EventID)
+		webhookDeliveriesMetric.WithLabelValues("failed").Inc()
+
+		return
+	}
+
+	delay := n.retryBaseDelay
+
+	for attempt := 1; ; attempt++ {
+		retryable, err := n.post(ctx, body)
+		if err == nil {
+			webhookDeliveriesMetric.WithLabelValues("success").Inc()
+
+			return
+		}
+
+		if !retryable || attempt > n.retries || ctx.Err() != nil {
+			log.Error(err, "Failed to deliver the compliance event webhook", "eventID", payload.EventID)
+			webhookDeliveriesMetric.WithLabelValues("failed").Inc()
+
+			return
+		}
+
+		log.V(2).Info(
+			"Retrying the compliance event webhook delivery",
+			"eventID", payload.EventID, "attempt", attempt, "delay", delay.String(), "error", err.Error(),
+		)
+
+		select {
+		case <-ctx.Done():
+			log.Error(err, "Failed to deliver the compliance event webhook", "eventID", payload.EventID)
+			webhookDeliveriesMetric.WithLabelValues("failed").Inc()
+
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// post sends a single delivery attempt of the JSON body. The returned bool is true if a failure can be retried.
+func (n *webhookNotifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	// Drain the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+
+	return retryable, fmt.Errorf("the webhook responded with the status code %d", resp.StatusCode)
+}
+
+// stop stops accepting compliance events and waits for the queued deliveries to be sent. If that takes longer than
+// timeout, the remaining deliveries are dropped.
+func (n *webhookNotifier) stop(timeout time.Duration) {
+	if n == nil {
+		return
+	}
+
+	n.lock.Lock()
+	n.closed = true
+	close(n.payloads)
+	n.lock.Unlock()
+
+	select {
+	case <-n.done:
+	case <-time.After(timeout):
+		log.Info(
+			"Timed out sending the compliance event webhook deliveries. Dropping the remaining deliveries.",
+			"timeout", timeout.String(),
+		)
+
+		n.cancel()
+		<-n.done
+	}
+
+	n.cancel()
+}
@@ -0,0 +1,208 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package complianceeventsapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// webhookRecorder is a webhook endpoint that responds with the input status codes in order, and then with 200, and
+// records the payloads it received.
+type webhookRecorder struct {
+	lock     sync.Mutex
+	codes    []int
+	attempts int
+	payloads []WebhookPayload
+}
+
+func (wr *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+
+	wr.attempts++
+
+	if len(wr.codes) != 0 {
+		code := wr.codes[0]
+		wr.codes = wr.codes[1:]
+
+		if code != http.StatusOK {
+			w.WriteHeader(code)
+
+			return
+		}
+	}
+
+	body, _ := io.ReadAll(r.Body)
+
+	payload := WebhookPayload{}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		wr.payloads = append(wr.payloads, payload)
+	}
+}
+
+func newTestWebhookNotifier(url string, retries int) *webhookNotifier {
+	s := NewComplianceAPIServer("", nil, nil, ComplianceAPIServerOptions{WebhookURL: url, WebhookRetries: retries})
+
+	notifier := s.startWebhookNotifier()
+	notifier.retryBaseDelay = time.Millisecond
+
+	return notifier
+}
+
+func TestWebhookNotifierStatuses(t *testing.T) {
+	t.Parallel()
+
+	g := NewWithT(t)
+
+	recorder := &webhookRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	notifier := newTestWebhookNotifier(server.URL, 0)
+
+	namespace := "policies"
+	parent := &ParentPolicy{Name: "parent1", Namespace: "policies"}
+	compliant := &ComplianceEvent{
+		Cluster: Cluster{Name: "cluster1", ClusterID: "cluster1-uuid"},
+		Event:   EventDetails{KeyID: 1, Compliance: "Compliant"},
+	}
+	nonCompliant := &ComplianceEvent{
+		Cluster:      Cluster{Name: "cluster1", ClusterID: "cluster1-uuid"},
+		Event:        EventDetails{KeyID: 2, PolicyID: 3, Compliance: "NonCompliant", Message: "not ok"},
+		ParentPolicy: parent,
+		Policy:       Policy{Name: "policy1", Namespace: &namespace, Spec: JSONMap{"secret": "do-not-send"}},
+	}
+
+	notifier.notify(compliant, nonCompliant)
+	notifier.stop(time.Minute)
+
+	// Compliance events after the notifier is stopped are ignored.
+	notifier.notify(nonCompliant)
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	g.Expect(recorder.payloads).To(HaveLen(1))
+	g.Expect(recorder.payloads[0].EventID).To(Equal(int32(2)))
+	g.Expect(recorder.payloads[0].ClusterName).To(Equal("cluster1"))
+	g.Expect(recorder.payloads[0].PolicyID).To(Equal(int32(3)))
+	g.Expect(recorder.payloads[0].PolicyName).To(Equal("policy1"))
+	g.Expect(*recorder.payloads[0].PolicyNamespace).To(Equal("policies"))
+	g.Expect(recorder.payloads[0].ParentPolicyName).To(Equal("parent1"))
+	g.Expect(recorder.payloads[0].Compliance).To(Equal("NonCompliant"))
+	g.Expect(recorder.payloads[0].Message).To(Equal("not ok"))
+}
+
+func TestWebhookNotifierRetries(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		codes            []int
+		retries          int
+		expectedAttempts int
+		expectedPayloads int
+	}{
+		"retries a 5xx response": {
+			codes:            []int{http.StatusInternalServerError, http.StatusBadGateway},
+			retries:          3,
+			expectedAttempts: 3,
+			expectedPayloads: 1,
+		},
+		"retries a 429 response": {
+			codes:            []int{http.StatusTooManyRequests},
+			retries:          3,
+			expectedAttempts: 2,
+			expectedPayloads: 1,
+		},
+		"gives up after the retries": {
+			codes:            []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			retries:          1,
+			expectedAttempts: 2,
+			expectedPayloads: 0,
+		},
+		"doesn't retry a 4xx response": {
+			codes:            []int{http.StatusBadRequest},
+			retries:          3,
+			expectedAttempts: 1,
+			expectedPayloads: 0,
+		},
+		"retries can be disabled": {
+			codes:            []int{http.StatusInternalServerError},
+			retries:          -1,
+			expectedAttempts: 1,
+			expectedPayloads: 0,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			recorder := &webhookRecorder{codes: test.codes}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			notifier := newTestWebhookNotifier(server.URL, test.retries)
+			notifier.notify(&ComplianceEvent{Event: EventDetails{KeyID: 1, Compliance: "NonCompliant"}})
+			notifier.stop(time.Minute)
+
+			recorder.lock.Lock()
+			defer recorder.lock.Unlock()
+
+			g.Expect(recorder.attempts).To(Equal(test.expectedAttempts))
+			g.Expect(recorder.payloads).To(HaveLen(test.expectedPayloads))
+		})
+	}
+}
+
+func TestWebhookNotifierNil(t *testing.T) {
+	t.Parallel()
+
+	var notifier *webhookNotifier
+
+	// These must not panic when the webhook is disabled.
+	notifier.notify(&ComplianceEvent{Event: EventDetails{Compliance: "NonCompliant"}})
+	notifier.stop(time.Second)
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]bool{
+		"https://example.com/hooks/compliance": true,
+		"http://localhost:8080":                true,
+		"ftp://example.com":                    false,
+		"example.com/hooks":                    false,
+		"https://":                             false,
+	}
+
+	for webhookURL, valid := range tests {
+		webhookURL := webhookURL
+		valid := valid
+
+		t.Run(webhookURL, func(t *testing.T) {
+			t.Parallel()
+
+			g := NewWithT(t)
+
+			err := validateWebhookURL(webhookURL)
+			if valid {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(HaveOccurred())
+			}
+		})
+	}
+}
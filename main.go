@@ -15,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-logr/zapr"
 	"github.com/spf13/pflag"
@@ -73,6 +74,8 @@ func printVersion() {
 	log.Info(
 		"Using",
 		"OperatorVersion", version.Version,
+		"GitCommit", version.GitCommit,
+		"BuildDate", version.BuildDate,
 		"GoVersion", runtime.Version(),
 		"GOOS", runtime.GOOS,
 		"GOARCH", runtime.GOARCH,
@@ -116,8 +119,16 @@ func main() {
 		enableWebhooks              bool
 		complianceAPIHost           string
 		complianceAPIPort           string
+		complianceAPISocketPath     string
 		complianceAPICert           string
 		complianceAPIKey            string
+		complianceAPICacheCapacity  int
+		complianceAPICacheTTL       time.Duration
+		complianceAPIOptions        complianceeventsapi.ComplianceAPIServerOptions
+		complianceDBPoolOptions     complianceeventsapi.DBPoolOptions
+		complianceDBMigrate         bool
+		complianceDBPreparedStmts   bool
+		complianceDBReadReplicaURL  string
 	)
 
 	pflag.StringVar(&metricsAddr, "metrics-bind-address", ":8383", "The address the metric endpoint binds to.")
@@ -171,6 +182,16 @@ func main() {
 		&complianceAPIPort, "compliance-history-api-port", "8384",
 		"The port that the compliance history API will listen on",
 	)
+	pflag.StringVar(
+		&complianceAPIOptions.ListenNetwork, "compliance-history-api-listen-network", "tcp",
+		"The network that the compliance history API will listen on, either tcp or unix. With unix, "+
+			"--compliance-history-api-socket-path is used instead of the host and port.",
+	)
+	pflag.StringVar(
+		&complianceAPISocketPath, "compliance-history-api-socket-path", "",
+		"The path of the Unix domain socket that the compliance history API will listen on when "+
+			"--compliance-history-api-listen-network is unix",
+	)
 	pflag.StringVar(
 		&complianceAPICert, "compliance-history-api-cert", "",
 		"The path to the certificate the compliance history API will use for HTTPS (CA cert, if any, concatenated "+
@@ -180,6 +201,246 @@ func main() {
 		&complianceAPIKey, "compliance-history-api-key", "",
 		"The path to the private key the compliance history API will use for HTTPS. If not set, HTTP will be used.",
 	)
+	pflag.IntVar(
+		&complianceAPICacheCapacity, "compliance-history-api-cache-capacity",
+		complianceeventsapi.DefaultKeyCacheCapacity,
+		"The maximum number of entries in each database ID cache used by the compliance history API",
+	)
+	pflag.DurationVar(
+		&complianceAPICacheTTL, "compliance-history-api-cache-ttl", complianceeventsapi.DefaultKeyCacheTTL,
+		"How long an entry in a database ID cache used by the compliance history API is valid for. Set to 0 to "+
+			"disable expiration.",
+	)
+	pflag.Int64Var(
+		&complianceAPIOptions.MaxRequestBodyBytes, "compliance-history-api-max-request-body-bytes",
+		complianceeventsapi.DefaultMaxRequestBodyBytes,
+		"The maximum size in bytes of a request body sent to the compliance history API",
+	)
+	pflag.Int64Var(
+		&complianceAPIOptions.MaxPolicySpecBytes, "compliance-history-api-max-policy-spec-bytes", 0,
+		"If set, the maximum size in bytes of the JSON of a single policy spec in a compliance event sent to the "+
+			"compliance history API",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.ShutdownTimeout, "compliance-history-api-shutdown-timeout",
+		complianceeventsapi.DefaultShutdownTimeout,
+		"How long in-flight compliance history API requests are given to finish during shutdown before the "+
+			"remaining connections are forcibly closed. New connections are refused during this time.",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.ReadTimeout, "compliance-history-api-read-timeout",
+		complianceeventsapi.DefaultReadTimeout,
+		"The maximum duration for the compliance history API to read an entire request, including the body",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.ReadHeaderTimeout, "compliance-history-api-read-header-timeout",
+		complianceeventsapi.DefaultReadHeaderTimeout,
+		"The maximum duration for the compliance history API to read the request headers",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.WriteTimeout, "compliance-history-api-write-timeout",
+		complianceeventsapi.DefaultWriteTimeout,
+		"The maximum duration for the compliance history API to write a response. Large bulk inserts may need a "+
+			"higher value.",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.IdleTimeout, "compliance-history-api-idle-timeout",
+		complianceeventsapi.DefaultIdleTimeout,
+		"The maximum duration the compliance history API waits for the next request on a keep-alive connection",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.DBRetries, "compliance-history-api-db-retries", complianceeventsapi.DefaultDBRetries,
+		"How many times the compliance history API retries recording a compliance event after a transient database "+
+			"error. Set to a negative value to disable retries.",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.DBRetryBaseDelay, "compliance-history-api-db-retry-base-delay",
+		complianceeventsapi.DefaultDBRetryBaseDelay,
+		"The delay before the first database retry by the compliance history API. It doubles on each retry.",
+	)
+	pflag.BoolVar(
+		&complianceDBMigrate, "compliance-history-db-migrate", true,
+		"Apply the compliance history database schema migrations at startup and when the database connection "+
+			"changes. Disable this when the schema is managed externally.",
+	)
+	pflag.BoolVar(
+		&complianceDBPreparedStmts, "compliance-history-db-prepared-statements", true,
+		"Cache the prepared statements of the queries that record compliance events. Disable this when the database "+
+			"is behind a connection pooler that doesn't support prepared statements, such as PgBouncer in "+
+			"transaction pooling mode.",
+	)
+	pflag.StringVar(
+		&complianceDBReadReplicaURL, "compliance-history-db-read-replica-url", "",
+		"The connection URL of a read replica of the compliance history database for the read-only API endpoints. "+
+			"Compliance events are always recorded in the primary database. When not set, the primary database is "+
+			"used for reads.",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.DBQueryTimeout, "compliance-history-api-db-query-timeout",
+		complianceeventsapi.DefaultDBQueryTimeout,
+		"The maximum duration of the database queries of a compliance history API request. Requests exceeding it "+
+			"get a 504 response. Set to a negative value to disable it.",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.RequestTimeout, "compliance-history-api-request-timeout", 0,
+		"The maximum duration of a compliance history API request, other than the streamed CSV and NDJSON "+
+			"responses. Requests exceeding it get a 503 response. This should be longer than "+
+			"--compliance-history-api-db-query-timeout and shorter than --compliance-history-api-write-timeout. "+
+			"The default of 0 disables it.",
+	)
+	pflag.IntVar(
+		&complianceDBPoolOptions.MaxOpenConns, "compliance-history-db-max-open-conns",
+		complianceeventsapi.DefaultDBMaxOpenConns,
+		"The maximum number of open connections to the compliance history database. Set to 0 for no limit.",
+	)
+	pflag.IntVar(
+		&complianceDBPoolOptions.MaxIdleConns, "compliance-history-db-max-idle-conns",
+		complianceeventsapi.DefaultDBMaxIdleConns,
+		"The maximum number of idle connections kept open to the compliance history database",
+	)
+	pflag.DurationVar(
+		&complianceDBPoolOptions.ConnMaxLifetime, "compliance-history-db-conn-max-lifetime",
+		complianceeventsapi.DefaultDBConnMaxLifetime,
+		"How long a connection to the compliance history database is reused before it is replaced. Set to 0 to "+
+			"reuse connections forever.",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.DedupWindow, "compliance-history-api-dedup-window", 0,
+		"If set, a compliance event that is identical, other than the timestamp, to one recorded within this "+
+			"duration of it is not recorded again. The existing compliance event is returned instead.",
+	)
+	pflag.StringSliceVar(
+		&complianceAPIOptions.CORSAllowedOrigins, "compliance-history-api-cors-allowed-origins", nil,
+		"The comma separated origins that browsers may call the compliance history API from. Set it to * to allow "+
+			"any origin. If not set, CORS is not enabled.",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.CacheWarmupSize, "compliance-history-api-cache-warmup-size", 0,
+		"If set, the compliance history API preloads its database ID caches at startup with up to this many of the "+
+			"clusters, parent policies, and policies with the most recent compliance events",
+	)
+	pflag.Float64Var(
+		&complianceAPIOptions.RateLimit, "compliance-history-api-rate-limit", 0,
+		"If set, each client of the compliance history API is limited to this many requests per second. Clients "+
+			"are identified by their user once their token is verified, or by their IP address until then.",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.RateLimitBurst, "compliance-history-api-rate-limit-burst",
+		complianceeventsapi.DefaultRateLimitBurst,
+		"The number of requests a client of the compliance history API can make at once before being rate limited",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.MaxConcurrentRequests, "compliance-history-api-max-concurrent-requests", 0,
+		"If set, the compliance history API responds with a 503 status code when this many requests are already "+
+			"being handled, regardless of the client",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.RetentionPeriod, "compliance-history-api-retention-period", 0,
+		"If set, compliance events with a timestamp older than this duration are periodically deleted. If not set, "+
+			"compliance events are kept forever.",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.RetentionInterval, "compliance-history-api-retention-interval",
+		complianceeventsapi.DefaultRetentionInterval,
+		"How often compliance events older than the retention period are deleted.",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.RetentionBatchSize, "compliance-history-api-retention-batch-size",
+		complianceeventsapi.DefaultRetentionBatchSize,
+		"The maximum number of compliance events deleted in a single database statement when purging old "+
+			"compliance events.",
+	)
+	pflag.BoolVar(
+		&complianceAPIOptions.ValidateJSONSchema, "compliance-history-api-validate-json-schema", false,
+		"Validate the request bodies of recorded compliance events against the compliance history API's OpenAPI "+
+			"schema before processing them",
+	)
+	pflag.BoolVar(
+		&complianceAPIOptions.StrictJSON, "compliance-history-api-strict-json", false,
+		"Reject the request bodies of recorded compliance events that have fields not in the compliance history API, "+
+			"such as misspelled field names, instead of ignoring the unknown fields",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.EventQueueSize, "compliance-history-api-event-queue-size", 0,
+		"If set, compliance events are accepted with a 202 response and recorded in the database in the background "+
+			"from an in-memory queue of this size. This tolerates short database outages, but queued compliance "+
+			"events are lost if the process crashes.",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.EventQueueWorkers, "compliance-history-api-event-queue-workers",
+		complianceeventsapi.DefaultEventQueueWorkers,
+		"The number of workers that record the compliance events in the compliance history API's event queue",
+	)
+	pflag.BoolVar(
+		&complianceAPIOptions.EventQueueSyncFallback, "compliance-history-api-event-queue-sync-fallback", false,
+		"Record a compliance event synchronously when the compliance history API's event queue is full instead of "+
+			"returning a 503 response",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.InsertBatchWindow, "compliance-history-api-insert-batch-window", 0,
+		"If set, such as to 50ms, the compliance events of concurrent requests received within this duration are "+
+			"recorded in a single database transaction. Each request still waits for its compliance event to be "+
+			"recorded.",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.InsertBatchMaxSize, "compliance-history-api-insert-batch-max-size",
+		complianceeventsapi.DefaultInsertBatchMaxSize,
+		"The maximum number of compliance events recorded in a single database transaction when "+
+			"--compliance-history-api-insert-batch-window is set",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.EventStreamBufferSize, "compliance-history-api-event-stream-buffer-size",
+		complianceeventsapi.DefaultEventStreamBufferSize,
+		"The number of compliance events buffered for each client of the compliance history API's compliance "+
+			"events stream. Clients that fall further behind are disconnected.",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.EventStreamMaxClients, "compliance-history-api-event-stream-max-clients",
+		complianceeventsapi.DefaultEventStreamMaxClients,
+		"The maximum number of concurrent clients of the compliance history API's compliance events stream",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.EventStreamMaxDuration, "compliance-history-api-event-stream-max-duration",
+		complianceeventsapi.DefaultEventStreamMaxDuration,
+		"How long a compliance events stream stays open before it's closed so that the client reconnects and its "+
+			"access is checked again",
+	)
+	pflag.StringVar(
+		&complianceAPIOptions.WebhookURL, "compliance-history-api-webhook-url", "",
+		"If set, a JSON payload of each recorded compliance event with one of the "+
+			"--compliance-history-api-webhook-statuses compliance statuses is sent to this URL in a POST request",
+	)
+	pflag.StringSliceVar(
+		&complianceAPIOptions.WebhookStatuses, "compliance-history-api-webhook-statuses",
+		complianceeventsapi.DefaultWebhookStatuses,
+		"The comma separated compliance statuses of recorded compliance events that are sent to the webhook",
+	)
+	pflag.IntVar(
+		&complianceAPIOptions.WebhookRetries, "compliance-history-api-webhook-retries",
+		complianceeventsapi.DefaultWebhookRetries,
+		"How many times a webhook delivery that failed due to a network error or a 429 or 5xx response is retried. "+
+			"Set to a negative value to disable retries.",
+	)
+	pflag.DurationVar(
+		&complianceAPIOptions.WebhookTimeout, "compliance-history-api-webhook-timeout",
+		complianceeventsapi.DefaultWebhookTimeout,
+		"The maximum duration of a single webhook delivery attempt",
+	)
+	pflag.StringVar(
+		&complianceAPIOptions.AuditLogPath, "compliance-history-api-audit-log-path", "",
+		"If set, an audit record of each compliance event recorded by the compliance history API is appended as a "+
+			"line of JSON to this file. Use - for standard output.",
+	)
+	pflag.BoolVar(
+		&complianceAPIOptions.H2C, "compliance-history-api-h2c", false,
+		"Serve the compliance history API over HTTP/2 without TLS (h2c) in addition to HTTP/1.1. This is ignored "+
+			"when --compliance-history-api-cert is set.",
+	)
+	pflag.StringVar(
+		&complianceAPIOptions.BasePath, "compliance-history-api-base-path", "",
+		"If set, all compliance history API routes are served under this path prefix, such as /compliance, for when "+
+			"the API is behind an ingress that doesn't strip the prefix",
+	)
 
 	pflag.Parse()
 
@@ -217,6 +478,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	complianceAPIAddr := net.JoinHostPort(complianceAPIHost, complianceAPIPort)
+
+	switch complianceAPIOptions.ListenNetwork {
+	case "tcp":
+	case "unix":
+		if complianceAPISocketPath == "" {
+			log.Info("the compliance-history-api-socket-path flag must be set when the listen network is unix")
+			os.Exit(1)
+		}
+
+		complianceAPIAddr = complianceAPISocketPath
+	default:
+		log.Info("the compliance-history-api-listen-network flag must be one of: tcp, unix")
+		os.Exit(1)
+	}
+
 	namespace, err := getWatchNamespace()
 	if err != nil {
 		log.Error(err, "Failed to get watch namespace")
@@ -505,9 +782,16 @@ func main() {
 		client,
 		clusterID,
 		complianceEventsNamespace,
-		net.JoinHostPort(complianceAPIHost, complianceAPIPort),
+		complianceAPIAddr,
 		complianceAPICert,
 		complianceAPIKey,
+		complianceAPICacheCapacity,
+		complianceAPICacheTTL,
+		complianceAPIOptions,
+		complianceDBPoolOptions,
+		complianceDBMigrate,
+		complianceDBPreparedStmts,
+		complianceDBReadReplicaURL,
 		&wg,
 		tempDir,
 		replicatedPolicyUpdates,
@@ -553,6 +837,13 @@ func startComplianceEventsAPI(
 	complianceAPIAddr string,
 	complianceAPICert string,
 	complianceAPIKey string,
+	complianceAPICacheCapacity int,
+	complianceAPICacheTTL time.Duration,
+	complianceAPIOptions complianceeventsapi.ComplianceAPIServerOptions,
+	complianceDBPoolOptions complianceeventsapi.DBPoolOptions,
+	complianceDBMigrate bool,
+	complianceDBPreparedStmts bool,
+	complianceDBReadReplicaURL string,
 	wg *sync.WaitGroup,
 	tempDir string,
 	reconcileRequests chan<- event.GenericEvent,
@@ -593,10 +884,37 @@ func startComplianceEventsAPI(
 	}
 
 	complianceServerCtx, err := complianceeventsapi.NewComplianceServerCtx(dbConnectionURL, clusterID)
+	complianceServerCtx.ConfigureKeyCaches(complianceAPICacheCapacity, complianceAPICacheTTL)
+	complianceServerCtx.ConfigureDBPool(complianceDBPoolOptions)
+
+	if !complianceDBMigrate {
+		complianceServerCtx.DisableMigrations()
+	}
+
+	if !complianceDBPreparedStmts {
+		complianceServerCtx.DisablePreparedStatements()
+	}
+
+	if replicaErr := complianceServerCtx.ConfigureReadReplica(complianceDBReadReplicaURL); replicaErr != nil {
+		log.Error(replicaErr, "Invalid --compliance-history-db-read-replica-url value")
+
+		os.Exit(1)
+	}
+
+	// complianceAPIDisabled is set when the database schema is invalid so that the compliance events API doesn't serve
+	// requests that would fail on the missing tables or columns. The rest of the propagator keeps running.
+	complianceAPIDisabled := false
+
 	if err == nil {
 		// If the migration failed, MigrateDB will log it and MonitorDatabaseConnection will fix it.
 		err := complianceServerCtx.MigrateDB(ctx, client, controllerNamespace)
-		if err != nil {
+		if errors.Is(err, complianceeventsapi.ErrInvalidDBSchema) {
+			// MigrateDB already logged the missing tables or columns and sent a Kubernetes event
+			log.Info("The compliance events API is disabled until the database schema is fixed and the propagator " +
+				"is restarted")
+
+			complianceAPIDisabled = true
+		} else if err != nil {
 			log.Info("Will periodically retry the migration until it is successful")
 		}
 	} else if !errors.Is(err, complianceeventsapi.ErrInvalidConnectionURL) {
@@ -621,6 +939,16 @@ func startComplianceEventsAPI(
 
 	var cert *tls.Certificate
 
+	if (complianceAPICert == "") != (complianceAPIKey == "") {
+		log.Error(
+			errors.New("only one of the certificate and private key was provided"),
+			"Both --compliance-history-api-cert and --compliance-history-api-key must be set to use HTTPS",
+			"cert", complianceAPICert,
+			"key", complianceAPIKey,
+		)
+		os.Exit(1)
+	}
+
 	if complianceAPICert != "" && complianceAPIKey != "" {
 		certTemp, err := tls.LoadX509KeyPair(complianceAPICert, complianceAPIKey)
 		if err != nil {
@@ -638,19 +966,23 @@ func startComplianceEventsAPI(
 		log.Info("The compliance events history API will listen on HTTP since no certificate was provided")
 	}
 
-	complianceAPI := complianceeventsapi.NewComplianceAPIServer(complianceAPIAddr, cfg, cert)
+	complianceAPI := complianceeventsapi.NewComplianceAPIServer(
+		complianceAPIAddr, cfg, cert, complianceAPIOptions,
+	)
 
-	wg.Add(1)
+	if !complianceAPIDisabled {
+		wg.Add(1)
 
-	go func() {
-		if err := complianceAPI.Start(ctx, complianceServerCtx); err != nil {
-			log.Error(err, "Failed to start the compliance API server")
+		go func() {
+			if err := complianceAPI.Start(ctx, complianceServerCtx); err != nil {
+				log.Error(err, "Failed to start the compliance API server")
 
-			os.Exit(1)
-		}
+				os.Exit(1)
+			}
 
-		wg.Done()
-	}()
+			wg.Done()
+		}()
+	}
 
 	wg.Add(1)
 
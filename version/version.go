@@ -3,4 +3,13 @@
 
 package version
 
-var Version = "0.0.1"
+// These are set at build time with -ldflags, for example:
+//
+//	-X open-cluster-management.io/governance-policy-propagator/version.GitCommit=$(git rev-parse HEAD)
+var (
+	Version = "0.0.1"
+	// GitCommit is the git commit the binary was built from.
+	GitCommit = "unknown"
+	// BuildDate is when the binary was built in RFC 3339 format.
+	BuildDate = "unknown"
+)